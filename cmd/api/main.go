@@ -1,22 +1,48 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
-
-	"github.com/gin-gonic/gin"
-	swaggerFiles "github.com/swaggo/files"
-	ginSwagger "github.com/swaggo/gin-swagger"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/tamabsndra/miniproject/miniproject-backend/config"
 	_ "github.com/tamabsndra/miniproject/miniproject-backend/docs"
 	"github.com/tamabsndra/miniproject/miniproject-backend/handlers"
-	"github.com/tamabsndra/miniproject/miniproject-backend/middleware"
+	"github.com/tamabsndra/miniproject/miniproject-backend/models"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/audit"
 	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/database"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/database/migrations"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/keyring"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/mailer"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/oidc"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/passhash"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/passpolicy"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/ratelimit"
 	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/redis"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/store"
 	"github.com/tamabsndra/miniproject/miniproject-backend/repository"
+	"github.com/tamabsndra/miniproject/miniproject-backend/router"
 	"github.com/tamabsndra/miniproject/miniproject-backend/services"
+	"github.com/tamabsndra/miniproject/miniproject-backend/utils"
 )
 
+// oidcHTTPTimeout bounds each request to an OpenID provider.
+const oidcHTTPTimeout = 10 * time.Second
+
+// keyMaintenanceInterval is how often the keyring picks up keys from other
+// instances and checks whether it is time to rotate.
+const keyMaintenanceInterval = time.Minute
+
+// insecureDefaultJWTSecret is the JWT_SECRET default of earlier versions,
+// refused because it is public.
+const insecureDefaultJWTSecret = "your-secret-key"
+
 // @title           Backend API
 // @version         1.0
 // @description     A REST API using Gin framework with JWT authentication.
@@ -46,54 +72,272 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
-	defer db.Close()
 
-    redisClient, err := redis.NewRedisClient(cfg)
-    if err != nil {
-        log.Fatalf("Failed to connect to Redis: %v", err)
-    }
-    defer redisClient.Close()
+	if cfg.AutoMigrate {
+		migrator, err := migrations.New(db)
+		if err != nil {
+			log.Fatalf("Failed to load migrations: %v", err)
+		}
+
+		applied, err := migrator.Up(context.Background())
+		if err != nil {
+			log.Fatalf("Failed to run migrations: %v", err)
+		}
+		log.Printf("Applied %d migration(s)", applied)
+	}
+
+	redisClient, err := redis.NewRedisClient(cfg)
+	if err != nil {
+		log.Fatalf("Failed to connect to Redis: %v", err)
+	}
+
+	userRepo := repository.NewUserRepository(db, cfg.DBQueryTimeout)
+	postRepo := repository.NewPostRepository(db, cfg.DBQueryTimeout)
+	roleRepo := repository.NewRoleRepository(db, cfg.DBQueryTimeout)
+	mfaRepo := repository.NewMFARepository(db, cfg.DBQueryTimeout)
+	identityRepo := repository.NewIdentityRepository(db, cfg.DBQueryTimeout)
+	apiKeyRepo := repository.NewAPIKeyRepository(db, cfg.DBQueryTimeout)
+
+	mail, err := mailer.New(cfg)
+	if err != nil {
+		log.Fatalf("Failed to configure mailer: %v", err)
+	}
+
+	keys, err := openKeyRing(cfg)
+	if err != nil {
+		log.Fatalf("Failed to load JWT signing keys: %v", err)
+	}
+
+	redisStore := store.NewRedisStore(redisClient, cfg.RedisTimeout)
+	signer := utils.NewTokenSigner(keys, cfg.JWTIssuer, cfg.JWTAudience)
+	tokenService := services.NewTokenService(redisStore, cfg.TokenExpiry, cfg.RefreshTokenExpiry, signer)
+	verificationPolicy, err := services.ParseVerificationPolicy(cfg.RequireVerifiedEmailFor)
+	if err != nil {
+		log.Fatalf("Invalid REQUIRE_VERIFIED_EMAIL_FOR: %v", err)
+	}
+
+	limiter := ratelimit.New(redisStore)
+	verificationService := services.NewEmailVerificationService(userRepo, redisStore, mail, limiter, verificationPolicy,
+		cfg.EmailVerificationTTL, cfg.VerificationResendCooldown, cfg.AppURL)
+	mfaService := services.NewMFAService(mfaRepo, userRepo, tokenService, redisStore, limiter, cfg.MFAIssuer, cfg.MFAPendingTTL)
+	hasher, err := newPasswordHasher(cfg)
+	if err != nil {
+		log.Fatalf("Invalid password hashing configuration: %v", err)
+	}
+	passwordPolicy, err := newPasswordPolicy(cfg, hasher)
+	if err != nil {
+		log.Fatalf("Failed to load breached password list: %v", err)
+	}
+	auditRecorder, err := openAuditLog(cfg)
+	if err != nil {
+		log.Fatalf("Failed to open audit log: %v", err)
+	}
+	loginGuard := services.NewLoginGuard(redisStore, userRepo, auditRecorder, services.LoginGuardPolicy{
+		AccountFreeAttempts:     cfg.LoginAccountFreeAttempts,
+		IPFreeAttempts:          cfg.LoginIPFreeAttempts,
+		BackoffBase:             cfg.LoginBackoffBase,
+		BackoffMax:              cfg.LoginBackoffMax,
+		AccountLockoutThreshold: cfg.LoginAccountLockoutThreshold,
+		IPLockoutThreshold:      cfg.LoginIPLockoutThreshold,
+		LockoutDuration:         cfg.LoginLockoutDuration,
+		FailureWindow:           cfg.LoginFailureWindow,
+	})
+	authService := services.NewAuthService(userRepo, hasher, passwordPolicy, tokenService, verificationService, mfaService, loginGuard)
+	oidcService := services.NewOIDCService(oidcProviders(cfg), identityRepo, userRepo, hasher, authService, redisStore, cfg.OIDCStateTTL)
+	apiKeyService := services.NewAPIKeyService(apiKeyRepo, userRepo)
+	postService := services.NewPostService(postRepo)
+	userService := services.NewUserService(userRepo, tokenService)
+	rbacService := services.NewRBACService(roleRepo)
+	passwordResetService := services.NewPasswordResetService(userRepo, hasher, passwordPolicy, redisStore, limiter, tokenService, mail, cfg.PasswordResetTTL, cfg.PasswordResetCooldown, cfg.AppURL)
+
+	if cfg.BootstrapAdmin != "" {
+		if err := userService.GrantRole(context.Background(), cfg.BootstrapAdmin, models.RoleAdmin); err != nil {
+			log.Printf("Failed to grant admin role to %s: %v", cfg.BootstrapAdmin, err)
+		}
+	}
+
+	authHandler := handlers.NewAuthHandler(authService, tokenService)
+	postHandler := handlers.NewPostHandler(postService)
+	adminHandler := handlers.NewAdminHandler(userService, postService, loginGuard)
+
+	healthService := services.NewHealthService(cfg.HealthCheckTimeout,
+		services.HealthCheck{Name: "postgres", Check: db.PingContext},
+		services.HealthCheck{Name: "redis", Check: func(ctx context.Context) error {
+			return redisClient.Ping(ctx).Err()
+		}},
+	)
+
+	r, err := router.New(router.Config{
+		RequestTimeout:      cfg.RequestTimeout,
+		AllowedOrigins:      cfg.CORSAllowedOrigins,
+		TrustedProxies:      cfg.TrustedProxies,
+		TokenService:        tokenService,
+		APIKeyService:       apiKeyService,
+		RBACService:         rbacService,
+		VerificationService: verificationService,
+		RateLimiter:         limiter,
+		AuthHandler:         authHandler,
+		PostHandler:         postHandler,
+		HealthHandler:       handlers.NewHealthHandler(healthService),
+		AdminHandler:        adminHandler,
+		UserHandler:         handlers.NewUserHandler(userService),
+		PasswordHandler:     handlers.NewPasswordHandler(passwordResetService),
+		VerificationHandler: handlers.NewVerificationHandler(verificationService),
+		SessionHandler:      handlers.NewSessionHandler(tokenService),
+		MFAHandler:          handlers.NewMFAHandler(mfaService),
+		JWKSHandler:         handlers.NewJWKSHandler(keys),
+		OIDCHandler:         handlers.NewOIDCHandler(oidcService),
+		APIKeyHandler:       handlers.NewAPIKeyHandler(apiKeyService),
+	})
+	if err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
+	srv := &http.Server{
+		Addr:         ":" + cfg.ServerPort,
+		Handler:      r,
+		ReadTimeout:  cfg.ServerReadTimeout,
+		WriteTimeout: cfg.ServerWriteTimeout,
+		IdleTimeout:  cfg.ServerIdleTimeout,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	go keys.Run(ctx, keyMaintenanceInterval)
+	go postService.RunScheduler(ctx, cfg.PostSchedulerInterval)
+	go postService.RunPurger(ctx, cfg.PostPurgeInterval, cfg.PostTrashRetention)
+
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Printf("Server starting on port %s", cfg.ServerPort)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+	}()
 
-	userRepo := repository.NewUserRepository(db)
-	postRepo := repository.NewPostRepository(db)
+	select {
+	case err := <-serverErr:
+		log.Fatalf("Failed to start server: %v", err)
+	case <-ctx.Done():
+	}
+
+	// Restore default signal handling so a second signal kills the process
+	// instead of waiting out the grace period.
+	stop()
+	healthService.SetShuttingDown()
+
+	// Keep serving while readiness probes see the 503 and take this instance
+	// out of rotation; closing the listener first would refuse the requests
+	// still being routed here.
+	if cfg.ShutdownDrainDelay > 0 {
+		log.Printf("Shutting down, marked not ready; waiting %s before closing the listener", cfg.ShutdownDrainDelay)
+		time.Sleep(cfg.ShutdownDrainDelay)
+	}
+	log.Printf("Shutting down, draining in-flight requests for up to %s", cfg.ShutdownTimeout)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Graceful shutdown incomplete, closing remaining connections: %v", err)
+		srv.Close()
+	}
 
-    tokenService := services.NewTokenService(redisClient, cfg.TokenExpiry, cfg.JWTSecret)
-    authService := services.NewAuthService(userRepo, cfg.JWTSecret)
-    postService := services.NewPostService(postRepo)
+	// Emails requested before the shutdown still use the stores.
+	passwordResetService.Wait()
+	verificationService.Wait()
 
-    authHandler := handlers.NewAuthHandler(authService, tokenService)
-    postHandler := handlers.NewPostHandler(postService)
+	// Requests and background work have drained, so nothing uses the stores
+	// any more.
+	if err := db.Close(); err != nil {
+		log.Printf("Failed to close database: %v", err)
+	}
+	if err := redisClient.Close(); err != nil {
+		log.Printf("Failed to close Redis client: %v", err)
+	}
 
-	router := gin.Default()
+	log.Println("Server stopped")
+}
 
-	router.Use(middleware.CORS())
+// openKeyRing builds the JWT keyring for the configured algorithm. Keys stop
+// verifying once every token they could have signed has expired.
+func openKeyRing(cfg *config.Config) (*keyring.KeyRing, error) {
+	if cfg.JWTSigningAlg == keyring.AlgHS256 {
+		// Anyone who knows the secret can mint tokens, so refuse to run
+		// with none or with the well-known value earlier versions shipped.
+		if cfg.JWTSecret == "" || cfg.JWTSecret == insecureDefaultJWTSecret {
+			return nil, errors.New("JWT_SIGNING_ALG=HS256 needs JWT_SECRET set to a long random value")
+		}
+		return keyring.NewHMAC(cfg.JWTSecret), nil
+	}
 
-	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+	retain := max(cfg.TokenExpiry, cfg.RefreshTokenExpiry, cfg.MFAPendingTTL)
+	return keyring.Open(cfg.JWTKeysDir, cfg.JWTSigningAlg, cfg.JWTKeyRotation, retain)
+}
 
-	api := router.Group("/api")
-    {
-        api.POST("/login", authHandler.Login)
-		api.POST("/register", authHandler.Register)
-		api.POST("/validate-token", authHandler.ValidateToken)
+func oidcProviders(cfg *config.Config) map[string]services.OIDCProvider {
+	client := &http.Client{Timeout: oidcHTTPTimeout}
+	providers := make(map[string]services.OIDCProvider, len(cfg.OIDCProviders))
+	for _, p := range cfg.OIDCProviders {
+		if p.Issuer == "" || p.ClientID == "" {
+			log.Fatalf("OIDC provider %q needs an issuer and client ID", p.Name)
+		}
+		providers[p.Name] = oidc.NewProvider(oidc.Config{
+			Issuer:       p.Issuer,
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			RedirectURL:  p.RedirectURL,
+			Scopes:       p.Scopes,
+		}, client)
+	}
+	return providers
+}
 
-        protected := api.Group("")
-        protected.Use(middleware.AuthMiddleware(cfg.JWTSecret, tokenService))
-        {
-            protected.POST("/logout", authHandler.Logout)
-			protected.GET("/me", authHandler.GetMe)
+func newPasswordHasher(cfg *config.Config) (*passhash.Hasher, error) {
+	switch cfg.PasswordHashAlgorithm {
+	case passhash.Argon2id:
+		params := passhash.DefaultArgon2Params
+		params.Memory = uint32(cfg.Argon2Memory)
+		params.Iterations = uint32(cfg.Argon2Iterations)
+		params.Parallelism = uint8(cfg.Argon2Parallelism)
+		return passhash.NewArgon2id(params)
+	case passhash.Bcrypt:
+		return passhash.NewBcrypt(cfg.BcryptCost)
+	default:
+		return nil, fmt.Errorf("unknown PASSWORD_HASH_ALGORITHM %q", cfg.PasswordHashAlgorithm)
+	}
+}
 
-            protected.POST("/posts", postHandler.Create)
-            protected.GET("/posts", postHandler.GetAll)
-			protected.GET("/post-detail", postHandler.GetPostDetail)
-            protected.GET("/posts/:id", postHandler.GetByID)
-			protected.GET("/posts/my/:id", postHandler.GetByUserID)
-			protected.PUT("/posts/:id", postHandler.Update)
-			protected.DELETE("/posts/:id", postHandler.Delete)
-        }
-    }
+// newPasswordPolicy builds the policy for new passwords. Passwords longer
+// than hasher accepts are rejected by the policy, not by a failed hash.
+func newPasswordPolicy(cfg *config.Config, hasher *passhash.Hasher) (*passpolicy.Policy, error) {
+	policy := &passpolicy.Policy{
+		MinLength:            cfg.PasswordMinLength,
+		MaxLength:            cfg.PasswordMaxLength,
+		MaxBytes:             hasher.MaxPasswordBytes(),
+		MinCharClasses:       cfg.PasswordMinCharClasses,
+		DisallowPersonalInfo: cfg.PasswordDisallowPersonalInfo,
+		MinScore:             cfg.PasswordMinScore,
+	}
+	if cfg.BreachedPasswordsFile != "" {
+		list, err := passpolicy.OpenBreachedList(cfg.BreachedPasswordsFile)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Checking passwords against %s (%d MB)", cfg.BreachedPasswordsFile, list.Size()>>20)
+		policy.Breached = list
+	}
+	return policy, nil
+}
 
-    log.Printf("Server starting on port %s", cfg.ServerPort)
-    if err := router.Run(":" + cfg.ServerPort); err != nil {
-        log.Fatalf("Failed to start server: %v", err)
-    }
+func openAuditLog(cfg *config.Config) (*audit.LogRecorder, error) {
+	if cfg.AuditLogFile == "" {
+		return audit.NewLogRecorder(os.Stdout), nil
+	}
+	f, err := os.OpenFile(cfg.AuditLogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return audit.NewLogRecorder(f), nil
 }
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/tamabsndra/miniproject/miniproject-backend/config"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/database"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/database/migrations"
+)
+
+const usage = `Usage: migrate <command>
+
+Commands:
+  up          apply all pending migrations
+  down [n]    roll back the last n migrations (default 1)
+  status      list migrations and whether they are applied
+`
+
+func main() {
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	db, err := database.NewPostgresDB(cfg)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	migrator, err := migrations.New(db)
+	if err != nil {
+		log.Fatalf("Failed to load migrations: %v", err)
+	}
+
+	ctx := context.Background()
+	switch flag.Arg(0) {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		log.Printf("Applied %d migration(s)", applied)
+	case "down":
+		steps := 1
+		if flag.NArg() > 1 {
+			steps, err = strconv.Atoi(flag.Arg(1))
+			if err != nil || steps < 1 {
+				log.Fatalf("Invalid step count %q", flag.Arg(1))
+			}
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		if err != nil {
+			log.Fatalf("Rollback failed: %v", err)
+		}
+		log.Printf("Rolled back %d migration(s)", reverted)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.Fatalf("Failed to read migration status: %v", err)
+		}
+		for _, status := range statuses {
+			state := "pending"
+			if status.AppliedAt != nil {
+				state = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%06d  %-40s %s\n", status.Version, status.Name, state)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
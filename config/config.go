@@ -1,23 +1,150 @@
 package config
 
 import (
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	DBHost     string
-	DBUser     string
-	DBPassword string
-	DBName     string
-	DBPort     string
-	JWTSecret  string
-	ServerPort string
-	RedisAddr     string
-    RedisPassword string
-    TokenExpiry   time.Duration
+	DBHost             string
+	DBUser             string
+	DBPassword         string
+	DBName             string
+	DBPort             string
+	JWTSecret          string
+	ServerPort         string
+	RedisAddr          string
+	RedisPassword      string
+	TokenExpiry        time.Duration
+	RefreshTokenExpiry time.Duration
+	AutoMigrate        bool
+	RequestTimeout     time.Duration
+	DBQueryTimeout     time.Duration
+	RedisTimeout       time.Duration
+	ServerReadTimeout  time.Duration
+	ServerWriteTimeout time.Duration
+	ServerIdleTimeout  time.Duration
+	ShutdownTimeout    time.Duration
+	// ShutdownDrainDelay is how long /readyz reports 503 before the listener
+	// closes, so load balancers stop routing new connections first.
+	ShutdownDrainDelay time.Duration
+	HealthCheckTimeout time.Duration
+	// BootstrapAdmin is the email of an existing account that is granted the
+	// admin role at startup, so a fresh deployment has someone to manage roles.
+	BootstrapAdmin string
+
+	// AppURL is the frontend base URL used to build links sent by email.
+	AppURL string
+	// CORSAllowedOrigins may call the API from a browser with credentials,
+	// which the OIDC sign-in needs for its binding cookie. It defaults to
+	// the origin of AppURL.
+	CORSAllowedOrigins []string
+	// TrustedProxies lists the reverse proxies, as addresses or CIDR
+	// ranges, whose X-Forwarded-For header gives the client IP. Empty
+	// trusts none and uses the connection's remote address.
+	TrustedProxies   []string
+	PasswordResetTTL time.Duration
+	// PasswordResetCooldown is the minimum time between reset emails sent
+	// to one account.
+	PasswordResetCooldown time.Duration
+	// MailDriver selects the mailer: "smtp", or "log" to write messages to
+	// MailLogFile (stdout when empty) for local development.
+	MailDriver   string
+	MailFrom     string
+	MailLogFile  string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+
+	EmailVerificationTTL       time.Duration
+	VerificationResendCooldown time.Duration
+	// RequireVerifiedEmailFor lists the actions unverified accounts may not
+	// take: "login" and/or "posts". Empty allows everything.
+	RequireVerifiedEmailFor []string
+
+	// JWTSigningAlg is RS256 (the default), EdDSA or HS256. The asymmetric
+	// algorithms keep rotating keys in JWTKeysDir and publish them at
+	// /.well-known/jwks.json. HS256 signs with JWTSecret, which must then be
+	// set to something other than the old "your-secret-key" default.
+	JWTSigningAlg  string
+	JWTKeysDir     string
+	JWTKeyRotation time.Duration
+	JWTIssuer      string
+	// JWTAudience is stamped on and required in every token when set.
+	JWTAudience string
+
+	// MFAIssuer names the service in authenticator apps.
+	MFAIssuer     string
+	MFAPendingTTL time.Duration
+
+	// PasswordHashAlgorithm is "argon2id" or "bcrypt". Existing hashes
+	// are upgraded on login when the algorithm or its costs change.
+	PasswordHashAlgorithm string
+	BcryptCost            int
+	// Argon2Memory is in KiB.
+	Argon2Memory      int
+	Argon2Iterations  int
+	Argon2Parallelism int
+
+	// New passwords must pass the password policy. PasswordMinScore is the
+	// lowest accepted strength score from 0 to 4; zero turns the check off.
+	// PasswordMaxLength counts characters; with bcrypt, passwords are also
+	// limited to the 72 bytes it hashes.
+	PasswordMinLength            int
+	PasswordMaxLength            int
+	PasswordMinCharClasses       int
+	PasswordDisallowPersonalInfo bool
+	PasswordMinScore             int
+	// BreachedPasswordsFile lists SHA-1 hashes of breached passwords sorted
+	// by hash, as in the single-file output of the Pwned Passwords
+	// downloader; unused when empty. The file is binary searched on disk
+	// rather than loaded, so its size is bounded only by disk space: the
+	// full Pwned Passwords set (about a billion hashes, ~40 GB) costs a few
+	// dozen small reads per check and no memory.
+	BreachedPasswordsFile string
+
+	// Failed password logins back off exponentially after the free
+	// attempts and lock the account or IP out at its threshold.
+	LoginAccountFreeAttempts     int
+	LoginIPFreeAttempts          int
+	LoginBackoffBase             time.Duration
+	LoginBackoffMax              time.Duration
+	LoginAccountLockoutThreshold int
+	LoginIPLockoutThreshold      int
+	LoginLockoutDuration         time.Duration
+	LoginFailureWindow           time.Duration
+	// AuditLogFile receives audit events as JSON lines; stdout when empty.
+	AuditLogFile string
+
+	// OIDCProviders are the "Sign in with ..." providers, listed by name in
+	// OIDC_PROVIDERS and configured with OIDC_<NAME>_* variables.
+	OIDCProviders []OIDCProviderConfig
+	OIDCStateTTL  time.Duration
+
+	// PostSchedulerInterval is how often scheduled posts that are due get
+	// published.
+	PostSchedulerInterval time.Duration
+	// PostTrashRetention is how long deleted posts stay in the trash before
+	// they are purged; PostPurgeInterval is how often that is checked.
+	PostTrashRetention time.Duration
+	PostPurgeInterval  time.Duration
+}
+
+type OIDCProviderConfig struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is where the provider sends the browser back; the page
+	// there posts the code and state to /api/auth/oidc/<name>/callback.
+	RedirectURL string
+	Scopes      []string
 }
 
 func LoadConfig() (*Config, error) {
@@ -26,28 +153,163 @@ func LoadConfig() (*Config, error) {
 		return nil, err
 	}
 
-	tokenExpiry, err := time.ParseDuration(getEnv("TOKEN_EXPIRY", "24h"))
-    if err != nil {
-        tokenExpiry = 24 * time.Hour
-    }
+	appURL := getEnv("APP_URL", "http://localhost:3000")
 
 	return &Config{
-		DBHost:     getEnv("DB_HOST", "localhost"),
-		DBUser:     getEnv("DB_USER", "postgres"),
-		DBPassword: getEnv("DB_PASSWORD", ""),
-		DBName:     getEnv("DB_NAME", "myapp"),
-		DBPort:     getEnv("DB_PORT", "5432"),
-		JWTSecret:  getEnv("JWT_SECRET", "your-secret-key"),
-		ServerPort: getEnv("SERVER_PORT", "8080"),
-		RedisAddr:     getEnv("REDIS_ADDR", "localhost:6379"),
-        RedisPassword: getEnv("REDIS_PASSWORD", ""),
-        TokenExpiry:   tokenExpiry,
+		DBHost:             getEnv("DB_HOST", "localhost"),
+		DBUser:             getEnv("DB_USER", "postgres"),
+		DBPassword:         getEnv("DB_PASSWORD", ""),
+		DBName:             getEnv("DB_NAME", "myapp"),
+		DBPort:             getEnv("DB_PORT", "5432"),
+		JWTSecret:          getEnv("JWT_SECRET", ""),
+		ServerPort:         getEnv("SERVER_PORT", "8080"),
+		RedisAddr:          getEnv("REDIS_ADDR", "localhost:6379"),
+		RedisPassword:      getEnv("REDIS_PASSWORD", ""),
+		TokenExpiry:        getEnvDuration("TOKEN_EXPIRY", 15*time.Minute),
+		RefreshTokenExpiry: getEnvDuration("REFRESH_TOKEN_EXPIRY", 30*24*time.Hour),
+		AutoMigrate:        getEnvBool("AUTO_MIGRATE", true),
+		RequestTimeout:     getEnvDuration("REQUEST_TIMEOUT", 15*time.Second),
+		DBQueryTimeout:     getEnvDuration("DB_QUERY_TIMEOUT", 5*time.Second),
+		RedisTimeout:       getEnvDuration("REDIS_TIMEOUT", 2*time.Second),
+		ServerReadTimeout:  getEnvDuration("SERVER_READ_TIMEOUT", 15*time.Second),
+		ServerWriteTimeout: getEnvDuration("SERVER_WRITE_TIMEOUT", 30*time.Second),
+		ServerIdleTimeout:  getEnvDuration("SERVER_IDLE_TIMEOUT", 60*time.Second),
+		ShutdownTimeout:    getEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second),
+		ShutdownDrainDelay: getEnvDuration("SHUTDOWN_DRAIN_DELAY", 5*time.Second),
+		HealthCheckTimeout: getEnvDuration("HEALTH_CHECK_TIMEOUT", 2*time.Second),
+		BootstrapAdmin:     getEnv("BOOTSTRAP_ADMIN_EMAIL", ""),
+
+		AppURL:                appURL,
+		CORSAllowedOrigins:    getEnvList("CORS_ALLOWED_ORIGINS", []string{originOf(appURL)}),
+		TrustedProxies:        getEnvList("TRUSTED_PROXIES", nil),
+		PasswordResetTTL:      getEnvDuration("PASSWORD_RESET_TTL", time.Hour),
+		PasswordResetCooldown: getEnvDuration("PASSWORD_RESET_COOLDOWN", time.Minute),
+		MailDriver:            getEnv("MAIL_DRIVER", "log"),
+		MailFrom:              getEnv("MAIL_FROM", "no-reply@localhost"),
+		MailLogFile:           getEnv("MAIL_LOG_FILE", ""),
+		SMTPHost:              getEnv("SMTP_HOST", "localhost"),
+		SMTPPort:              getEnv("SMTP_PORT", "587"),
+		SMTPUsername:          getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:          getEnv("SMTP_PASSWORD", ""),
+
+		EmailVerificationTTL:       getEnvDuration("EMAIL_VERIFICATION_TTL", 24*time.Hour),
+		VerificationResendCooldown: getEnvDuration("VERIFICATION_RESEND_COOLDOWN", time.Minute),
+		RequireVerifiedEmailFor:    getEnvList("REQUIRE_VERIFIED_EMAIL_FOR", nil),
+
+		JWTSigningAlg:  getEnv("JWT_SIGNING_ALG", "RS256"),
+		JWTKeysDir:     getEnv("JWT_KEYS_DIR", "keys"),
+		JWTKeyRotation: getEnvDuration("JWT_KEY_ROTATION", 30*24*time.Hour),
+		JWTIssuer:      getEnv("JWT_ISSUER", "miniproject-backend"),
+		JWTAudience:    getEnv("JWT_AUDIENCE", "miniproject-api"),
+
+		MFAIssuer:     getEnv("MFA_ISSUER", "Mini Project"),
+		MFAPendingTTL: getEnvDuration("MFA_PENDING_TTL", 5*time.Minute),
+
+		PasswordHashAlgorithm: getEnv("PASSWORD_HASH_ALGORITHM", "argon2id"),
+		BcryptCost:            getEnvInt("BCRYPT_COST", 12),
+		Argon2Memory:          getEnvInt("ARGON2_MEMORY", 19*1024),
+		Argon2Iterations:      getEnvInt("ARGON2_ITERATIONS", 2),
+		Argon2Parallelism:     getEnvInt("ARGON2_PARALLELISM", 1),
+
+		PasswordMinLength:            getEnvInt("PASSWORD_MIN_LENGTH", 8),
+		PasswordMaxLength:            getEnvInt("PASSWORD_MAX_LENGTH", 72),
+		PasswordMinCharClasses:       getEnvInt("PASSWORD_MIN_CHAR_CLASSES", 0),
+		PasswordDisallowPersonalInfo: getEnvBool("PASSWORD_DISALLOW_PERSONAL_INFO", true),
+		PasswordMinScore:             getEnvInt("PASSWORD_MIN_SCORE", 2),
+		BreachedPasswordsFile:        getEnv("BREACHED_PASSWORDS_FILE", ""),
+
+		LoginAccountFreeAttempts:     getEnvInt("LOGIN_ACCOUNT_FREE_ATTEMPTS", 3),
+		LoginIPFreeAttempts:          getEnvInt("LOGIN_IP_FREE_ATTEMPTS", 20),
+		LoginBackoffBase:             getEnvDuration("LOGIN_BACKOFF_BASE", time.Second),
+		LoginBackoffMax:              getEnvDuration("LOGIN_BACKOFF_MAX", time.Minute),
+		LoginAccountLockoutThreshold: getEnvInt("LOGIN_ACCOUNT_LOCKOUT_THRESHOLD", 10),
+		LoginIPLockoutThreshold:      getEnvInt("LOGIN_IP_LOCKOUT_THRESHOLD", 50),
+		LoginLockoutDuration:         getEnvDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		LoginFailureWindow:           getEnvDuration("LOGIN_FAILURE_WINDOW", time.Hour),
+		AuditLogFile:                 getEnv("AUDIT_LOG_FILE", ""),
+
+		OIDCProviders: loadOIDCProviders(appURL),
+		OIDCStateTTL:  getEnvDuration("OIDC_STATE_TTL", 10*time.Minute),
+
+		PostSchedulerInterval: getEnvDuration("POST_SCHEDULER_INTERVAL", 30*time.Second),
+		PostTrashRetention:    getEnvDuration("POST_TRASH_RETENTION", 30*24*time.Hour),
+		PostPurgeInterval:     getEnvDuration("POST_PURGE_INTERVAL", time.Hour),
 	}, nil
 }
 
+func loadOIDCProviders(appURL string) []OIDCProviderConfig {
+	var providers []OIDCProviderConfig
+	for _, name := range getEnvList("OIDC_PROVIDERS", nil) {
+		name = strings.ToLower(name)
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		providers = append(providers, OIDCProviderConfig{
+			Name:         name,
+			Issuer:       getEnv(prefix+"ISSUER", ""),
+			ClientID:     getEnv(prefix+"CLIENT_ID", ""),
+			ClientSecret: getEnv(prefix+"CLIENT_SECRET", ""),
+			RedirectURL:  getEnv(prefix+"REDIRECT_URL", appURL+"/oauth/callback/"+name),
+			Scopes:       getEnvList(prefix+"SCOPES", []string{"openid", "email", "profile"}),
+		})
+	}
+	return providers
+}
+
 func getEnv(key, defaultValue string) string {
 	if value, exists := os.LookupEnv(key); exists {
 		return value
 	}
 	return defaultValue
 }
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value, exists := os.LookupEnv(key); exists {
+		if parsed, err := strconv.ParseBool(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value, exists := os.LookupEnv(key); exists {
+		if parsed, err := strconv.Atoi(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+// originOf returns the scheme and host of rawURL, or rawURL itself if it
+// does not parse.
+func originOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return rawURL
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// getEnvList splits a comma-separated variable, dropping empty items.
+func getEnvList(key string, defaultValue []string) []string {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value, exists := os.LookupEnv(key); exists {
+		if parsed, err := time.ParseDuration(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
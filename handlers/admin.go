@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+
+	"github.com/tamabsndra/miniproject/miniproject-backend/models"
+	"github.com/tamabsndra/miniproject/miniproject-backend/services"
+)
+
+type AdminHandler struct {
+	userService *services.UserService
+	postService *services.PostService
+	loginGuard  *services.LoginGuard
+	validator   *validator.Validate
+}
+
+func NewAdminHandler(userService *services.UserService, postService *services.PostService, loginGuard *services.LoginGuard) *AdminHandler {
+	return &AdminHandler{
+		userService: userService,
+		postService: postService,
+		loginGuard:  loginGuard,
+		validator:   validator.New(),
+	}
+}
+
+// @Summary      List users
+// @Description  List user accounts with their roles. Requires the users:read permission.
+// @Tags         admin
+// @Produce      json
+// @Param Authorization header string true "Authorization"
+// @Param        query query models.UserListQuery false "Pagination and role filter"
+// @Success      200  {object}  models.UserPage
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      403  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     BearerAuth
+// @Router       /admin/users [get]
+func (h *AdminHandler) ListUsers(c *gin.Context) {
+	var query models.UserListQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "invalid query parameters"})
+		return
+	}
+
+	if err := h.validator.Struct(query); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	users, err := h.userService.List(c.Request.Context(), query)
+	if err != nil {
+		respondUserError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+// @Summary      Change user roles
+// @Description  Replace the roles of a user. Requires the users:manage_roles permission. Removing a role signs the user out everywhere by revoking their tokens; added roles take effect on their next login or token refresh.
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Param Authorization header string true "Authorization"
+// @Param        id   path      int  true  "User ID"
+// @Param        request body models.UpdateUserRolesRequest true "New roles"
+// @Success      200  {object}  models.User
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      403  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     BearerAuth
+// @Router       /admin/users/{id}/roles [put]
+func (h *AdminHandler) UpdateUserRoles(c *gin.Context) {
+	var req models.UpdateUserRolesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "invalid user id"})
+		return
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	user, err := h.userService.SetRoles(c.Request.Context(), c.GetUint("userID"), uint(id), req.Roles)
+	if err != nil {
+		respondUserError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// @Summary      Unlock user login
+// @Description  Clear a user's failed login count and any backoff or lockout on their account. IP lockouts are not affected. Requires the users:unlock permission.
+// @Tags         admin
+// @Produce      json
+// @Param Authorization header string true "Authorization"
+// @Param        id   path      int  true  "User ID"
+// @Success      200  {object}  models.SuccessResponse
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      403  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     BearerAuth
+// @Router       /admin/users/{id}/unlock [post]
+func (h *AdminHandler) UnlockUser(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "invalid user id"})
+		return
+	}
+
+	if err := h.loginGuard.Unlock(c.Request.Context(), c.GetUint("userID"), uint(id)); err != nil {
+		respondUserError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{Message: "user login unlocked"})
+}
+
+// @Summary      Moderate post
+// @Description  Update any post regardless of its author. Requires the posts:moderate permission.
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Param Authorization header string true "Authorization"
+// @Param        id   path      int  true  "Post ID"
+// @Param        request body models.UpdatePostRequest true "Post data"
+// @Success      200  {object}  models.Post
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      403  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     BearerAuth
+// @Router       /admin/posts/{id} [put]
+func (h *AdminHandler) UpdatePost(c *gin.Context) {
+	var req models.UpdatePostRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "invalid post id"})
+		return
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	post, err := h.postService.ModerateUpdate(c.Request.Context(), c.GetUint("userID"), uint(id), req)
+	if err != nil {
+		respondPostError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, post)
+}
+
+// @Summary      Remove post
+// @Description  Move any post to its author's trash, regardless of who wrote it. The author can purge it but not restore it. Requires the posts:moderate permission.
+// @Tags         admin
+// @Produce      json
+// @Param Authorization header string true "Authorization"
+// @Param        id   path      int  true  "Post ID"
+// @Success      200  {object}  models.SuccessResponse
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      403  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     BearerAuth
+// @Router       /admin/posts/{id} [delete]
+func (h *AdminHandler) DeletePost(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "invalid post id"})
+		return
+	}
+
+	if err := h.postService.ModerateDelete(c.Request.Context(), uint(id)); err != nil {
+		respondPostError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{Message: "post deleted successfully"})
+}
+
+func respondUserError(c *gin.Context, err error) {
+	if respondContextError(c, err) {
+		return
+	}
+
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: err.Error()})
+	case errors.Is(err, services.ErrCannotRemoveOwnAdmin):
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
+	}
+}
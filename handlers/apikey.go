@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+
+	"github.com/tamabsndra/miniproject/miniproject-backend/models"
+	"github.com/tamabsndra/miniproject/miniproject-backend/services"
+)
+
+type APIKeyHandler struct {
+	apiKeyService *services.APIKeyService
+	validator     *validator.Validate
+}
+
+func NewAPIKeyHandler(apiKeyService *services.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyService: apiKeyService,
+		validator:     validator.New(),
+	}
+}
+
+// @Summary      List API keys
+// @Description  List the current user's API keys. The keys themselves are never returned, only their prefix.
+// @Tags         api-keys
+// @Produce      json
+// @Param Authorization header string true "Authorization"
+// @Success      200  {array}   models.APIKey
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     BearerAuth
+// @Router       /me/api-keys [get]
+func (h *APIKeyHandler) List(c *gin.Context) {
+	keys, err := h.apiKeyService.List(c.Request.Context(), c.GetUint("userID"))
+	if err != nil {
+		if respondContextError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "failed to list API keys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// @Summary      Create API key
+// @Description  Create a named, scoped, expiring API key for scripts. Send it as "Authorization: ApiKey <key>". The key is only shown in this response.
+// @Tags         api-keys
+// @Accept       json
+// @Produce      json
+// @Param Authorization header string true "Authorization"
+// @Param        request body models.CreateAPIKeyRequest true "Key details"
+// @Success      201  {object}  models.CreateAPIKeyResponse
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      409  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     BearerAuth
+// @Router       /me/api-keys [post]
+func (h *APIKeyHandler) Create(c *gin.Context) {
+	var req models.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "invalid request body"})
+		return
+	}
+	if err := h.validator.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	key, err := h.apiKeyService.Create(c.Request.Context(), c.GetUint("userID"), req)
+	if err != nil {
+		if respondContextError(c, err) {
+			return
+		}
+		if errors.Is(err, services.ErrTooManyAPIKeys) {
+			c.JSON(http.StatusConflict, models.ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "failed to create API key"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, key)
+}
+
+// @Summary      Revoke API key
+// @Description  Delete one of the current user's API keys. It stops working immediately.
+// @Tags         api-keys
+// @Produce      json
+// @Param Authorization header string true "Authorization"
+// @Param        id   path      int  true  "API key ID"
+// @Success      200  {object}  models.SuccessResponse
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     BearerAuth
+// @Router       /me/api-keys/{id} [delete]
+func (h *APIKeyHandler) Revoke(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "invalid API key id"})
+		return
+	}
+
+	if err := h.apiKeyService.Revoke(c.Request.Context(), c.GetUint("userID"), uint(id)); err != nil {
+		if respondContextError(c, err) {
+			return
+		}
+		if errors.Is(err, services.ErrAPIKeyNotFound) {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "failed to revoke API key"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{Message: "API key revoked"})
+}
@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"errors"
+	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -26,7 +28,7 @@ func NewAuthHandler(authService *services.AuthService, tokenService *services.To
 
 
 // @Summary      Login user
-// @Description  Authenticate user and return JWT token
+// @Description  Authenticate user and return JWT token. Accounts with two-factor authentication get mfa_required and an mfa_token to complete at /login/mfa instead. Repeated failures for an account or IP are answered with 429 and Retry-After, growing to a temporary lockout.
 // @Tags         auth
 // @Accept       json
 // @Produce      json
@@ -34,6 +36,9 @@ func NewAuthHandler(authService *services.AuthService, tokenService *services.To
 // @Success      200  {object}  models.LoginResponse
 // @Failure      400  {object}  models.ErrorResponse
 // @Failure      401  {object}  models.ErrorResponse
+// @Failure      403  {object}  models.ErrorResponse
+// @Failure      429  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
 // @Router       /login [post]
 func (h *AuthHandler) Login(c *gin.Context) {
     var req models.LoginRequest
@@ -47,15 +52,68 @@ func (h *AuthHandler) Login(c *gin.Context) {
         return
     }
 
-    response, err := h.authService.Login(req)
+    response, err := h.authService.Login(c.Request.Context(), req, clientInfo(c))
     if err != nil {
-        c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: err.Error()})
+        if respondContextError(c, err) || respondRateLimited(c, err) {
+            return
+        }
+        if errors.Is(err, services.ErrInvalidCredentials) {
+            c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: err.Error()})
+            return
+        }
+        if errors.Is(err, services.ErrEmailNotVerified) {
+            c.JSON(http.StatusForbidden, models.ErrorResponse{Error: err.Error()})
+            return
+        }
+        c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "failed to login"})
         return
     }
 
     c.JSON(http.StatusOK, response)
 }
 
+// @Summary      Complete two-factor login
+// @Description  Exchange the mfa_token returned by /login and an authenticator or recovery code for a token pair.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        request body models.MFALoginRequest true "Pending token and code"
+// @Success      200  {object}  models.LoginResponse
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      429  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /login/mfa [post]
+func (h *AuthHandler) LoginMFA(c *gin.Context) {
+	var req models.MFALoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	response, err := h.authService.CompleteMFALogin(c.Request.Context(), req, clientInfo(c))
+	if err != nil {
+		if respondContextError(c, err) || respondRateLimited(c, err) {
+			return
+		}
+
+		switch {
+		case errors.Is(err, services.ErrInvalidMFAToken), errors.Is(err, services.ErrInvalidMFACode):
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "failed to login"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
 // @Summary      Logout user
 // @Description  Invalidate the current JWT token
 // @Tags         auth
@@ -73,8 +131,15 @@ func (h *AuthHandler) Logout(c *gin.Context) {
         return
     }
 
-    err := h.tokenService.BlacklistToken(token.(string))
+    ctx := c.Request.Context()
+    err := h.tokenService.BlacklistToken(ctx, token.(string))
+    if err == nil {
+        err = h.tokenService.RevokeRefreshFamily(ctx, c.GetString("familyID"))
+    }
     if err != nil {
+        if respondContextError(c, err) {
+            return
+        }
         c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "failed to logout"})
         return
     }
@@ -82,6 +147,47 @@ func (h *AuthHandler) Logout(c *gin.Context) {
     c.JSON(http.StatusOK, models.SuccessResponse{Message: "successfully logged out"})
 }
 
+// @Summary      Refresh tokens
+// @Description  Exchange a refresh token for a new access/refresh token pair. Each refresh token can be used once; replaying a used one revokes the whole session.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        request body models.RefreshTokenRequest true "Refresh token"
+// @Success      200  {object}  models.TokenPair
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /refresh [post]
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req models.RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	tokens, err := h.authService.Refresh(c.Request.Context(), req, clientInfo(c))
+	if err != nil {
+		if respondContextError(c, err) {
+			return
+		}
+
+		switch {
+		case errors.Is(err, services.ErrInvalidRefreshToken), errors.Is(err, services.ErrRefreshTokenReused):
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "failed to refresh token"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
 // @Summary      Validate token
 // @Description  Validate JWT token and return its metadata
 // @Tags         auth
@@ -104,8 +210,11 @@ func (h *AuthHandler) ValidateToken(c *gin.Context) {
         return
     }
 
-    result, err := h.tokenService.ValidateToken(req.Token)
+    result, err := h.tokenService.ValidateToken(c.Request.Context(), req.Token)
     if err != nil {
+        if respondContextError(c, err) {
+            return
+        }
         c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "failed to validate token"})
         return
     }
@@ -114,7 +223,7 @@ func (h *AuthHandler) ValidateToken(c *gin.Context) {
 }
 
 // @Summary      Register user
-// @Description  Register a new user
+// @Description  Register a new user. The password must pass the password policy; a 400 lists every rule it broke in details.
 // @Tags         auth
 // @Accept       json
 // @Produce      json
@@ -136,38 +245,63 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	if err := h.authService.Register(req); err != nil {
+	if err := h.authService.Register(c.Request.Context(), req); err != nil {
+		if respondContextError(c, err) || respondPasswordPolicy(c, err) {
+			return
+		}
+		if errors.Is(err, services.ErrVerificationEmailNotSent) {
+			log.Printf("register: %v", err)
+			c.JSON(http.StatusOK, models.SuccessResponse{Message: "user created successfully, but the verification email could not be sent; request a new one"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, models.SuccessResponse{Message: "user created successfully"})
+	c.JSON(http.StatusOK, models.SuccessResponse{Message: "user created successfully, check your email to verify your address"})
 }
 
-// @Summary      GetMe
-// @Description  Get current user
+// @Summary      Change password
+// @Description  Change the current user's password. The new password must pass the password policy. Every existing session is revoked; set keep_current_session to receive a new token pair for this client.
 // @Tags         auth
+// @Accept       json
 // @Produce      json
-// @Success      200  {object}  models.User
+// @Param Authorization header string true "Authorization"
+// @Param        request body models.ChangePasswordRequest true "Current and new password"
+// @Success      200  {object}  models.ChangePasswordResponse
+// @Failure      400  {object}  models.ErrorResponse
 // @Failure      401  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
 // @Security     BearerAuth
-// @Router       /me [get]
-func (h *AuthHandler) GetMe(c *gin.Context) {
-	user, exists := c.Get("user")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "no user found"})
+// @Router       /me/password [post]
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	var req models.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "invalid request body"})
 		return
 	}
 
-	if err := h.validator.Struct(user); err != nil {
+	if err := h.validator.Struct(req); err != nil {
 		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	if user.(models.User).ID == 0 {
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "no user found"})
+	tokens, err := h.authService.ChangePassword(c.Request.Context(), c.GetUint("userID"), req, clientInfo(c))
+	if err != nil {
+		if respondContextError(c, err) || respondPasswordPolicy(c, err) {
+			return
+		}
+
+		switch {
+		case errors.Is(err, services.ErrIncorrectPassword), errors.Is(err, services.ErrPasswordUnchanged):
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		case errors.Is(err, services.ErrUserNotFound):
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "failed to change password"})
+		}
 		return
 	}
 
-	c.JSON(http.StatusOK, user.(models.User))
+	c.JSON(http.StatusOK, models.ChangePasswordResponse{Message: "password changed", Tokens: tokens})
 }
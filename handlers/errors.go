@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tamabsndra/miniproject/miniproject-backend/models"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/passpolicy"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/ratelimit"
+)
+
+// statusClientClosedRequest is the de facto status for requests abandoned by
+// the client; it is only ever seen in logs.
+const statusClientClosedRequest = 499
+
+// respondContextError writes the response for errors caused by the request
+// context ending and reports whether err was one of them.
+func respondContextError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		c.JSON(http.StatusGatewayTimeout, models.ErrorResponse{Error: "request timed out"})
+		return true
+	case errors.Is(err, context.Canceled):
+		c.AbortWithStatus(statusClientClosedRequest)
+		return true
+	}
+	return false
+}
+
+// respondRateLimited writes a 429 with a Retry-After header if err is a
+// rate limit rejection and reports whether it was.
+func respondRateLimited(c *gin.Context, err error) bool {
+	var limited *ratelimit.LimitedError
+	if !errors.As(err, &limited) {
+		return false
+	}
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(limited.RetryAfter.Seconds()))))
+	c.JSON(http.StatusTooManyRequests, models.ErrorResponse{Error: err.Error()})
+	return true
+}
+
+// respondPasswordPolicy writes a 400 listing every broken rule if err is a
+// password policy violation and reports whether it was.
+func respondPasswordPolicy(c *gin.Context, err error) bool {
+	var violation *passpolicy.ViolationError
+	if !errors.As(err, &violation) {
+		return false
+	}
+	c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error(), Details: violation.Problems})
+	return true
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tamabsndra/miniproject/miniproject-backend/models"
+	"github.com/tamabsndra/miniproject/miniproject-backend/services"
+)
+
+// The probes are served at the root rather than under /api, so they are
+// intentionally left out of the Swagger docs.
+
+type HealthHandler struct {
+	healthService *services.HealthService
+}
+
+func NewHealthHandler(healthService *services.HealthService) *HealthHandler {
+	return &HealthHandler{healthService: healthService}
+}
+
+// Liveness only reports that the process is serving requests; it never
+// touches dependencies so a database outage does not get the pod restarted.
+func (h *HealthHandler) Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, models.HealthReport{Status: models.HealthStatusUp})
+}
+
+func (h *HealthHandler) Readiness(c *gin.Context) {
+	report, ready := h.healthService.Readiness(c.Request.Context())
+	if !ready {
+		c.JSON(http.StatusServiceUnavailable, report)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/keyring"
+)
+
+// Like the probes, the JWKS document lives at a well-known root path and is
+// left out of the Swagger docs.
+
+type JWKSHandler struct {
+	keys *keyring.KeyRing
+}
+
+func NewJWKSHandler(keys *keyring.KeyRing) *JWKSHandler {
+	return &JWKSHandler{keys: keys}
+}
+
+// Get publishes the public keys that verify our tokens. Verifiers that cache
+// it should refetch when they see an unknown kid, since a freshly rotated key
+// signs immediately.
+func (h *JWKSHandler) Get(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.keys.JWKS())
+}
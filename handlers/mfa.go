@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+
+	"github.com/tamabsndra/miniproject/miniproject-backend/models"
+	"github.com/tamabsndra/miniproject/miniproject-backend/services"
+)
+
+type MFAHandler struct {
+	mfaService *services.MFAService
+	validator  *validator.Validate
+}
+
+func NewMFAHandler(mfaService *services.MFAService) *MFAHandler {
+	return &MFAHandler{
+		mfaService: mfaService,
+		validator:  validator.New(),
+	}
+}
+
+// @Summary      Start TOTP enrollment
+// @Description  Generate a new authenticator secret for the current user, returned as text, an otpauth:// URI and a QR code PNG data URI. Two-factor login is not required until the secret is confirmed.
+// @Tags         mfa
+// @Produce      json
+// @Param Authorization header string true "Authorization"
+// @Success      200  {object}  models.TOTPSetupResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      409  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     BearerAuth
+// @Router       /me/mfa/totp [post]
+func (h *MFAHandler) Setup(c *gin.Context) {
+	setup, err := h.mfaService.BeginEnrollment(c.Request.Context(), c.GetUint("userID"))
+	if err != nil {
+		respondMFAError(c, err, "failed to start two-factor enrollment")
+		return
+	}
+
+	c.JSON(http.StatusOK, setup)
+}
+
+// @Summary      Confirm TOTP enrollment
+// @Description  Enable two-factor authentication with a code from the authenticator app. The response holds single-use recovery codes, shown only this once.
+// @Tags         mfa
+// @Accept       json
+// @Produce      json
+// @Param Authorization header string true "Authorization"
+// @Param        request body models.MFACodeRequest true "Authenticator code"
+// @Success      200  {object}  models.RecoveryCodesResponse
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      409  {object}  models.ErrorResponse
+// @Failure      429  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     BearerAuth
+// @Router       /me/mfa/totp/confirm [post]
+func (h *MFAHandler) Confirm(c *gin.Context) {
+	var req models.MFACodeRequest
+	if !h.bind(c, &req) {
+		return
+	}
+
+	codes, err := h.mfaService.ConfirmEnrollment(c.Request.Context(), c.GetUint("userID"), req.Code)
+	if err != nil {
+		respondMFAError(c, err, "failed to enable two-factor authentication")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// @Summary      Disable TOTP
+// @Description  Turn off two-factor authentication with a current authenticator code or a recovery code.
+// @Tags         mfa
+// @Accept       json
+// @Produce      json
+// @Param Authorization header string true "Authorization"
+// @Param        request body models.MFACodeRequest true "Authenticator or recovery code"
+// @Success      200  {object}  models.SuccessResponse
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      429  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     BearerAuth
+// @Router       /me/mfa/totp/disable [post]
+func (h *MFAHandler) Disable(c *gin.Context) {
+	var req models.MFACodeRequest
+	if !h.bind(c, &req) {
+		return
+	}
+
+	if err := h.mfaService.Disable(c.Request.Context(), c.GetUint("userID"), req.Code); err != nil {
+		respondMFAError(c, err, "failed to disable two-factor authentication")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{Message: "two-factor authentication disabled"})
+}
+
+func (h *MFAHandler) bind(c *gin.Context, req interface{}) bool {
+	if err := c.ShouldBindJSON(req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "invalid request body"})
+		return false
+	}
+	if err := h.validator.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return false
+	}
+	return true
+}
+
+func respondMFAError(c *gin.Context, err error, fallback string) {
+	if respondContextError(c, err) || respondRateLimited(c, err) {
+		return
+	}
+
+	switch {
+	case errors.Is(err, services.ErrInvalidMFACode),
+		errors.Is(err, services.ErrMFANotEnabled),
+		errors.Is(err, services.ErrMFANotEnrolled):
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+	case errors.Is(err, services.ErrMFAAlreadyEnabled):
+		c.JSON(http.StatusConflict, models.ErrorResponse{Error: err.Error()})
+	case errors.Is(err, services.ErrUserNotFound):
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: fallback})
+	}
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+
+	"github.com/tamabsndra/miniproject/miniproject-backend/models"
+	"github.com/tamabsndra/miniproject/miniproject-backend/services"
+)
+
+// oidcBindingCookie carries the secret tying a sign-in to the browser that
+// started it. It is scoped to the OIDC endpoints and lives as long as the
+// sign-in state.
+const (
+	oidcBindingCookie     = "oidc_binding"
+	oidcBindingCookiePath = "/api/auth/oidc"
+)
+
+type OIDCHandler struct {
+	oidcService *services.OIDCService
+	validator   *validator.Validate
+}
+
+func NewOIDCHandler(oidcService *services.OIDCService) *OIDCHandler {
+	return &OIDCHandler{
+		oidcService: oidcService,
+		validator:   validator.New(),
+	}
+}
+
+// @Summary      Start external sign-in
+// @Description  Begin an OpenID Connect sign-in with a configured provider. Send the browser to the returned URL; the provider redirects back to the frontend with a code and state for the callback endpoint. The response sets an HttpOnly oidc_binding cookie that the callback requires, so both requests must come from the same browser, and a front end on another origin must make them with credentials included (fetch's credentials: "include") from an origin listed in CORS_ALLOWED_ORIGINS.
+// @Tags         auth
+// @Produce      json
+// @Param        provider path string true "Provider name"
+// @Success      200  {object}  models.OIDCStartResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      502  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /auth/oidc/{provider}/start [post]
+func (h *OIDCHandler) Start(c *gin.Context) {
+	authURL, binding, err := h.oidcService.Start(c.Request.Context(), c.Param("provider"))
+	if err != nil {
+		respondOIDCError(c, err, "failed to start sign-in")
+		return
+	}
+
+	setOIDCBindingCookie(c, binding, int(h.oidcService.StateTTL().Seconds()))
+	c.JSON(http.StatusOK, models.OIDCStartResponse{AuthorizationURL: authURL})
+}
+
+// @Summary      Complete external sign-in
+// @Description  Exchange the code and state from the provider's redirect for a token pair, or an mfa_token when two-factor authentication is enabled. The oidc_binding cookie set by the start endpoint must be sent along (fetch's credentials: "include" from another origin); without it the state is rejected. The first sign-in links the identity to the account with the same email when both the provider and the account have verified it, or creates an account.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        provider path string true "Provider name"
+// @Param        request body models.OIDCCallbackRequest true "Code and state"
+// @Success      200  {object}  models.LoginResponse
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      403  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      409  {object}  models.ErrorResponse
+// @Failure      502  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /auth/oidc/{provider}/callback [post]
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	var req models.OIDCCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "invalid request body"})
+		return
+	}
+	if err := h.validator.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// A missing cookie leaves binding empty, which the service rejects.
+	binding, _ := c.Cookie(oidcBindingCookie)
+	setOIDCBindingCookie(c, "", -1)
+
+	response, err := h.oidcService.Callback(c.Request.Context(), c.Param("provider"), req, binding, clientInfo(c))
+	if err != nil {
+		respondOIDCError(c, err, "failed to sign in")
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// setOIDCBindingCookie sets the binding cookie, or clears it when maxAge is
+// negative. It is marked Secure when the request came over HTTPS.
+func setOIDCBindingCookie(c *gin.Context, value string, maxAge int) {
+	secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcBindingCookie, value, maxAge, oidcBindingCookiePath, "", secure, true)
+}
+
+func respondOIDCError(c *gin.Context, err error, fallback string) {
+	if respondContextError(c, err) {
+		return
+	}
+
+	switch {
+	case errors.Is(err, services.ErrUnknownOIDCProvider):
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: err.Error()})
+	case errors.Is(err, services.ErrInvalidOIDCState),
+		errors.Is(err, services.ErrOIDCEmailRequired):
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+	case errors.Is(err, services.ErrOIDCEmailNotVerified):
+		c.JSON(http.StatusConflict, models.ErrorResponse{Error: err.Error()})
+	case errors.Is(err, services.ErrEmailNotVerified):
+		c.JSON(http.StatusForbidden, models.ErrorResponse{Error: err.Error()})
+	case errors.Is(err, services.ErrOIDCProvider):
+		c.JSON(http.StatusBadGateway, models.ErrorResponse{Error: "sign-in provider rejected the request"})
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: fallback})
+	}
+}
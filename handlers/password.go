@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+
+	"github.com/tamabsndra/miniproject/miniproject-backend/models"
+	"github.com/tamabsndra/miniproject/miniproject-backend/services"
+)
+
+type PasswordHandler struct {
+	passwordResetService *services.PasswordResetService
+	validator            *validator.Validate
+}
+
+func NewPasswordHandler(passwordResetService *services.PasswordResetService) *PasswordHandler {
+	return &PasswordHandler{
+		passwordResetService: passwordResetService,
+		validator:            validator.New(),
+	}
+}
+
+// @Summary      Forgot password
+// @Description  Email a single-use password reset link, at most once per cooldown for each account. The response is the same whether or not the account exists. Each IP is limited to a few requests a minute.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        request body models.ForgotPasswordRequest true "Account email"
+// @Success      200  {object}  models.SuccessResponse
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      429  {object}  models.ErrorResponse
+// @Router       /password/forgot [post]
+func (h *PasswordHandler) Forgot(c *gin.Context) {
+	var req models.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	h.passwordResetService.RequestReset(c.Request.Context(), req.Email)
+
+	c.JSON(http.StatusOK, models.SuccessResponse{Message: "if the account exists, a reset link has been sent"})
+}
+
+// @Summary      Reset password
+// @Description  Set a new password using a reset token. The password must pass the password policy; a rejected password leaves the token usable. Every existing session of the account is revoked.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        request body models.ResetPasswordRequest true "Reset token and new password"
+// @Success      200  {object}  models.SuccessResponse
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /password/reset [post]
+func (h *PasswordHandler) Reset(c *gin.Context) {
+	var req models.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := h.passwordResetService.ResetPassword(c.Request.Context(), req); err != nil {
+		if respondContextError(c, err) || respondPasswordPolicy(c, err) {
+			return
+		}
+		if errors.Is(err, services.ErrInvalidResetToken) {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "failed to reset password"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{Message: "password has been reset"})
+}
@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
 
@@ -9,6 +11,7 @@ import (
 
 	"github.com/tamabsndra/miniproject/miniproject-backend/models"
 	"github.com/tamabsndra/miniproject/miniproject-backend/services"
+	"github.com/tamabsndra/miniproject/miniproject-backend/utils"
 )
 
 type PostHandler struct {
@@ -24,7 +27,7 @@ func NewPostHandler(postService *services.PostService) *PostHandler {
 }
 
 // @Summary      Create post
-// @Description  Create a new post
+// @Description  Create a new post. It is saved as a draft unless status is published, or scheduled with a publish_at time.
 // @Tags         posts
 // @Accept       json
 // @Produce      json
@@ -49,9 +52,9 @@ func (h *PostHandler) Create(c *gin.Context) {
 	}
 
 	userID := c.GetUint("userID")
-	post, err := h.postService.Create(userID, req)
+	post, err := h.postService.Create(c.Request.Context(), userID, req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
+		respondPostError(c, err)
 		return
 	}
 
@@ -59,27 +62,67 @@ func (h *PostHandler) Create(c *gin.Context) {
 }
 
 // @Summary      Get all posts
-// @Description  Get all posts
+// @Description  Get published posts and the caller's own posts in any status, paginated by limit/offset or cursor
 // @Tags         posts
 // @Produce      json
 // @Param Authorization header string true "Authorization"
-// @Success      200  {array}   models.Post
+// @Param        query query models.PostListQuery false "Pagination, sorting and filters"
+// @Success      200  {object}  models.PostPage
+// @Failure      400  {object}  models.ErrorResponse
 // @Failure      401  {object}  models.ErrorResponse
 // @Failure      500  {object}  models.ErrorResponse
 // @Security     BearerAuth
 // @Router       /posts [get]
 func (h *PostHandler) GetAll(c *gin.Context) {
-	posts, err := h.postService.GetAll()
+	query, ok := h.bindListQuery(c)
+	if !ok {
+		return
+	}
+
+	posts, err := h.postService.GetAll(c.Request.Context(), c.GetUint("userID"), query)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
+		respondPostError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, posts)
 }
 
+// @Summary      Search posts
+// @Description  Full-text search over the titles and content of published posts and the caller's own posts. The default mode accepts web search syntax ("quoted phrases", OR, -exclude); mode=phrase matches the words in order and mode=prefix matches word prefixes.
+// @Tags         posts
+// @Produce      json
+// @Param Authorization header string true "Authorization"
+// @Param        query query models.PostSearchQuery true "Search query"
+// @Success      200  {object}  models.PostSearchPage
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     BearerAuth
+// @Router       /posts/search [get]
+func (h *PostHandler) Search(c *gin.Context) {
+	var query models.PostSearchQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "invalid query parameters"})
+		return
+	}
+
+	if err := h.validator.Struct(query); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	results, err := h.postService.Search(c.Request.Context(), c.GetUint("userID"), query)
+	if err != nil {
+		respondPostError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, results)
+}
+
 // @Summary      Get post by ID
-// @Description  Get a post by its ID
+// @Description  Get a post by its ID. Unpublished posts are only found by their author.
 // @Tags         posts
 // @Produce      json
 // @Param Authorization header string true "Authorization"
@@ -97,9 +140,9 @@ func (h *PostHandler) GetByID(c *gin.Context) {
 		return
 	}
 
-	post, err := h.postService.GetByID(uint(id))
+	post, err := h.postService.GetByID(c.Request.Context(), c.GetUint("userID"), uint(id))
 	if err != nil {
-		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "post not found"})
+		respondPostError(c, err)
 		return
 	}
 
@@ -111,16 +154,23 @@ func (h *PostHandler) GetByID(c *gin.Context) {
 // @Tags         posts
 // @Produce      json
 // @Param Authorization header string true "Authorization"
-// @Success      200  {array}   models.Post
+// @Param        query query models.PostListQuery false "Pagination, sorting and filters"
+// @Success      200  {object}  models.PostPage
+// @Failure      400  {object}  models.ErrorResponse
 // @Failure      401  {object}  models.ErrorResponse
 // @Failure      500  {object}  models.ErrorResponse
 // @Security     BearerAuth
 // @Router       /posts/user [get]
 func (h *PostHandler) GetByUserID(c *gin.Context) {
+	query, ok := h.bindListQuery(c)
+	if !ok {
+		return
+	}
+
 	userID := c.GetUint("userID")
-	posts, err := h.postService.GetByUserID(userID)
+	posts, err := h.postService.GetByUserID(c.Request.Context(), userID, query)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
+		respondPostError(c, err)
 		return
 	}
 
@@ -138,7 +188,9 @@ func (h *PostHandler) GetByUserID(c *gin.Context) {
 // @Success      200  {object}  models.Post
 // @Failure      400  {object}  models.ErrorResponse
 // @Failure      401  {object}  models.ErrorResponse
+// @Failure      403  {object}  models.ErrorResponse
 // @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
 // @Security     BearerAuth
 // @Router       /posts/{id} [put]
 func (h *PostHandler) Update(c *gin.Context) {
@@ -159,9 +211,10 @@ func (h *PostHandler) Update(c *gin.Context) {
 		return
 	}
 
-	post, err := h.postService.Update(uint(id), req)
+	userID := c.GetUint("userID")
+	post, err := h.postService.Update(c.Request.Context(), userID, uint(id), req)
 	if err != nil {
-		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "post not found"})
+		respondPostError(c, err)
 		return
 	}
 
@@ -169,14 +222,17 @@ func (h *PostHandler) Update(c *gin.Context) {
 }
 
 // @Summary      Delete post
-// @Description  Delete a post by its ID
+// @Description  Move one of your posts to the trash. It can be restored until it is purged.
 // @Tags         posts
 // @Produce      json
 // @Param Authorization header string true "Authorization"
 // @Param        id   path      int  true  "Post ID"
 // @Success      200  {object}  models.SuccessResponse
+// @Failure      400  {object}  models.ErrorResponse
 // @Failure      401  {object}  models.ErrorResponse
+// @Failure      403  {object}  models.ErrorResponse
 // @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
 // @Security     BearerAuth
 // @Router       /posts/{id} [delete]
 func (h *PostHandler) Delete(c *gin.Context) {
@@ -186,21 +242,365 @@ func (h *PostHandler) Delete(c *gin.Context) {
 		return
 	}
 
-	if err := h.postService.Delete(uint(id)); err != nil {
-		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "post not found"})
+	userID := c.GetUint("userID")
+	if err := h.postService.Delete(c.Request.Context(), userID, uint(id)); err != nil {
+		respondPostError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, models.SuccessResponse{Message: "post deleted successfully"})
 }
 
+// @Summary      Publish post
+// @Description  Publish one of your posts now, or schedule it by passing a future publish_at. The body is optional.
+// @Tags         posts
+// @Accept       json
+// @Produce      json
+// @Param Authorization header string true "Authorization"
+// @Param        id   path      int  true  "Post ID"
+// @Param        request body models.PublishPostRequest false "When to publish"
+// @Success      200  {object}  models.Post
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      403  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     BearerAuth
+// @Router       /posts/{id}/publish [post]
+func (h *PostHandler) Publish(c *gin.Context) {
+	var req models.PublishPostRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "invalid post id"})
+		return
+	}
+
+	post, err := h.postService.Publish(c.Request.Context(), c.GetUint("userID"), uint(id), req)
+	if err != nil {
+		respondPostError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, post)
+}
+
+// @Summary      Unpublish post
+// @Description  Turn one of your published, scheduled or archived posts back into a draft
+// @Tags         posts
+// @Produce      json
+// @Param Authorization header string true "Authorization"
+// @Param        id   path      int  true  "Post ID"
+// @Success      200  {object}  models.Post
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      403  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     BearerAuth
+// @Router       /posts/{id}/unpublish [post]
+func (h *PostHandler) Unpublish(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "invalid post id"})
+		return
+	}
+
+	post, err := h.postService.Unpublish(c.Request.Context(), c.GetUint("userID"), uint(id))
+	if err != nil {
+		respondPostError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, post)
+}
+
+// @Summary      Archive post
+// @Description  Archive one of your posts, hiding it from everyone else
+// @Tags         posts
+// @Produce      json
+// @Param Authorization header string true "Authorization"
+// @Param        id   path      int  true  "Post ID"
+// @Success      200  {object}  models.Post
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      403  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     BearerAuth
+// @Router       /posts/{id}/archive [post]
+func (h *PostHandler) Archive(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "invalid post id"})
+		return
+	}
+
+	post, err := h.postService.Archive(c.Request.Context(), c.GetUint("userID"), uint(id))
+	if err != nil {
+		respondPostError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, post)
+}
+
+// @Summary      List trashed posts
+// @Description  List your deleted posts that have not been purged yet
+// @Tags         posts
+// @Produce      json
+// @Param Authorization header string true "Authorization"
+// @Param        query query models.PostListQuery false "Pagination, sorting and filters"
+// @Success      200  {object}  models.PostPage
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     BearerAuth
+// @Router       /posts/trash [get]
+func (h *PostHandler) Trash(c *gin.Context) {
+	query, ok := h.bindListQuery(c)
+	if !ok {
+		return
+	}
+
+	posts, err := h.postService.Trash(c.Request.Context(), c.GetUint("userID"), query)
+	if err != nil {
+		respondPostError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, posts)
+}
+
+// @Summary      Restore post
+// @Description  Take one of your posts back out of the trash. Posts removed by a moderator cannot be restored.
+// @Tags         posts
+// @Produce      json
+// @Param Authorization header string true "Authorization"
+// @Param        id   path      int  true  "Post ID"
+// @Success      200  {object}  models.Post
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      403  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     BearerAuth
+// @Router       /posts/{id}/restore [post]
+func (h *PostHandler) Restore(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "invalid post id"})
+		return
+	}
+
+	post, err := h.postService.Restore(c.Request.Context(), c.GetUint("userID"), uint(id))
+	if err != nil {
+		respondPostError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, post)
+}
+
+// @Summary      Purge post
+// @Description  Permanently delete one of your posts from the trash, with its revisions
+// @Tags         posts
+// @Produce      json
+// @Param Authorization header string true "Authorization"
+// @Param        id   path      int  true  "Post ID"
+// @Success      200  {object}  models.SuccessResponse
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      403  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     BearerAuth
+// @Router       /posts/{id}/purge [delete]
+func (h *PostHandler) Purge(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "invalid post id"})
+		return
+	}
+
+	if err := h.postService.Purge(c.Request.Context(), c.GetUint("userID"), uint(id)); err != nil {
+		respondPostError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{Message: "post purged successfully"})
+}
+
+// @Summary      List post revisions
+// @Description  List the saved revisions of one of your posts, newest first
+// @Tags         posts
+// @Produce      json
+// @Param Authorization header string true "Authorization"
+// @Param        id   path      int  true  "Post ID"
+// @Success      200  {array}   models.PostRevision
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      403  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     BearerAuth
+// @Router       /posts/{id}/revisions [get]
+func (h *PostHandler) Revisions(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "invalid post id"})
+		return
+	}
+
+	revisions, err := h.postService.Revisions(c.Request.Context(), c.GetUint("userID"), uint(id))
+	if err != nil {
+		respondPostError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, revisions)
+}
+
+// @Summary      Diff post revisions
+// @Description  Compare two revisions of one of your posts word by word, with a unified line diff of the content
+// @Tags         posts
+// @Produce      json
+// @Param Authorization header string true "Authorization"
+// @Param        id   path      int  true  "Post ID"
+// @Param        query query models.PostRevisionDiffQuery true "Revisions to compare"
+// @Success      200  {object}  models.PostRevisionDiff
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      403  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     BearerAuth
+// @Router       /posts/{id}/revisions/diff [get]
+func (h *PostHandler) DiffRevisions(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "invalid post id"})
+		return
+	}
+
+	var query models.PostRevisionDiffQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "invalid query parameters"})
+		return
+	}
+	if err := h.validator.Struct(query); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	diff, err := h.postService.DiffRevisions(c.Request.Context(), c.GetUint("userID"), uint(id), query)
+	if err != nil {
+		respondPostError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, diff)
+}
+
+// @Summary      Restore post revision
+// @Description  Set one of your posts back to an earlier revision's title and content, saved as a new revision
+// @Tags         posts
+// @Produce      json
+// @Param Authorization header string true "Authorization"
+// @Param        id        path      int  true  "Post ID"
+// @Param        revision  path      int  true  "Revision number"
+// @Success      200  {object}  models.Post
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      403  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     BearerAuth
+// @Router       /posts/{id}/revisions/{revision}/restore [post]
+func (h *PostHandler) RestoreRevision(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "invalid post id"})
+		return
+	}
+
+	revision, err := strconv.Atoi(c.Param("revision"))
+	if err != nil || revision < 1 {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "invalid revision"})
+		return
+	}
+
+	post, err := h.postService.RestoreRevision(c.Request.Context(), c.GetUint("userID"), uint(id), revision)
+	if err != nil {
+		respondPostError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, post)
+}
+
+// @Summary      Get posts with authors
+// @Description  Get published posts and the caller's own posts together with their author's public data
+// @Tags         posts
+// @Produce      json
+// @Param Authorization header string true "Authorization"
+// @Param        query query models.PostListQuery false "Pagination, sorting and filters"
+// @Success      200  {object}  models.PostWithUserPage
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     BearerAuth
+// @Router       /post-detail [get]
 func (h *PostHandler) GetPostDetail(c *gin.Context) {
+	query, ok := h.bindListQuery(c)
+	if !ok {
+		return
+	}
+
 	// get post with user data
-	posts, err := h.postService.GetPostDetail()
+	posts, err := h.postService.GetPostDetail(c.Request.Context(), c.GetUint("userID"), query)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
+		respondPostError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, posts)
 }
+
+// bindListQuery parses listing query parameters, writing a 400 response and
+// returning false if they are invalid.
+func (h *PostHandler) bindListQuery(c *gin.Context) (models.PostListQuery, bool) {
+	var query models.PostListQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "invalid query parameters"})
+		return query, false
+	}
+
+	if err := h.validator.Struct(query); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return query, false
+	}
+
+	return query, true
+}
+
+func respondPostError(c *gin.Context, err error) {
+	if respondContextError(c, err) {
+		return
+	}
+
+	switch {
+	case errors.Is(err, utils.ErrInvalidCursor):
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+	case errors.Is(err, services.ErrPostNotFound), errors.Is(err, services.ErrRevisionNotFound):
+		c.JSON(http.StatusNotFound, models.ErrorResponse{Error: err.Error()})
+	case errors.Is(err, services.ErrPostForbidden), errors.Is(err, services.ErrPostRemoved):
+		c.JSON(http.StatusForbidden, models.ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: err.Error()})
+	}
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tamabsndra/miniproject/miniproject-backend/models"
+	"github.com/tamabsndra/miniproject/miniproject-backend/services"
+)
+
+type SessionHandler struct {
+	tokenService *services.TokenService
+}
+
+func NewSessionHandler(tokenService *services.TokenService) *SessionHandler {
+	return &SessionHandler{tokenService: tokenService}
+}
+
+// @Summary      List sessions
+// @Description  List the devices currently signed in to the account, most recently used first. The session the request was made from is flagged as current.
+// @Tags         sessions
+// @Produce      json
+// @Param Authorization header string true "Authorization"
+// @Success      200  {array}   models.Session
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     BearerAuth
+// @Router       /sessions [get]
+func (h *SessionHandler) List(c *gin.Context) {
+	sessions, err := h.tokenService.ListSessions(c.Request.Context(), c.GetUint("userID"), c.GetString("familyID"))
+	if err != nil {
+		if respondContextError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "failed to list sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// @Summary      Revoke session
+// @Description  Sign out one session. Its access and refresh tokens stop working immediately.
+// @Tags         sessions
+// @Produce      json
+// @Param Authorization header string true "Authorization"
+// @Param        id   path      string  true  "Session ID"
+// @Success      200  {object}  models.SuccessResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     BearerAuth
+// @Router       /sessions/{id} [delete]
+func (h *SessionHandler) Revoke(c *gin.Context) {
+	err := h.tokenService.RevokeSession(c.Request.Context(), c.GetUint("userID"), c.Param("id"))
+	if err != nil {
+		if respondContextError(c, err) {
+			return
+		}
+		if errors.Is(err, services.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "failed to revoke session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{Message: "session revoked"})
+}
+
+// @Summary      Logout everywhere
+// @Description  Revoke every session of the current user, including this one.
+// @Tags         sessions
+// @Produce      json
+// @Param Authorization header string true "Authorization"
+// @Success      200  {object}  models.SuccessResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     BearerAuth
+// @Router       /logout-all [post]
+func (h *SessionHandler) LogoutAll(c *gin.Context) {
+	if err := h.tokenService.RevokeAllUserTokens(c.Request.Context(), c.GetUint("userID")); err != nil {
+		if respondContextError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "failed to logout"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{Message: "logged out of all sessions"})
+}
+
+// clientInfo describes the client making the request for the session
+// registry.
+func clientInfo(c *gin.Context) models.ClientInfo {
+	return models.ClientInfo{
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+}
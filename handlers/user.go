@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+
+	"github.com/tamabsndra/miniproject/miniproject-backend/models"
+	"github.com/tamabsndra/miniproject/miniproject-backend/services"
+)
+
+type UserHandler struct {
+	userService *services.UserService
+	validator   *validator.Validate
+}
+
+func NewUserHandler(userService *services.UserService) *UserHandler {
+	return &UserHandler{
+		userService: userService,
+		validator:   validator.New(),
+	}
+}
+
+// @Summary      GetMe
+// @Description  Get current user
+// @Tags         users
+// @Produce      json
+// @Param Authorization header string true "Authorization"
+// @Success      200  {object}  models.User
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     BearerAuth
+// @Router       /me [get]
+func (h *UserHandler) GetMe(c *gin.Context) {
+	user, err := h.userService.GetByID(c.Request.Context(), c.GetUint("userID"))
+	if err != nil {
+		respondUserError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// @Summary      Update profile
+// @Description  Update the current user's profile. Only the fields present in the body change; optional fields accept an empty string to clear them.
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param Authorization header string true "Authorization"
+// @Param        request body models.UpdateProfileRequest true "Profile fields"
+// @Success      200  {object}  models.User
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      401  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Security     BearerAuth
+// @Router       /me [patch]
+func (h *UserHandler) UpdateMe(c *gin.Context) {
+	var req models.UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	user, err := h.userService.UpdateProfile(c.Request.Context(), c.GetUint("userID"), req)
+	if err != nil {
+		respondUserError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// @Summary      Public profile
+// @Description  Get the public profile of a user
+// @Tags         users
+// @Produce      json
+// @Param        id   path      int  true  "User ID"
+// @Success      200  {object}  models.PublicProfile
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      404  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /users/{id} [get]
+func (h *UserHandler) GetProfile(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "invalid user id"})
+		return
+	}
+
+	profile, err := h.userService.GetPublicProfile(c.Request.Context(), uint(id))
+	if err != nil {
+		respondUserError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
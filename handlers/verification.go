@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+
+	"github.com/tamabsndra/miniproject/miniproject-backend/models"
+	"github.com/tamabsndra/miniproject/miniproject-backend/services"
+)
+
+type VerificationHandler struct {
+	verificationService *services.EmailVerificationService
+	validator           *validator.Validate
+}
+
+func NewVerificationHandler(verificationService *services.EmailVerificationService) *VerificationHandler {
+	return &VerificationHandler{
+		verificationService: verificationService,
+		validator:           validator.New(),
+	}
+}
+
+// @Summary      Verify email
+// @Description  Confirm an email address with the token from the verification email
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        request body models.VerifyEmailRequest true "Verification token"
+// @Success      200  {object}  models.SuccessResponse
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      429  {object}  models.ErrorResponse
+// @Failure      500  {object}  models.ErrorResponse
+// @Router       /verify-email [post]
+func (h *VerificationHandler) Verify(c *gin.Context) {
+	var req models.VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := h.verificationService.Verify(c.Request.Context(), req.Token); err != nil {
+		if respondContextError(c, err) {
+			return
+		}
+		if errors.Is(err, services.ErrInvalidVerificationToken) {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "failed to verify email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{Message: "email verified"})
+}
+
+// @Summary      Resend verification email
+// @Description  Send a new verification link to an unverified account, at most once per cooldown. The response is the same whether or not the account exists. Each IP is limited to a few requests a minute.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        request body models.ResendVerificationRequest true "Account email"
+// @Success      200  {object}  models.SuccessResponse
+// @Failure      400  {object}  models.ErrorResponse
+// @Failure      429  {object}  models.ErrorResponse
+// @Router       /verify-email/resend [post]
+func (h *VerificationHandler) Resend(c *gin.Context) {
+	var req models.ResendVerificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	h.verificationService.Resend(c.Request.Context(), req.Email)
+
+	c.JSON(http.StatusOK, models.SuccessResponse{Message: "if the account exists and is unverified, a verification link has been sent"})
+}
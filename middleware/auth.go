@@ -1,16 +1,20 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/tamabsndra/miniproject/miniproject-backend/services"
-	"github.com/tamabsndra/miniproject/miniproject-backend/utils"
 )
 
-func AuthMiddleware(jwtSecret string, tokenService *services.TokenService) gin.HandlerFunc {
+// AuthMiddleware authenticates "Bearer <jwt>" and "ApiKey <key>"
+// requests. API key requests carry the key's scopes, checked by
+// RequireScope.
+func AuthMiddleware(tokenService *services.TokenService, apiKeyService *services.APIKeyService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -20,6 +24,10 @@ func AuthMiddleware(jwtSecret string, tokenService *services.TokenService) gin.H
 		}
 
 		parts := strings.SplitN(authHeader, " ", 2)
+		if len(parts) == 2 && parts[0] == "ApiKey" {
+			authenticateAPIKey(c, apiKeyService, parts[1])
+			return
+		}
 		if !(len(parts) == 2 && parts[0] == "Bearer") {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid authorization header format"})
 			c.Abort()
@@ -28,22 +36,52 @@ func AuthMiddleware(jwtSecret string, tokenService *services.TokenService) gin.H
 
 		token := parts[1]
 
-		if tokenService.IsTokenBlacklisted(token) {
+		blacklisted, err := tokenService.IsTokenBlacklisted(c.Request.Context(), token)
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				c.JSON(http.StatusGatewayTimeout, gin.H{"error": "request timed out"})
+			} else {
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": "unable to verify token"})
+			}
+			c.Abort()
+			return
+		}
+
+		if blacklisted {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "token has been revoked"})
 			c.Abort()
 			return
 		}
 
-		claims, err := utils.ValidateToken(token, jwtSecret)
+		claims, err := tokenService.ParseAccessToken(token)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
 			c.Abort()
 			return
 		}
 
+		revoked, err := tokenService.IsTokenRevoked(c.Request.Context(), claims)
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				c.JSON(http.StatusGatewayTimeout, gin.H{"error": "request timed out"})
+			} else {
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": "unable to verify token"})
+			}
+			c.Abort()
+			return
+		}
+
+		if revoked {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "token has been revoked"})
+			c.Abort()
+			return
+		}
+
 		c.Set("userID", claims.UserID)
 		c.Set("email", claims.Email)
 		c.Set("token", token)
+		c.Set("familyID", claims.FamilyID)
+		c.Set("roles", claims.Roles)
 		c.Next()
 	}
 }
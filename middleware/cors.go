@@ -2,12 +2,23 @@ package middleware
 
 import "github.com/gin-gonic/gin"
 
-func CORS() gin.HandlerFunc {
+// CORS answers cross-origin requests from allowedOrigins, echoing the origin
+// back so browsers accept credentialed responses; they refuse a wildcard
+// origin when cookies are sent. Other origins get no CORS headers.
+func CORS(allowedOrigins []string) gin.HandlerFunc {
+    allowed := make(map[string]bool, len(allowedOrigins))
+    for _, origin := range allowedOrigins {
+        allowed[origin] = true
+    }
+
     return func(c *gin.Context) {
-        c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-        c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-        c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-        c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+        c.Writer.Header().Add("Vary", "Origin")
+        if origin := c.GetHeader("Origin"); allowed[origin] {
+            c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
+            c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
+            c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
+            c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE")
+        }
 
         if c.Request.Method == "OPTIONS" {
             c.AbortWithStatus(204)
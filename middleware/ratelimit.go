@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/ratelimit"
+)
+
+// RateLimit allows each client IP at most limit requests per window to the
+// routes it guards. name keeps the counters of different route groups apart.
+// The client IP comes from X-Forwarded-For only when the request arrives
+// through one of the engine's trusted proxies, so it cannot be spoofed.
+func RateLimit(limiter *ratelimit.Limiter, name string, limit int, window time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		err := limiter.Allow(c.Request.Context(), name+":"+c.ClientIP(), limit, window)
+		if err == nil {
+			c.Next()
+			return
+		}
+
+		var limited *ratelimit.LimitedError
+		switch {
+		case errors.As(err, &limited):
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(limited.RetryAfter.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		case errors.Is(err, context.DeadlineExceeded):
+			c.JSON(http.StatusGatewayTimeout, gin.H{"error": "request timed out"})
+		default:
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "unable to check rate limit"})
+		}
+		c.Abort()
+	}
+}
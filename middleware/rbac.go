@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tamabsndra/miniproject/miniproject-backend/services"
+)
+
+// RequirePermission allows the request only when the roles set by
+// AuthMiddleware grant every listed permission, so it must run after it.
+func RequirePermission(rbacService *services.RBACService, permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roles := c.GetStringSlice("roles")
+
+		allowed, err := rbacService.HasPermissions(c.Request.Context(), roles, permissions...)
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				c.JSON(http.StatusGatewayTimeout, gin.H{"error": "request timed out"})
+			} else {
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": "unable to verify permissions"})
+			}
+			c.Abort()
+			return
+		}
+
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
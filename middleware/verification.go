@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tamabsndra/miniproject/miniproject-backend/services"
+)
+
+// RequireVerifiedEmailToPost enforces the verification policy for creating
+// posts. It must run after AuthMiddleware.
+func RequireVerifiedEmailToPost(verificationService *services.EmailVerificationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		err := verificationService.CheckCanCreatePost(c.Request.Context(), c.GetUint("userID"))
+		switch {
+		case err == nil:
+			c.Next()
+			return
+		case errors.Is(err, services.ErrEmailNotVerified):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrUserNotFound):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		case errors.Is(err, context.DeadlineExceeded):
+			c.JSON(http.StatusGatewayTimeout, gin.H{"error": "request timed out"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "unable to verify account"})
+		}
+		c.Abort()
+	}
+}
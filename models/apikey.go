@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// Scopes limit what an API key can do. Requests made with a bearer token
+// are not limited by scope.
+const (
+	ScopePostsRead    = "posts:read"
+	ScopePostsWrite   = "posts:write"
+	ScopeProfileRead  = "profile:read"
+	ScopeProfileWrite = "profile:write"
+	// ScopeAdmin allows the admin endpoints, still subject to the owner's
+	// role permissions.
+	ScopeAdmin = "admin"
+)
+
+// APIKey is a personal access key. Only a hash of the key is stored.
+type APIKey struct {
+	ID         uint       `json:"id"`
+	UserID     uint       `json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	KeyHash    string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name" validate:"required,max=100"`
+	Scopes        []string `json:"scopes" validate:"required,min=1,dive,oneof=posts:read posts:write profile:read profile:write admin"`
+	ExpiresInDays int      `json:"expires_in_days" validate:"required,min=1,max=365"`
+}
+
+// CreateAPIKeyResponse carries the key itself, which is not shown again.
+type CreateAPIKeyResponse struct {
+	APIKey
+	Key string `json:"key"`
+}
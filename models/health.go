@@ -0,0 +1,18 @@
+package models
+
+const (
+	HealthStatusUp   = "up"
+	HealthStatusDown = "down"
+)
+
+type DependencyHealth struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type HealthReport struct {
+	Status       string                      `json:"status"`
+	ShuttingDown bool                        `json:"shutting_down,omitempty"`
+	Checks       map[string]DependencyHealth `json:"checks,omitempty"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// UserIdentity links an account at an external OpenID provider to a user.
+type UserIdentity struct {
+	ID        uint      `json:"id"`
+	UserID    uint      `json:"user_id"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type OIDCStartResponse struct {
+	AuthorizationURL string `json:"authorization_url"`
+}
+
+// OIDCCallbackRequest carries the code and state the provider appended to
+// the redirect URL.
+type OIDCCallbackRequest struct {
+	Code   string `json:"code" validate:"required,max=2048"`
+	State  string `json:"state" validate:"required,max=128"`
+	Device string `json:"device,omitempty" validate:"max=100"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// TOTPEnrollment is a user's authenticator app secret. It only protects
+// logins once EnabledAt is set by confirming a first code.
+type TOTPEnrollment struct {
+	UserID    uint
+	Secret    string
+	EnabledAt *time.Time
+	CreatedAt time.Time
+}
+
+type TOTPSetupResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+	// QRCode is a data:image/png;base64 URI of OTPAuthURI as a QR code.
+	QRCode string `json:"qr_code"`
+}
+
+// MFACodeRequest carries a six digit authenticator code or, where
+// accepted, a recovery code.
+type MFACodeRequest struct {
+	Code string `json:"code" validate:"required,max=32"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+	Code     string `json:"code" validate:"required,max=32"`
+	Device   string `json:"device,omitempty" validate:"max=100"`
+}
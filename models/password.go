@@ -0,0 +1,23 @@
+package models
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required"`
+	// KeepCurrentSession returns a fresh token pair so the caller stays
+	// signed in; every other session is revoked either way.
+	KeepCurrentSession bool `json:"keep_current_session"`
+}
+
+type ChangePasswordResponse struct {
+	Message string     `json:"message"`
+	Tokens  *TokenPair `json:"tokens,omitempty"`
+}
@@ -2,13 +2,32 @@ package models
 
 import "time"
 
+// Post statuses. Only published posts are visible to anyone but their
+// author; scheduled posts are published by the scheduler at PublishedAt.
+const (
+    PostStatusDraft     = "draft"
+    PostStatusScheduled = "scheduled"
+    PostStatusPublished = "published"
+    PostStatusArchived  = "archived"
+)
+
 type Post struct {
-    ID          uint      `json:"id"`
-    UserID      uint      `json:"user_id"`
-    Title       string    `json:"title" validate:"required,min=3,max=100"`
-    Content     string    `json:"content" validate:"required,min=10"`
-    CreatedAt   time.Time `json:"created_at"`
-    UpdatedAt   time.Time `json:"updated_at"`
+    ID          uint       `json:"id"`
+    UserID      uint       `json:"user_id"`
+    Title       string     `json:"title" validate:"required,min=3,max=100"`
+    Content     string     `json:"content" validate:"required,min=10"`
+    Status      string     `json:"status"`
+    // PublishedAt is when the post went live, or for a scheduled post
+    // when it will.
+    PublishedAt *time.Time `json:"published_at,omitempty"`
+    CreatedAt   time.Time  `json:"created_at"`
+    UpdatedAt   time.Time  `json:"updated_at"`
+    // DeletedAt is when the post was moved to the trash.
+    DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+
+    // RemovedByModerator is set on trashed posts a moderator took down;
+    // their author cannot restore them.
+    RemovedByModerator bool `json:"removed_by_moderator,omitempty"`
 }
 
 type PostWithUser struct {
@@ -16,12 +35,74 @@ type PostWithUser struct {
 	User UserInPost `json:"user"`
 }
 
+type PostPage struct {
+	Data       []Post   `json:"data"`
+	Pagination PageInfo `json:"pagination"`
+}
+
+type PostWithUserPage struct {
+	Data       []PostWithUser `json:"data"`
+	Pagination PageInfo       `json:"pagination"`
+}
+
+// CreatePostRequest creates a draft unless Status says otherwise. A
+// scheduled post needs PublishAt.
 type CreatePostRequest struct {
-    Title   string `json:"title" validate:"required,min=3,max=100"`
-    Content string `json:"content" validate:"required,min=10"`
+    Title     string     `json:"title" validate:"required,min=3,max=100"`
+    Content   string     `json:"content" validate:"required,min=10"`
+    Status    string     `json:"status" validate:"omitempty,oneof=draft scheduled published"`
+    PublishAt *time.Time `json:"publish_at" validate:"required_if=Status scheduled"`
 }
 
 type UpdatePostRequest struct {
 	Title   string `json:"title" validate:"required,min=3,max=100"`
 	Content string `json:"content" validate:"required,min=10"`
 }
+
+// PublishPostRequest publishes a post now, or schedules it when PublishAt is
+// in the future.
+type PublishPostRequest struct {
+	PublishAt *time.Time `json:"publish_at"`
+}
+
+type PostListQuery struct {
+	Limit       int        `form:"limit" validate:"omitempty,min=1,max=100"`
+	Offset      int        `form:"offset" validate:"omitempty,min=0"`
+	Cursor      string     `form:"cursor"`
+	SortBy      string     `form:"sort_by" validate:"omitempty,oneof=created_at updated_at title id"`
+	Order       string     `form:"order" validate:"omitempty,oneof=asc desc"`
+	AuthorID    uint       `form:"author_id"`
+	Title       string     `form:"title" validate:"omitempty,max=100"`
+	CreatedFrom *time.Time `form:"created_from" time_format:"2006-01-02T15:04:05Z07:00"`
+	CreatedTo   *time.Time `form:"created_to" time_format:"2006-01-02T15:04:05Z07:00"`
+	UpdatedFrom *time.Time `form:"updated_from" time_format:"2006-01-02T15:04:05Z07:00"`
+	UpdatedTo   *time.Time `form:"updated_to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Status      string     `form:"status" validate:"omitempty,oneof=draft scheduled published archived"`
+	// ViewerID limits the listing to published posts and the viewer's
+	// own. It is set from the authenticated user, never from the query.
+	ViewerID uint `form:"-" swaggerignore:"true"`
+	// Trashed lists deleted posts instead of live ones. It is set by the
+	// trash endpoint, never from the query.
+	Trashed bool `form:"-" swaggerignore:"true"`
+}
+
+type PostSearchQuery struct {
+	Q      string `form:"q" validate:"required,max=200"`
+	Mode   string `form:"mode" validate:"omitempty,oneof=websearch plain phrase prefix"`
+	Limit  int    `form:"limit" validate:"omitempty,min=1,max=100"`
+	Offset int    `form:"offset" validate:"omitempty,min=0"`
+	// ViewerID limits results as in PostListQuery.
+	ViewerID uint `form:"-" swaggerignore:"true"`
+}
+
+type PostSearchResult struct {
+	Post
+	Rank           float64 `json:"rank"`
+	TitleHighlight string  `json:"title_highlight"`
+	Snippet        string  `json:"snippet"`
+}
+
+type PostSearchPage struct {
+	Data       []PostSearchResult `json:"data"`
+	Pagination PageInfo           `json:"pagination"`
+}
@@ -4,6 +4,10 @@ type SuccessResponse struct {
     Message string `json:"message"`
 }
 
+// ErrorResponse describes a failed request. Details lists the individual
+// problems when there are several, such as every password policy rule a
+// new password broke.
 type ErrorResponse struct {
-    Error string `json:"error"`
+    Error   string   `json:"error"`
+    Details []string `json:"details,omitempty"`
 }
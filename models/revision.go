@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// PostRevision is one saved version of a post's title and content.
+// Revisions are numbered per post from 1; the newest matches the post.
+type PostRevision struct {
+	PostID   uint `json:"post_id"`
+	Revision int  `json:"revision"`
+	// EditorID is the author or moderator who saved the revision, or nil
+	// once their account is deleted.
+	EditorID  *uint     `json:"editor_id"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type PostRevisionDiffQuery struct {
+	From int `form:"from" validate:"required,min=1"`
+	To   int `form:"to" validate:"required,min=1"`
+}
+
+// DiffSegment is a run of text both revisions share ("equal"), or that only
+// the newer ("insert") or the older ("delete") revision has.
+type DiffSegment struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+type PostRevisionDiff struct {
+	PostID uint `json:"post_id"`
+	From   int  `json:"from"`
+	To     int  `json:"to"`
+	// Title and Content are word-level diffs.
+	Title   []DiffSegment `json:"title"`
+	Content []DiffSegment `json:"content"`
+	// Unified is a line-level diff of the content in unified format; empty
+	// when the content is unchanged.
+	Unified string `json:"unified"`
+}
@@ -0,0 +1,31 @@
+package models
+
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// Permissions are granted to roles in the role_permissions table; these
+// constants name the ones the API checks.
+const (
+	PermissionPostsModerate    = "posts:moderate"
+	PermissionUsersRead        = "users:read"
+	PermissionUsersManageRoles = "users:manage_roles"
+	PermissionUsersUnlock      = "users:unlock"
+)
+
+type UserListQuery struct {
+	Limit  int    `form:"limit" validate:"omitempty,min=1,max=100"`
+	Offset int    `form:"offset" validate:"omitempty,min=0"`
+	Role   string `form:"role" validate:"omitempty,oneof=user moderator admin"`
+}
+
+type UserPage struct {
+	Data       []User   `json:"data"`
+	Pagination PageInfo `json:"pagination"`
+}
+
+type UpdateUserRolesRequest struct {
+	Roles []string `json:"roles" validate:"required,min=1,dive,oneof=user moderator admin"`
+}
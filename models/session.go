@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// ClientInfo describes the client a session was opened from.
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+	Device    string
+}
+
+// Session is one signed-in device: a refresh token family plus the client
+// that opened it. Its ID is the family ID carried by the session's tokens.
+type Session struct {
+	ID         string    `json:"id"`
+	Device     string    `json:"device"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	IssuedAt   time.Time `json:"issued_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	Current    bool      `json:"current"`
+}
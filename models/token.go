@@ -7,6 +7,7 @@ import (
 type TokenMetadata struct {
     UserID    uint      `json:"user_id"`
     Email     string    `json:"email"`
+    Roles     []string  `json:"roles,omitempty"`
     IssuedAt  time.Time `json:"issued_at"`
     ExpiresAt time.Time `json:"expires_at"`
 }
@@ -28,3 +29,13 @@ type TokenValidationResponse struct {
 type ValidateTokenRequest struct {
     Token string `json:"token" validate:"required"`
 }
+
+type TokenPair struct {
+    Token        string `json:"token"`
+    RefreshToken string `json:"refresh_token"`
+    ExpiresIn    int64  `json:"expires_in"`
+}
+
+type RefreshTokenRequest struct {
+    RefreshToken string `json:"refresh_token" validate:"required"`
+}
@@ -3,12 +3,40 @@ package models
 import "time"
 
 type User struct {
-    ID        uint      `json:"id"`
-    Email     string    `json:"email" validate:"required,email"`
-    Password  string    `json:"password,omitempty" validate:"required,min=6"`
-    Name      string    `json:"name" validate:"required"`
-    CreatedAt time.Time `json:"created_at"`
-    UpdatedAt time.Time `json:"updated_at"`
+    ID              uint       `json:"id"`
+    Email           string     `json:"email" validate:"required,email"`
+    Password        string     `json:"password,omitempty" validate:"required"`
+    Name            string     `json:"name" validate:"required"`
+    Bio             string     `json:"bio"`
+    AvatarURL       string     `json:"avatar_url"`
+    Location        string     `json:"location"`
+    Website         string     `json:"website"`
+    Roles           []string   `json:"roles,omitempty"`
+    EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+    CreatedAt       time.Time  `json:"created_at"`
+    UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// PublicProfile is the part of a user anyone may see; it deliberately has
+// no email or password fields.
+type PublicProfile struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	Bio       string    `json:"bio"`
+	AvatarURL string    `json:"avatar_url"`
+	Location  string    `json:"location"`
+	Website   string    `json:"website"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UpdateProfileRequest changes only the fields that are present. Optional
+// fields accept an empty string to clear them.
+type UpdateProfileRequest struct {
+	Name      *string `json:"name" validate:"omitnil,min=1,max=255"`
+	Bio       *string `json:"bio" validate:"omitnil,max=500"`
+	AvatarURL *string `json:"avatar_url" validate:"omitnil,max=2048,len=0|http_url"`
+	Location  *string `json:"location" validate:"omitnil,max=100"`
+	Website   *string `json:"website" validate:"omitnil,max=2048,len=0|http_url"`
 }
 
 type UserInPost struct {
@@ -20,19 +48,35 @@ type UserInPost struct {
 type LoginRequest struct {
     Email    string `json:"email" validate:"required,email"`
     Password string `json:"password" validate:"required"`
+    // Device optionally names the client in the session list; when empty
+    // it is derived from the User-Agent header.
+    Device   string `json:"device,omitempty" validate:"max=100"`
 }
 
+// LoginResponse carries the tokens and user on success. When the account
+// has two-factor authentication enabled the tokens and user are omitted and
+// MFAToken must be exchanged at /login/mfa together with a code.
 type LoginResponse struct {
-    Token string `json:"token"`
-    User  User   `json:"user"`
+    *TokenPair
+    User        *User  `json:"user,omitempty"`
+    MFARequired bool   `json:"mfa_required,omitempty"`
+    MFAToken    string `json:"mfa_token,omitempty"`
 }
 
 type RegisterRequest struct {
 	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required,min=6"`
+	Password string `json:"password" validate:"required"`
 	Name     string `json:"name" validate:"required"`
 }
 
+type ResendVerificationRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
 type RegisterResponse struct {
 	Token string `json:"token"`
 	User  User   `json:"user"`
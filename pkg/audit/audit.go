@@ -0,0 +1,86 @@
+// Package audit records security-relevant events such as account lockouts.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+// Event types.
+const (
+	LoginLocked   = "login.locked"
+	LoginUnlocked = "login.unlocked"
+)
+
+type Event struct {
+	Type string    `json:"type"`
+	At   time.Time `json:"at"`
+	// ActorID is the user who caused the event, if it was not the subject.
+	ActorID uint   `json:"actor_id,omitempty"`
+	UserID  uint   `json:"user_id,omitempty"`
+	Email   string `json:"email,omitempty"`
+	IP      string `json:"ip,omitempty"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+// Recorder stores audit events. Recording must not fail the operation being
+// audited, so implementations handle their own errors.
+type Recorder interface {
+	Record(ctx context.Context, event Event)
+}
+
+// LogRecorder writes events to w as JSON lines.
+type LogRecorder struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewLogRecorder(w io.Writer) *LogRecorder {
+	return &LogRecorder{w: w}
+}
+
+func (r *LogRecorder) Record(ctx context.Context, event Event) {
+	if event.At.IsZero() {
+		event.At = time.Now()
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("audit: encode %s event: %v", event.Type, err)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := r.w.Write(append(data, '\n')); err != nil {
+		log.Printf("audit: write %s event: %v", event.Type, err)
+	}
+}
+
+// MemoryRecorder keeps events in memory, for tests.
+type MemoryRecorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (r *MemoryRecorder) Record(ctx context.Context, event Event) {
+	if event.At.IsZero() {
+		event.At = time.Now()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+// Events returns the events recorded so far.
+func (r *MemoryRecorder) Events() []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Event(nil), r.events...)
+}
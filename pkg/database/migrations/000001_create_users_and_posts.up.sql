@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS users (
+    id         BIGSERIAL PRIMARY KEY,
+    email      VARCHAR(255) NOT NULL,
+    password   VARCHAR(255) NOT NULL,
+    name       VARCHAR(255) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users (email);
+
+CREATE TABLE IF NOT EXISTS posts (
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    title      VARCHAR(100) NOT NULL,
+    content    TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Listing indexes match the keyset ordering used by PostRepository:
+-- (sort column, id) scanned in either direction.
+CREATE INDEX IF NOT EXISTS idx_posts_created_at ON posts (created_at, id);
+CREATE INDEX IF NOT EXISTS idx_posts_updated_at ON posts (updated_at, id);
+CREATE INDEX IF NOT EXISTS idx_posts_user_id_created_at ON posts (user_id, created_at, id);
@@ -0,0 +1,47 @@
+CREATE TABLE IF NOT EXISTS roles (
+    name        VARCHAR(32) PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS permissions (
+    name        VARCHAR(64) PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role       VARCHAR(32) NOT NULL REFERENCES roles (name) ON DELETE CASCADE,
+    permission VARCHAR(64) NOT NULL REFERENCES permissions (name) ON DELETE CASCADE,
+    PRIMARY KEY (role, permission)
+);
+
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    role    VARCHAR(32) NOT NULL REFERENCES roles (name) ON DELETE CASCADE,
+    PRIMARY KEY (user_id, role)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_roles_role ON user_roles (role, user_id);
+
+INSERT INTO roles (name, description) VALUES
+    ('user', 'Regular account'),
+    ('moderator', 'Can moderate any post'),
+    ('admin', 'Full administrative access')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO permissions (name, description) VALUES
+    ('posts:moderate', 'Edit or delete any post'),
+    ('users:read', 'List user accounts'),
+    ('users:manage_roles', 'Change the roles of any user')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('moderator', 'posts:moderate'),
+    ('admin', 'posts:moderate'),
+    ('admin', 'users:read'),
+    ('admin', 'users:manage_roles')
+ON CONFLICT DO NOTHING;
+
+-- Existing accounts become regular users.
+INSERT INTO user_roles (user_id, role)
+SELECT id, 'user' FROM users
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,5 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS bio        VARCHAR(500) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS avatar_url VARCHAR(2048) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS location   VARCHAR(100) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS website    VARCHAR(2048) NOT NULL DEFAULT '';
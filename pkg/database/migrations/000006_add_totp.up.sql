@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id    BIGINT PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    secret     VARCHAR(64) NOT NULL,
+    -- NULL until the user confirms enrollment with a first valid code.
+    enabled_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+    user_id   BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    code_hash CHAR(64) NOT NULL,
+    used_at   TIMESTAMPTZ,
+    PRIMARY KEY (user_id, code_hash)
+);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS user_identities (
+    id         BIGSERIAL PRIMARY KEY,
+    user_id    BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    -- provider is the configured provider name, subject the provider's
+    -- stable "sub" claim; email is informational only.
+    provider   VARCHAR(50) NOT NULL,
+    subject    VARCHAR(255) NOT NULL,
+    email      VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities (user_id);
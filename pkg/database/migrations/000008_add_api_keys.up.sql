@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+    id           BIGSERIAL PRIMARY KEY,
+    user_id      BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name         VARCHAR(100) NOT NULL,
+    -- prefix is the start of the key, kept so listings can tell keys apart;
+    -- the key itself is only stored as a SHA-256 hash.
+    prefix       VARCHAR(16) NOT NULL,
+    key_hash     CHAR(64) NOT NULL,
+    scopes       VARCHAR(50)[] NOT NULL,
+    expires_at   TIMESTAMPTZ NOT NULL,
+    last_used_at TIMESTAMPTZ,
+    last_used_ip VARCHAR(45) NOT NULL DEFAULT '',
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_api_keys_key_hash ON api_keys (key_hash);
+CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys (user_id);
@@ -0,0 +1,7 @@
+INSERT INTO permissions (name, description) VALUES
+    ('users:unlock', 'Lift failed-login lockouts on any account')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'users:unlock')
+ON CONFLICT DO NOTHING;
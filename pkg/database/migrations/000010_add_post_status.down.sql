@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_posts_scheduled;
+DROP INDEX IF EXISTS idx_posts_status_created_at;
+ALTER TABLE posts DROP COLUMN IF EXISTS published_at, DROP COLUMN IF EXISTS status;
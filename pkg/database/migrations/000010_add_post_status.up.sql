@@ -0,0 +1,15 @@
+-- Posts written before statuses existed were public, so they start out
+-- published; new posts default to drafts.
+ALTER TABLE posts
+    ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'published'
+        CHECK (status IN ('draft', 'scheduled', 'published', 'archived')),
+    -- published_at is when a published post went live, or when a scheduled
+    -- one will.
+    ADD COLUMN IF NOT EXISTS published_at TIMESTAMPTZ;
+
+UPDATE posts SET published_at = created_at WHERE status = 'published' AND published_at IS NULL;
+
+ALTER TABLE posts ALTER COLUMN status SET DEFAULT 'draft';
+
+CREATE INDEX IF NOT EXISTS idx_posts_status_created_at ON posts (status, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_posts_scheduled ON posts (published_at) WHERE status = 'scheduled';
@@ -0,0 +1,19 @@
+-- Every version of a post's title and content, numbered per post from 1.
+-- The newest revision always matches the post itself.
+CREATE TABLE IF NOT EXISTS post_revisions (
+    id         BIGSERIAL PRIMARY KEY,
+    post_id    BIGINT NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+    revision   INTEGER NOT NULL,
+    -- editor_id is the author or moderator who saved the revision.
+    editor_id  BIGINT REFERENCES users (id) ON DELETE SET NULL,
+    title      VARCHAR(100) NOT NULL,
+    content    TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (post_id, revision)
+);
+
+-- Existing posts start their history at their current state.
+INSERT INTO post_revisions (post_id, revision, editor_id, title, content, created_at)
+SELECT id, 1, user_id, title, content, updated_at
+FROM posts
+ON CONFLICT (post_id, revision) DO NOTHING;
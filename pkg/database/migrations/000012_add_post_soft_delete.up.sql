@@ -0,0 +1,5 @@
+-- deleted_at marks a post as moved to its author's trash. Trashed posts are
+-- purged for good once they have been there longer than the retention.
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_posts_deleted_at ON posts (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,3 @@
+-- removed_by_moderator marks a trashed post that a moderator took down.
+-- Its author may purge it but not restore it.
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS removed_by_moderator BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,25 @@
+package migrations
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := load(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+
+	for i, m := range migrations {
+		if m.Version != int64(i+1) {
+			t.Fatalf("migration %d has version %d; versions must run 1, 2, 3, ...", i, m.Version)
+		}
+		if strings.TrimSpace(m.Up) == "" || strings.TrimSpace(m.Down) == "" {
+			t.Errorf("migration %d_%s needs both an up and a down script", m.Version, m.Name)
+		}
+	}
+}
@@ -0,0 +1,448 @@
+// Package keyring holds the keys used to sign and verify JWTs.
+//
+// An HMAC keyring wraps a single shared secret. An asymmetric keyring (RS256
+// or EdDSA) keeps PKCS#8 PEM private keys in a directory, one file per key
+// named after its key ID. The newest key of the configured algorithm signs;
+// older keys keep verifying until every token they signed has expired, and
+// their public halves are published as a JWKS document. Several instances
+// can share the directory: each reloads it periodically and whenever it
+// meets a key ID it does not know.
+package keyring
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+
+	rsaKeyBits = 2048
+	// kidTimeLayout prefixes generated key IDs with their creation time so
+	// the age of a key survives copying the directory around.
+	kidTimeLayout = "20060102T150405Z"
+	// minReloadInterval bounds how often an unknown key ID can trigger a
+	// directory reload.
+	minReloadInterval = 10 * time.Second
+)
+
+var (
+	ErrUnknownKey        = errors.New("keyring: unknown key id")
+	ErrAlgorithmMismatch = errors.New("keyring: token algorithm does not match key")
+)
+
+type key struct {
+	id        string
+	alg       string
+	createdAt time.Time
+	// private is the signing key: []byte, *rsa.PrivateKey or
+	// ed25519.PrivateKey.
+	private crypto.PrivateKey
+}
+
+func (k key) method() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.alg)
+}
+
+func (k key) public() crypto.PublicKey {
+	switch private := k.private.(type) {
+	case *rsa.PrivateKey:
+		return &private.PublicKey
+	case ed25519.PrivateKey:
+		return private.Public()
+	default:
+		return private
+	}
+}
+
+// KeyRing is safe for concurrent use.
+type KeyRing struct {
+	mu          sync.RWMutex
+	alg         string
+	dir         string
+	rotateEvery time.Duration
+	retain      time.Duration
+	// keys is ordered oldest first.
+	keys       []key
+	lastReload time.Time
+	now        func() time.Time
+}
+
+// NewHMAC returns a keyring with a single static HS256 key. Such keyrings
+// never rotate and publish no public keys.
+func NewHMAC(secret string) *KeyRing {
+	return &KeyRing{
+		alg:  AlgHS256,
+		keys: []key{{id: "hs256", alg: AlgHS256, private: []byte(secret)}},
+		now:  time.Now,
+	}
+}
+
+// Open loads the asymmetric keys in dir, creating the directory and a first
+// key of alg if needed. A new signing key is generated every rotateEvery
+// (zero disables rotation), and a key stops verifying retain after it was
+// superseded; retain should be at least the longest token lifetime.
+func Open(dir, alg string, rotateEvery, retain time.Duration) (*KeyRing, error) {
+	if alg != AlgRS256 && alg != AlgEdDSA {
+		return nil, fmt.Errorf("keyring: unsupported algorithm %q", alg)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	r := &KeyRing{
+		alg:         alg,
+		dir:         dir,
+		rotateEvery: rotateEvery,
+		retain:      retain,
+		now:         time.Now,
+	}
+	if err := r.Maintain(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Algorithm is the algorithm new tokens are signed with.
+func (r *KeyRing) Algorithm() string {
+	return r.alg
+}
+
+// SigningKey returns the ID, method and key to sign new tokens with.
+func (r *KeyRing) SigningKey() (string, jwt.SigningMethod, crypto.PrivateKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for i := len(r.keys) - 1; i >= 0; i-- {
+		if k := r.keys[i]; k.alg == r.alg {
+			return k.id, k.method(), k.private, nil
+		}
+	}
+	return "", nil, nil, fmt.Errorf("keyring: no %s signing key", r.alg)
+}
+
+// VerificationKey returns the key that checks tokens signed by kid with
+// alg. Unknown IDs trigger a reload, so keys created by other instances are
+// picked up without waiting for the next maintenance run.
+func (r *KeyRing) VerificationKey(kid, alg string) (crypto.PublicKey, error) {
+	k, ok := r.find(kid)
+	if !ok && r.dir != "" && r.reloadDue() {
+		if err := r.reload(); err != nil {
+			return nil, err
+		}
+		k, ok = r.find(kid)
+	}
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if k.alg != alg {
+		return nil, ErrAlgorithmMismatch
+	}
+	return k.public(), nil
+}
+
+func (r *KeyRing) find(kid string) (key, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, k := range r.keys {
+		if k.id == kid {
+			return k, true
+		}
+	}
+	return key{}, false
+}
+
+func (r *KeyRing) reloadDue() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.now().Sub(r.lastReload) >= minReloadInterval
+}
+
+// Maintain reloads the directory, generates a new signing key when the
+// current one is due for rotation and deletes keys past retention. It is a
+// no-op for HMAC keyrings.
+func (r *KeyRing) Maintain() error {
+	if r.dir == "" {
+		return nil
+	}
+
+	if err := r.reload(); err != nil {
+		return err
+	}
+
+	_, _, _, err := r.SigningKey()
+	if err != nil || r.rotationDue() {
+		if err := r.Rotate(); err != nil {
+			return err
+		}
+	}
+	return r.prune()
+}
+
+func (r *KeyRing) rotationDue() bool {
+	if r.rotateEvery <= 0 {
+		return false
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for i := len(r.keys) - 1; i >= 0; i-- {
+		if k := r.keys[i]; k.alg == r.alg {
+			return !r.now().Before(k.createdAt.Add(r.rotateEvery))
+		}
+	}
+	return true
+}
+
+// Rotate generates a new signing key and saves it to the directory.
+func (r *KeyRing) Rotate() error {
+	if r.dir == "" {
+		return errors.New("keyring: HMAC keyrings cannot rotate")
+	}
+
+	var private crypto.PrivateKey
+	var err error
+	switch r.alg {
+	case AlgRS256:
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case AlgEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		return err
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	now := r.now().UTC()
+	k := key{
+		id:        fmt.Sprintf("%s-%x", now.Format(kidTimeLayout), suffix),
+		alg:       r.alg,
+		createdAt: now,
+		private:   private,
+	}
+
+	if err := writeKey(filepath.Join(r.dir, k.id+".pem"), private); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.keys = append(r.keys, k)
+	sortKeys(r.keys)
+	r.mu.Unlock()
+	return nil
+}
+
+// prune deletes keys that were superseded more than retain ago. A key is
+// superseded once a newer signing key exists.
+func (r *KeyRing) prune() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := r.keys[:0]
+	var expired []key
+	for i, k := range r.keys {
+		supersededAt, superseded := time.Time{}, false
+		for _, newer := range r.keys[i+1:] {
+			if newer.alg == r.alg {
+				supersededAt, superseded = newer.createdAt, true
+				break
+			}
+		}
+		if superseded && r.now().After(supersededAt.Add(r.retain)) {
+			expired = append(expired, k)
+			continue
+		}
+		kept = append(kept, k)
+	}
+	r.keys = kept
+
+	for _, k := range expired {
+		err := os.Remove(filepath.Join(r.dir, k.id+".pem"))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// reload replaces the in-memory keys with the directory's contents.
+func (r *KeyRing) reload() error {
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		return err
+	}
+
+	var keys []key
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".pem" {
+			continue
+		}
+
+		k, err := readKey(filepath.Join(r.dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+		keys = append(keys, k)
+	}
+	sortKeys(keys)
+
+	r.mu.Lock()
+	r.keys = keys
+	r.lastReload = r.now()
+	r.mu.Unlock()
+	return nil
+}
+
+// Run calls Maintain every interval until ctx is done. Failures are logged
+// and retried on the next tick; the keys already loaded keep working.
+func (r *KeyRing) Run(ctx context.Context, interval time.Duration) {
+	if r.dir == "" {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Maintain(); err != nil {
+				log.Printf("keyring: maintenance failed: %v", err)
+			}
+		}
+	}
+}
+
+func readKey(path string) (key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return key{}, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return key{}, fmt.Errorf("keyring: %s: no PEM block", path)
+	}
+	private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return key{}, fmt.Errorf("keyring: %s: %w", path, err)
+	}
+
+	k := key{id: strings.TrimSuffix(filepath.Base(path), ".pem"), private: private}
+	switch private.(type) {
+	case *rsa.PrivateKey:
+		k.alg = AlgRS256
+	case ed25519.PrivateKey:
+		k.alg = AlgEdDSA
+	default:
+		return key{}, fmt.Errorf("keyring: %s: unsupported key type %T", path, private)
+	}
+
+	// Keys added by hand may not follow the naming scheme; fall back to the
+	// file's modification time.
+	prefix, _, _ := strings.Cut(k.id, "-")
+	if k.createdAt, err = time.Parse(kidTimeLayout, prefix); err != nil {
+		info, err := os.Stat(path)
+		if err != nil {
+			return key{}, err
+		}
+		k.createdAt = info.ModTime()
+	}
+	return k, nil
+}
+
+// writeKey saves the key atomically so other instances never read a
+// partial file.
+func writeKey(path string, private crypto.PrivateKey) error {
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return err
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func sortKeys(keys []key) {
+	sort.SliceStable(keys, func(i, j int) bool {
+		if keys[i].createdAt.Equal(keys[j].createdAt) {
+			return keys[i].id < keys[j].id
+		}
+		return keys[i].createdAt.Before(keys[j].createdAt)
+	})
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	// RSA keys.
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519 keys.
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys that currently verify tokens. HMAC keys are
+// never published.
+func (r *KeyRing) JWKS() JWKS {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	set := JWKS{Keys: []JWK{}}
+	for _, k := range r.keys {
+		jwk := JWK{Use: "sig", Algorithm: k.alg, KeyID: k.id}
+		switch public := k.public().(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
@@ -0,0 +1,108 @@
+package keyring
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRotationKeepsOldKeysUntilRetentionEnds(t *testing.T) {
+	dir := t.TempDir()
+	r, err := Open(dir, AlgEdDSA, time.Hour, 2*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	first, _, _, err := r.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(90 * time.Minute)
+	if err := r.Maintain(); err != nil {
+		t.Fatal(err)
+	}
+	second, _, _, _ := r.SigningKey()
+	if second == first {
+		t.Fatal("Maintain did not rotate a key older than the rotation interval")
+	}
+	if _, err := r.VerificationKey(first, AlgEdDSA); err != nil {
+		t.Fatalf("superseded key no longer verifies: %v", err)
+	}
+	if n := len(r.JWKS().Keys); n != 2 {
+		t.Fatalf("JWKS has %d keys, want 2", n)
+	}
+
+	// The first key is dropped retain after the second replaced it.
+	now = now.Add(2*time.Hour + time.Minute)
+	if err := r.Maintain(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.VerificationKey(first, AlgEdDSA); err != ErrUnknownKey {
+		t.Fatalf("VerificationKey(expired key) error = %v, want ErrUnknownKey", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, first+".pem")); !os.IsNotExist(err) {
+		t.Fatalf("expired key file still exists: %v", err)
+	}
+}
+
+func TestKeysAreSharedThroughTheDirectory(t *testing.T) {
+	dir := t.TempDir()
+	a, err := Open(dir, AlgEdDSA, 0, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Open(dir, AlgEdDSA, 0, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kidA, _, _, _ := a.SigningKey()
+	kidB, _, _, _ := b.SigningKey()
+	if kidA != kidB {
+		t.Fatalf("second instance created its own key %s instead of loading %s", kidB, kidA)
+	}
+
+	if err := a.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	rotated, _, _, _ := a.SigningKey()
+
+	// b has never seen the new key; looking it up reloads the directory.
+	b.lastReload = time.Time{}
+	if _, err := b.VerificationKey(rotated, AlgEdDSA); err != nil {
+		t.Fatalf("b cannot verify a's new key: %v", err)
+	}
+	if _, err := b.VerificationKey(rotated, AlgRS256); err != ErrAlgorithmMismatch {
+		t.Fatalf("VerificationKey with the wrong algorithm error = %v, want ErrAlgorithmMismatch", err)
+	}
+}
+
+func TestRSAKeysArePublished(t *testing.T) {
+	r, err := Open(t.TempDir(), AlgRS256, 0, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set := r.JWKS()
+	if len(set.Keys) != 1 {
+		t.Fatalf("JWKS has %d keys, want 1", len(set.Keys))
+	}
+	if k := set.Keys[0]; k.KeyType != "RSA" || k.Algorithm != AlgRS256 || k.N == "" || k.E != "AQAB" {
+		t.Fatalf("unexpected JWK %+v", k)
+	}
+}
+
+func TestHMACKeysAreNotPublished(t *testing.T) {
+	r := NewHMAC("secret")
+	if n := len(r.JWKS().Keys); n != 0 {
+		t.Fatalf("JWKS has %d keys, want none", n)
+	}
+	if _, err := r.VerificationKey("hs256", AlgRS256); err != ErrAlgorithmMismatch {
+		t.Fatalf("VerificationKey(RS256) error = %v, want ErrAlgorithmMismatch", err)
+	}
+}
@@ -0,0 +1,38 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// LogMailer writes messages to w instead of delivering them, for local
+// development.
+type LogMailer struct {
+	mu   sync.Mutex
+	w    io.Writer
+	from string
+}
+
+func NewLogMailer(w io.Writer, from string) *LogMailer {
+	return &LogMailer{w: w, from: from}
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data, err := format(m.from, msg)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err = fmt.Fprintf(m.w, "----- mail %s -----\r\n%s\r\n----- end mail -----\r\n", time.Now().Format(time.RFC3339), data)
+	return err
+}
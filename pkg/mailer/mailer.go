@@ -0,0 +1,63 @@
+// Package mailer sends transactional email through a pluggable transport.
+package mailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/tamabsndra/miniproject/miniproject-backend/config"
+)
+
+var ErrInvalidHeader = errors.New("mailer: header contains a line break")
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New returns the mailer selected by cfg.MailDriver.
+func New(cfg *config.Config) (Mailer, error) {
+	switch cfg.MailDriver {
+	case "smtp":
+		return NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom), nil
+	case "log", "":
+		if cfg.MailLogFile == "" {
+			return NewLogMailer(os.Stdout, cfg.MailFrom), nil
+		}
+		f, err := os.OpenFile(cfg.MailLogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, err
+		}
+		return NewLogMailer(f, cfg.MailFrom), nil
+	default:
+		return nil, fmt.Errorf("mailer: unknown driver %q", cfg.MailDriver)
+	}
+}
+
+// format renders msg as an RFC 5322 message. Header values are rejected if
+// they could inject extra headers.
+func format(from string, msg Message) ([]byte, error) {
+	for _, value := range []string{from, msg.To, msg.Subject} {
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, ErrInvalidHeader
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String()), nil
+}
@@ -0,0 +1,85 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/smtp"
+	"time"
+)
+
+type SMTPMailer struct {
+	host     string
+	addr     string
+	username string
+	password string
+	from     string
+}
+
+func NewSMTPMailer(host, port, username, password, from string) *SMTPMailer {
+	return &SMTPMailer{
+		host:     host,
+		addr:     net.JoinHostPort(host, port),
+		username: username,
+		password: password,
+		from:     from,
+	}
+}
+
+// Send delivers msg, upgrading to TLS when the server offers STARTTLS and
+// authenticating when credentials are configured. The context deadline
+// bounds the whole conversation.
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	data, err := format(m.from, msg)
+	if err != nil {
+		return err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", m.addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(time.Minute))
+	}
+
+	client, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: m.host}); err != nil {
+			return err
+		}
+	}
+	if m.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.username, m.password, m.host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(m.from); err != nil {
+		return err
+	}
+	if err := client.Rcpt(msg.To); err != nil {
+		return err
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
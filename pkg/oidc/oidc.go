@@ -0,0 +1,378 @@
+// Package oidc is a minimal OpenID Connect relying party: discovery, the
+// authorization code flow with PKCE, and ID token verification against the
+// provider's published keys.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrInvalidIDToken = errors.New("oidc: invalid id token")
+	ErrNonceMismatch  = errors.New("oidc: id token nonce does not match")
+)
+
+// minKeyRefreshInterval bounds how often an unknown key ID can trigger a
+// JWKS refetch.
+const minKeyRefreshInterval = time.Minute
+
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Claims are the identity claims taken from a verified ID token.
+type Claims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider talks to one OpenID provider. Discovery and the provider's keys
+// are fetched lazily and cached, so a provider that is down at startup does
+// not stop the service.
+type Provider struct {
+	cfg    Config
+	client *http.Client
+
+	// mu guards the cached fields; it is never held across a fetch.
+	mu            sync.Mutex
+	metadata      *metadata
+	keys          map[string]crypto.PublicKey
+	keysFetchedAt time.Time
+	// keysRefresh is closed when the JWKS fetch in flight, if any, ends.
+	keysRefresh chan struct{}
+}
+
+func NewProvider(cfg Config, client *http.Client) *Provider {
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+	return &Provider{cfg: cfg, client: client}
+}
+
+// NewPKCE returns a random code verifier and its S256 challenge.
+func NewPKCE() (verifier, challenge string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	verifier = base64.RawURLEncoding.EncodeToString(b)
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// AuthCodeURL returns the URL to send the user to for consent.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.cfg.ClientID)
+	query.Set("redirect_uri", p.cfg.RedirectURL)
+	query.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return meta.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the claims of the ID
+// token that came with it, after checking its signature, issuer, audience,
+// expiry and nonce.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Claims, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cfg.RedirectURL)
+	form.Set("client_id", p.cfg.ClientID)
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := p.doJSON(req, &token); err != nil {
+		return nil, fmt.Errorf("oidc: token exchange: %w", err)
+	}
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("%w: token response has no id_token", ErrInvalidIDToken)
+	}
+
+	return p.verify(ctx, meta, token.IDToken, nonce)
+}
+
+type idTokenClaims struct {
+	Nonce         string   `json:"nonce"`
+	Email         string   `json:"email"`
+	EmailVerified flexBool `json:"email_verified"`
+	Name          string   `json:"name"`
+	jwt.RegisteredClaims
+}
+
+func (p *Provider) verify(ctx context.Context, meta *metadata, idToken, nonce string) (*Claims, error) {
+	var claims idTokenClaims
+	_, err := jwt.ParseWithClaims(idToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, meta, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "ES256"}),
+		jwt.WithIssuer(meta.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	if claims.Nonce != nonce {
+		return nil, ErrNonceMismatch
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing sub", ErrInvalidIDToken)
+	}
+
+	return &Claims{
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+		Name:          claims.Name,
+	}, nil
+}
+
+// discover returns the provider metadata, fetching it on first use.
+// Concurrent first calls may each fetch it; the first to finish is kept.
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	cached := p.metadata
+	p.mu.Unlock()
+	if cached != nil {
+		return cached, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(p.cfg.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var meta metadata
+	if err := p.doJSON(req, &meta); err != nil {
+		return nil, fmt.Errorf("oidc: discovery: %w", err)
+	}
+	if meta.Issuer != p.cfg.Issuer {
+		return nil, fmt.Errorf("oidc: discovery returned issuer %q, want %q", meta.Issuer, p.cfg.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, errors.New("oidc: discovery document is missing endpoints")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata == nil {
+		p.metadata = &meta
+	}
+	return p.metadata, nil
+}
+
+// key returns the provider's key with the given ID, refetching the JWKS if
+// it is unknown so provider key rotation is picked up. One fetch runs at a
+// time; callers that need it meanwhile wait for its result.
+func (p *Provider) key(ctx context.Context, meta *metadata, kid string) (crypto.PublicKey, error) {
+	for {
+		p.mu.Lock()
+		if key, ok := p.keys[kid]; ok {
+			p.mu.Unlock()
+			return key, nil
+		}
+		refresh := p.keysRefresh
+		if refresh == nil {
+			break
+		}
+		p.mu.Unlock()
+
+		select {
+		case <-refresh:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	// p.mu is held here and no fetch is in flight.
+	if time.Since(p.keysFetchedAt) < minKeyRefreshInterval {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	refresh := make(chan struct{})
+	p.keysRefresh = refresh
+	p.mu.Unlock()
+
+	keys, err := p.fetchKeys(ctx, meta.JWKSURI)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err == nil {
+		p.keys = keys
+		p.keysFetchedAt = time.Now()
+	}
+	p.keysRefresh = nil
+	close(refresh)
+
+	if err != nil {
+		return nil, err
+	}
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+// fetchKeys downloads the JWKS, keeping the signing keys it can use.
+func (p *Provider) fetchKeys(ctx context.Context, jwksURI string) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, jwksURI, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := p.doJSON(req, &set); err != nil {
+		return nil, fmt.Errorf("fetch jwks: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if key, err := k.publicKey(); err == nil {
+			keys[k.KeyID] = key
+		}
+	}
+	return keys, nil
+}
+
+func (p *Provider) doJSON(req *http.Request, out interface{}) error {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s: status %d: %s", req.Method, req.URL.Redacted(), resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, out)
+}
+
+type jwk struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if k.Curve != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.KeyType)
+	}
+}
+
+// flexBool accepts both true and "true"; some providers send
+// email_verified as a string.
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	switch string(data) {
+	case "true", `"true"`:
+		*b = true
+	default:
+		*b = false
+	}
+	return nil
+}
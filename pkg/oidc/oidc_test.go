@@ -0,0 +1,163 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/oidc"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/oidc/oidctest"
+)
+
+const redirectURL = "http://app.test/callback"
+
+func authorize(t *testing.T, server *oidctest.Provider, rp *oidc.Provider, nonce string) (code, verifier string) {
+	t.Helper()
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	authURL, err := rp.AuthCodeURL(context.Background(), "state", nonce, challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	redirect, err := server.Authorize(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redirect.Query().Get("state") != "state" {
+		t.Fatalf("state = %q, want it echoed back", redirect.Query().Get("state"))
+	}
+	return redirect.Query().Get("code"), verifier
+}
+
+func TestExchangeVerifiesIDToken(t *testing.T) {
+	server, err := oidctest.NewProvider("client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	server.SetUser(oidctest.User{Subject: "sub", Email: "a@example.com", EmailVerified: true, Name: "A"})
+
+	rp := oidc.NewProvider(oidc.Config{Issuer: server.Issuer(), ClientID: "client", RedirectURL: redirectURL}, server.Server.Client())
+
+	code, verifier := authorize(t, server, rp, "nonce")
+	claims, err := rp.Exchange(context.Background(), code, verifier, "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *claims != (oidc.Claims{Subject: "sub", Email: "a@example.com", EmailVerified: true, Name: "A"}) {
+		t.Fatalf("claims = %+v", claims)
+	}
+
+	code, verifier = authorize(t, server, rp, "nonce")
+	if _, err := rp.Exchange(context.Background(), code, verifier, "other"); !errors.Is(err, oidc.ErrNonceMismatch) {
+		t.Fatalf("wrong nonce: err = %v, want ErrNonceMismatch", err)
+	}
+
+	code, _ = authorize(t, server, rp, "nonce")
+	if _, err := rp.Exchange(context.Background(), code, "wrong-verifier", "nonce"); err == nil {
+		t.Fatal("exchange with the wrong PKCE verifier succeeded")
+	}
+}
+
+func TestExchangeRejectsTokenForAnotherClient(t *testing.T) {
+	server, err := oidctest.NewProvider("client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	server.SetUser(oidctest.User{Subject: "sub"})
+
+	rp := oidc.NewProvider(oidc.Config{Issuer: server.Issuer(), ClientID: "client", RedirectURL: redirectURL}, server.Server.Client())
+	code, verifier := authorize(t, server, rp, "nonce")
+
+	// The same provider, but a relying party expecting its own client ID.
+	other := oidc.NewProvider(oidc.Config{Issuer: server.Issuer(), ClientID: "other", RedirectURL: redirectURL}, server.Server.Client())
+	if _, err := other.Exchange(context.Background(), code, verifier, "nonce"); !errors.Is(err, oidc.ErrInvalidIDToken) {
+		t.Fatalf("err = %v, want ErrInvalidIDToken", err)
+	}
+}
+
+func TestDiscoveryRejectsIssuerMismatch(t *testing.T) {
+	server, err := oidctest.NewProvider("client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	rp := oidc.NewProvider(oidc.Config{Issuer: server.Issuer() + "/", ClientID: "client", RedirectURL: redirectURL}, server.Server.Client())
+	if _, err := rp.AuthCodeURL(context.Background(), "s", "n", "c"); err == nil {
+		t.Fatal("discovery accepted a document for a different issuer")
+	}
+}
+
+// stallingTransport holds JWKS requests until release is closed.
+type stallingTransport struct {
+	next    http.RoundTripper
+	stalled chan struct{}
+	release chan struct{}
+}
+
+func (t *stallingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Path == "/jwks" {
+		t.stalled <- struct{}{}
+		<-t.release
+	}
+	return t.next.RoundTrip(req)
+}
+
+func TestKeyFetchDoesNotBlockOtherCalls(t *testing.T) {
+	server, err := oidctest.NewProvider("client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	server.SetUser(oidctest.User{Subject: "sub"})
+
+	transport := &stallingTransport{next: server.Server.Client().Transport, stalled: make(chan struct{}, 2), release: make(chan struct{})}
+	rp := oidc.NewProvider(oidc.Config{Issuer: server.Issuer(), ClientID: "client", RedirectURL: redirectURL}, &http.Client{Transport: transport})
+
+	type result struct {
+		claims *oidc.Claims
+		err    error
+	}
+	results := make(chan result, 2)
+	for i := 0; i < 2; i++ {
+		code, verifier := authorize(t, server, rp, "nonce")
+		go func() {
+			claims, err := rp.Exchange(context.Background(), code, verifier, "nonce")
+			results <- result{claims, err}
+		}()
+	}
+	<-transport.stalled
+
+	// Starting another sign-in needs the cached discovery document, not the
+	// keys being fetched.
+	done := make(chan error, 1)
+	go func() {
+		_, err := rp.AuthCodeURL(context.Background(), "state", "nonce", "challenge")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("AuthCodeURL blocked behind the JWKS fetch")
+	}
+
+	close(transport.release)
+	for i := 0; i < 2; i++ {
+		if r := <-results; r.err != nil || r.claims.Subject != "sub" {
+			t.Fatalf("Exchange = %+v, %v", r.claims, r.err)
+		}
+	}
+	// Both exchanges were served by a single fetch.
+	if len(transport.stalled) != 0 {
+		t.Fatal("JWKS fetched more than once")
+	}
+}
@@ -0,0 +1,215 @@
+// Package passhash hashes passwords with bcrypt or Argon2id and encodes
+// them as PHC strings:
+//
+//	$bcrypt$r=12$<salt>$<hash>
+//	$argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>
+//
+// Raw bcrypt hashes ($2a$...) from before the PHC encoding verify too, and
+// always report that they need rehashing.
+package passhash
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	Bcrypt   = "bcrypt"
+	Argon2id = "argon2id"
+)
+
+var ErrMalformedHash = errors.New("passhash: malformed hash")
+
+const bcryptMaxPasswordBytes = 72
+
+// Argon2Params are the Argon2id cost parameters. Memory is in KiB.
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2Params follow the OWASP recommendation of 19 MiB, two
+// iterations and one lane.
+var DefaultArgon2Params = Argon2Params{
+	Memory:      19 * 1024,
+	Iterations:  2,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// Hasher creates hashes with one configured algorithm and verifies hashes
+// made with any supported algorithm and parameters.
+type Hasher struct {
+	algorithm  string
+	bcryptCost int
+	argon2     Argon2Params
+}
+
+func NewBcrypt(cost int) (*Hasher, error) {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return nil, fmt.Errorf("passhash: bcrypt cost %d outside %d-%d", cost, bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	return &Hasher{algorithm: Bcrypt, bcryptCost: cost}, nil
+}
+
+func NewArgon2id(params Argon2Params) (*Hasher, error) {
+	if params.Memory < 8*uint32(params.Parallelism) || params.Iterations < 1 || params.Parallelism < 1 || params.SaltLength < 8 || params.KeyLength < 16 {
+		return nil, fmt.Errorf("passhash: invalid argon2id parameters %+v", params)
+	}
+	return &Hasher{algorithm: Argon2id, argon2: params}, nil
+}
+
+// MaxPasswordBytes is the longest password, in bytes, that Hash accepts,
+// or zero when there is no limit. bcrypt stops at 72 bytes.
+func (h *Hasher) MaxPasswordBytes() int {
+	if h.algorithm == Bcrypt {
+		return bcryptMaxPasswordBytes
+	}
+	return 0
+}
+
+// Hash returns the PHC string for password.
+func (h *Hasher) Hash(password string) (string, error) {
+	if h.algorithm == Argon2id {
+		salt := make([]byte, h.argon2.SaltLength)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		key := argon2.IDKey([]byte(password), salt, h.argon2.Iterations, h.argon2.Memory, h.argon2.Parallelism, h.argon2.KeyLength)
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+			argon2.Version, h.argon2.Memory, h.argon2.Iterations, h.argon2.Parallelism,
+			b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+	}
+
+	raw, err := bcrypt.GenerateFromPassword([]byte(password), h.bcryptCost)
+	if err != nil {
+		return "", err
+	}
+	return bcryptToPHC(string(raw))
+}
+
+// Verify reports whether password matches encoded. It returns
+// ErrMalformedHash for hashes it cannot parse.
+func (h *Hasher) Verify(password, encoded string) (bool, error) {
+	switch {
+	case isRawBcrypt(encoded):
+		return compareBcrypt(password, encoded)
+	case strings.HasPrefix(encoded, "$bcrypt$"):
+		raw, _, err := bcryptFromPHC(encoded)
+		if err != nil {
+			return false, err
+		}
+		return compareBcrypt(password, raw)
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		params, salt, key, err := parseArgon2id(encoded)
+		if err != nil {
+			return false, err
+		}
+		other := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+		return subtle.ConstantTimeCompare(key, other) == 1, nil
+	default:
+		return false, ErrMalformedHash
+	}
+}
+
+// NeedsRehash reports whether encoded was made with another algorithm or
+// other parameters than h would use now.
+func (h *Hasher) NeedsRehash(encoded string) bool {
+	switch h.algorithm {
+	case Bcrypt:
+		_, cost, err := bcryptFromPHC(encoded)
+		return err != nil || cost != h.bcryptCost
+	case Argon2id:
+		params, salt, key, err := parseArgon2id(encoded)
+		return err != nil ||
+			params.Memory != h.argon2.Memory ||
+			params.Iterations != h.argon2.Iterations ||
+			params.Parallelism != h.argon2.Parallelism ||
+			uint32(len(salt)) != h.argon2.SaltLength ||
+			uint32(len(key)) != h.argon2.KeyLength
+	default:
+		return true
+	}
+}
+
+// b64 is the PHC encoding: standard alphabet without padding.
+var b64 = base64.RawStdEncoding
+
+func isRawBcrypt(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func compareBcrypt(password, raw string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(raw), []byte(password))
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+		return false, nil
+	default:
+		return false, fmt.Errorf("%w: %v", ErrMalformedHash, err)
+	}
+}
+
+// bcryptToPHC re-encodes a "$2a$12$<22 char salt><31 char hash>" hash.
+// The salt and hash keep bcrypt's own base64 alphabet, which PHC allows.
+func bcryptToPHC(raw string) (string, error) {
+	parts := strings.Split(raw, "$")
+	if len(parts) != 4 || len(parts[3]) != 53 {
+		return "", ErrMalformedHash
+	}
+	cost, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return "", ErrMalformedHash
+	}
+	return fmt.Sprintf("$bcrypt$r=%d$%s$%s", cost, parts[3][:22], parts[3][22:]), nil
+}
+
+func bcryptFromPHC(encoded string) (raw string, cost int, err error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 5 || parts[1] != Bcrypt || !strings.HasPrefix(parts[2], "r=") || len(parts[3]) != 22 || len(parts[4]) != 31 {
+		return "", 0, ErrMalformedHash
+	}
+	cost, err = strconv.Atoi(strings.TrimPrefix(parts[2], "r="))
+	if err != nil || cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return "", 0, ErrMalformedHash
+	}
+	return fmt.Sprintf("$2a$%02d$%s%s", cost, parts[3], parts[4]), cost, nil
+}
+
+func parseArgon2id(encoded string) (params Argon2Params, salt, key []byte, err error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != Argon2id || parts[2] != fmt.Sprintf("v=%d", argon2.Version) {
+		return params, nil, nil, ErrMalformedHash
+	}
+
+	var parallelism uint32
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &parallelism); err != nil {
+		return params, nil, nil, ErrMalformedHash
+	}
+	if params.Iterations < 1 || parallelism < 1 || parallelism > 255 {
+		return params, nil, nil, ErrMalformedHash
+	}
+	params.Parallelism = uint8(parallelism)
+
+	if salt, err = b64.DecodeString(parts[4]); err != nil {
+		return params, nil, nil, ErrMalformedHash
+	}
+	if key, err = b64.DecodeString(parts[5]); err != nil || len(key) == 0 {
+		return params, nil, nil, ErrMalformedHash
+	}
+	params.SaltLength, params.KeyLength = uint32(len(salt)), uint32(len(key))
+	return params, salt, key, nil
+}
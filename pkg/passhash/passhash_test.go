@@ -0,0 +1,150 @@
+package passhash
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var testArgon2Params = Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestHashAndVerify(t *testing.T) {
+	bcryptHasher, err := NewBcrypt(bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	argonHasher, err := NewArgon2id(testArgon2Params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		hasher *Hasher
+		prefix string
+	}{
+		{bcryptHasher, "$bcrypt$r=4$"},
+		{argonHasher, "$argon2id$v=19$m=64,t=1,p=1$"},
+	} {
+		encoded, err := tc.hasher.Hash("correct horse")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(encoded, tc.prefix) {
+			t.Fatalf("hash %q, want prefix %q", encoded, tc.prefix)
+		}
+		if tc.hasher.NeedsRehash(encoded) {
+			t.Fatalf("fresh hash %q needs rehash", encoded)
+		}
+
+		// Either hasher verifies hashes from both algorithms.
+		for _, verifier := range []*Hasher{bcryptHasher, argonHasher} {
+			if ok, err := verifier.Verify("correct horse", encoded); !ok || err != nil {
+				t.Fatalf("Verify(%q) = %v, %v, want true", encoded, ok, err)
+			}
+			if ok, err := verifier.Verify("wrong horse", encoded); ok || err != nil {
+				t.Fatalf("Verify(wrong, %q) = %v, %v, want false", encoded, ok, err)
+			}
+		}
+	}
+}
+
+func TestMaxPasswordBytes(t *testing.T) {
+	bcryptHasher, err := NewBcrypt(bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	argonHasher, err := NewArgon2id(testArgon2Params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	limit := bcryptHasher.MaxPasswordBytes()
+	if _, err := bcryptHasher.Hash(strings.Repeat("é", limit/2)); err != nil {
+		t.Fatalf("Hash(%d bytes) = %v", limit, err)
+	}
+	if _, err := bcryptHasher.Hash(strings.Repeat("é", limit/2+1)); err == nil {
+		t.Fatalf("Hash(%d bytes) succeeded, want bcrypt to refuse it", limit+2)
+	}
+	if argonHasher.MaxPasswordBytes() != 0 {
+		t.Fatal("argon2id reports a password length limit")
+	}
+}
+
+func TestLegacyBcryptHashes(t *testing.T) {
+	raw, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hasher, err := NewBcrypt(bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := hasher.Verify("secret", string(raw)); !ok || err != nil {
+		t.Fatalf("Verify(legacy) = %v, %v, want true", ok, err)
+	}
+	if !hasher.NeedsRehash(string(raw)) {
+		t.Fatal("legacy hash with the current cost does not need rehashing into PHC form")
+	}
+}
+
+func TestNeedsRehashOnParameterChange(t *testing.T) {
+	cheap, _ := NewBcrypt(bcrypt.MinCost)
+	stronger, _ := NewBcrypt(bcrypt.MinCost + 1)
+	argonHasher, _ := NewArgon2id(testArgon2Params)
+	moreMemory := testArgon2Params
+	moreMemory.Memory *= 2
+	argonStronger, _ := NewArgon2id(moreMemory)
+
+	bcryptHash, _ := cheap.Hash("pw")
+	argonHash, _ := argonHasher.Hash("pw")
+
+	for _, tc := range []struct {
+		name    string
+		hasher  *Hasher
+		encoded string
+		want    bool
+	}{
+		{"bcrypt cost raised", stronger, bcryptHash, true},
+		{"bcrypt to argon2id", argonHasher, bcryptHash, true},
+		{"argon2id to bcrypt", cheap, argonHash, true},
+		{"argon2id memory raised", argonStronger, argonHash, true},
+		{"argon2id unchanged", argonHasher, argonHash, false},
+		{"garbage", argonHasher, "plaintext", true},
+	} {
+		if got := tc.hasher.NeedsRehash(tc.encoded); got != tc.want {
+			t.Errorf("%s: NeedsRehash = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestVerifyKnownArgon2idVector(t *testing.T) {
+	// The argon2id vector for t=1, m=64, p=1 from golang.org/x/crypto's
+	// argon2 tests: password "password", salt "somesalt", 24 byte key.
+	const encoded = "$argon2id$v=19$m=64,t=1,p=1$c29tZXNhbHQ$ZVrRXqxlLcWfcXCnMyv0m4Rpvh/bnCi7"
+	hasher, _ := NewArgon2id(testArgon2Params)
+	ok, err := hasher.Verify("password", encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Fatal("reference hash did not verify")
+	}
+}
+
+func TestVerifyRejectsMalformedHashes(t *testing.T) {
+	hasher, _ := NewArgon2id(testArgon2Params)
+	for _, encoded := range []string{
+		"",
+		"plaintext",
+		"$bcrypt$r=4$short$hash",
+		"$argon2id$v=18$m=64,t=1,p=1$c2FsdA$aGFzaA",
+		"$argon2id$v=19$m=64,t=0,p=1$c2FsdA$aGFzaA",
+		"$argon2id$v=19$m=64,t=1,p=1$!!!$aGFzaA",
+	} {
+		if ok, err := hasher.Verify("pw", encoded); ok || err == nil {
+			t.Errorf("Verify(%q) = %v, %v, want ErrMalformedHash", encoded, ok, err)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package passpolicy
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// scanWindow is the span, in bytes, below which a lookup stops bisecting and
+// reads the remaining lines in order.
+const scanWindow = 4096
+
+// BreachedList is a set of SHA-1 hashes of breached passwords kept in a file
+// sorted by hash. Nothing is loaded into memory: each lookup binary searches
+// the file, so a list of any size costs a few dozen small reads per check.
+type BreachedList struct {
+	r    io.ReaderAt
+	size int64
+	file *os.File
+}
+
+// OpenBreachedList opens a breached-password file at path; see
+// NewBreachedList for the format. The file stays open until Close.
+func OpenBreachedList(path string) (*BreachedList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	list, err := NewBreachedList(f, info.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	list.file = f
+	return list, nil
+}
+
+// NewBreachedList searches size bytes of r, which must hold uppercase or
+// lowercase SHA-1 hashes, one per line and sorted by hash, each optionally
+// followed by ":<count>". This is the single-file output of the Pwned
+// Passwords downloader. Only the first line is checked up front; a
+// malformed line met during a lookup is reported then.
+func NewBreachedList(r io.ReaderAt, size int64) (*BreachedList, error) {
+	list := &BreachedList{r: r, size: size}
+	if _, _, err := list.lineFrom(0); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Close closes the file opened by OpenBreachedList.
+func (l *BreachedList) Close() error {
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// Size returns the size of the list in bytes.
+func (l *BreachedList) Size() int64 {
+	return l.size
+}
+
+// Contains reports whether password appears in the list.
+func (l *BreachedList) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	target := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	// The line holding target, if any, starts in [lo, hi).
+	lo, hi := int64(0), l.size
+	for hi-lo > scanWindow {
+		mid := lo + (hi-lo)/2
+		start, hash, err := l.lineFrom(mid)
+		if errors.Is(err, io.EOF) || (err == nil && start >= hi) {
+			hi = mid
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+
+		switch {
+		case hash == target:
+			return true, nil
+		case hash < target:
+			lo = start + 1
+		default:
+			hi = start
+		}
+	}
+
+	start, br, err := l.readerFrom(lo)
+	if err != nil {
+		return false, err
+	}
+	for start < hi {
+		line, err := br.ReadString('\n')
+		if line == "" && errors.Is(err, io.EOF) {
+			return false, nil
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return false, err
+		}
+		hash, parseErr := parseBreachedLine(line, start)
+		if parseErr != nil {
+			return false, parseErr
+		}
+		if hash >= target {
+			return hash == target, nil
+		}
+		start += int64(len(line))
+	}
+	return false, nil
+}
+
+// lineFrom returns the offset and hash of the first line starting at or
+// after off, or io.EOF if there is none.
+func (l *BreachedList) lineFrom(off int64) (int64, string, error) {
+	start, br, err := l.readerFrom(off)
+	if err != nil {
+		return 0, "", err
+	}
+	line, err := br.ReadString('\n')
+	if line == "" {
+		if err == nil {
+			err = io.EOF
+		}
+		return 0, "", err
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, "", err
+	}
+	hash, err := parseBreachedLine(line, start)
+	return start, hash, err
+}
+
+// readerFrom returns a reader positioned at the first line starting at or
+// after off, and that line's offset.
+func (l *BreachedList) readerFrom(off int64) (int64, *bufio.Reader, error) {
+	if off == 0 {
+		return 0, bufio.NewReaderSize(io.NewSectionReader(l.r, 0, l.size), 256), nil
+	}
+
+	// Start one byte early so a line beginning exactly at off is kept.
+	br := bufio.NewReaderSize(io.NewSectionReader(l.r, off-1, l.size-off+1), 256)
+	skipped, err := br.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, nil, err
+	}
+	return off - 1 + int64(len(skipped)), br, nil
+}
+
+// parseBreachedLine returns the uppercase hash on a "<hash>[:<count>]" line
+// found at offset.
+func parseBreachedLine(line string, offset int64) (string, error) {
+	hash, _, _ := strings.Cut(strings.TrimRight(line, "\r\n"), ":")
+	hash = strings.ToUpper(hash)
+	if len(hash) != 2*sha1.Size {
+		return "", fmt.Errorf("passpolicy: breached list at byte %d: not a SHA-1 hash", offset)
+	}
+	if _, err := hex.DecodeString(hash); err != nil {
+		return "", fmt.Errorf("passpolicy: breached list at byte %d: not a SHA-1 hash", offset)
+	}
+	return hash, nil
+}
@@ -0,0 +1,146 @@
+// Package passpolicy decides whether a new password is acceptable: its
+// length and character classes, whether it contains the user's email or
+// name, how easy it is to guess, and whether it appears in a list of
+// breached passwords.
+package passpolicy
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// minPersonalTokenLength keeps short names and email fragments from
+// rejecting unrelated passwords.
+const minPersonalTokenLength = 3
+
+// Policy is the set of rules a new password must pass. Zero values disable
+// the corresponding rule.
+type Policy struct {
+	MinLength int
+	MaxLength int
+	// MaxBytes caps the UTF-8 encoded length, for password hashers such as
+	// bcrypt that accept only so many bytes. Characters outside ASCII take
+	// two to four bytes each.
+	MaxBytes int
+	// MinCharClasses is how many of lowercase letters, uppercase letters,
+	// digits and symbols the password must use.
+	MinCharClasses int
+	// DisallowPersonalInfo rejects passwords containing the user's email
+	// address, its local part or any part of their name.
+	DisallowPersonalInfo bool
+	// MinScore is the lowest strength score, from 0 to 4, that is accepted.
+	MinScore int
+	// Breached, when set, rejects passwords found in the list.
+	Breached *BreachedList
+}
+
+// ViolationError lists every rule a password broke.
+type ViolationError struct {
+	Problems []string
+}
+
+func (e *ViolationError) Error() string {
+	return "password does not meet the policy: " + strings.Join(e.Problems, "; ")
+}
+
+// Check returns a *ViolationError if password breaks the policy, or another
+// error if the breached list cannot be read. personal holds the user's email
+// and name.
+func (p *Policy) Check(password string, personal ...string) error {
+	// A password that is too long is rejected for that alone, before the
+	// strength and breach checks spend time on input of any size.
+	length := utf8.RuneCountInString(password)
+	if p.MaxLength > 0 && length > p.MaxLength {
+		return &ViolationError{Problems: []string{fmt.Sprintf("must be at most %d characters long", p.MaxLength)}}
+	}
+	if p.MaxBytes > 0 && len(password) > p.MaxBytes {
+		return &ViolationError{Problems: []string{fmt.Sprintf("is too long: at most %d bytes are allowed, and accented letters, symbols and other non-ASCII characters take two to four bytes each", p.MaxBytes)}}
+	}
+
+	var problems []string
+	if p.MinLength > 0 && length < p.MinLength {
+		problems = append(problems, fmt.Sprintf("must be at least %d characters long", p.MinLength))
+	}
+	if p.MinCharClasses > 0 && charClasses(password) < p.MinCharClasses {
+		problems = append(problems, fmt.Sprintf("must use at least %d of: lowercase letters, uppercase letters, digits, symbols", p.MinCharClasses))
+	}
+
+	tokens := personalTokens(personal)
+	if p.DisallowPersonalInfo && containsAny(strings.ToLower(password), tokens) {
+		problems = append(problems, "must not contain your email address or name")
+	}
+	if p.MinScore > 0 {
+		if score := Score(password, tokens...); score < p.MinScore {
+			problems = append(problems, fmt.Sprintf("is too easy to guess (strength %d of 4, at least %d required)", score, p.MinScore))
+		}
+	}
+	if p.Breached != nil {
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			problems = append(problems, "has appeared in a known data breach; choose a different one")
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ViolationError{Problems: problems}
+	}
+	return nil
+}
+
+func charClasses(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
+
+// personalTokens splits emails and names into the lowercase fragments a
+// password should not contain: the whole value, an email's local part,
+// and each word of either.
+func personalTokens(personal []string) []string {
+	var tokens []string
+	add := func(s string) {
+		if utf8.RuneCountInString(s) >= minPersonalTokenLength {
+			tokens = append(tokens, s)
+		}
+	}
+
+	for _, value := range personal {
+		value = strings.ToLower(strings.TrimSpace(value))
+		add(value)
+		if local, _, ok := strings.Cut(value, "@"); ok {
+			add(local)
+			value = local
+		}
+		for _, word := range strings.FieldsFunc(value, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			add(word)
+		}
+	}
+	return tokens
+}
+
+func containsAny(s string, tokens []string) bool {
+	for _, token := range tokens {
+		if strings.Contains(s, token) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,147 @@
+package passpolicy
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestScore(t *testing.T) {
+	for _, tc := range []struct {
+		password string
+		want     int
+	}{
+		{"", 0},
+		{"password", 0},
+		{"P@ssw0rd", 0},
+		{"qwertyuiop", 0},
+		{"abcdefgh123", 1},
+		{"aaaaaaaaaaaa", 0},
+		{"dragondragon", 0},
+		{"summer2019", 1},
+		{"correcthorsebatterystaple", 4},
+		{"vN8#qL2!zR5@", 4},
+	} {
+		if got := Score(tc.password); got != tc.want {
+			t.Errorf("Score(%q) = %d, want %d", tc.password, got, tc.want)
+		}
+	}
+}
+
+func TestScoreUsesUserInputs(t *testing.T) {
+	if Score("ravenclawkestrel") < 3 {
+		t.Fatal("unrelated password scored low")
+	}
+	if got := Score("ravenclawkestrel", "ravenclaw", "kestrel"); got > 1 {
+		t.Fatalf("password built from user inputs scored %d, want at most 1", got)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	policy := Policy{MinLength: 10, MaxLength: 64, MinCharClasses: 3, DisallowPersonalInfo: true, MinScore: 3}
+
+	if err := policy.Check("vN8#qL2!zR5@", "alice.smith@example.com", "Alice Smith"); err != nil {
+		t.Fatalf("Check(strong) = %v", err)
+	}
+
+	for _, tc := range []struct {
+		password string
+		problems []string
+	}{
+		{"short", []string{"at least 10 characters", "at least 3 of", "too easy to guess"}},
+		{strings.Repeat("xK9#", 17), []string{"at most 64 characters"}},
+		{"Smith-vN8#qL2!", []string{"email address or name"}},
+		{"Xq7$alice.smith", []string{"email address or name", "too easy to guess"}},
+	} {
+		err := policy.Check(tc.password, "alice.smith@example.com", "Alice Smith")
+		var violation *ViolationError
+		if !errors.As(err, &violation) {
+			t.Fatalf("Check(%q) = %v, want a violation", tc.password, err)
+		}
+		if len(violation.Problems) != len(tc.problems) {
+			t.Fatalf("Check(%q) problems = %q, want %d", tc.password, violation.Problems, len(tc.problems))
+		}
+		for k, want := range tc.problems {
+			if !strings.Contains(violation.Problems[k], want) {
+				t.Errorf("Check(%q) problem %d = %q, want it to mention %q", tc.password, k, violation.Problems[k], want)
+			}
+		}
+	}
+}
+
+func TestCheckMaxBytes(t *testing.T) {
+	policy := Policy{MaxLength: 72, MaxBytes: 72}
+
+	// 72 characters but 144 bytes, more than bcrypt accepts.
+	err := policy.Check(strings.Repeat("é", 72))
+	var violation *ViolationError
+	if !errors.As(err, &violation) || len(violation.Problems) != 1 || !strings.Contains(violation.Problems[0], "at most 72 bytes") {
+		t.Fatalf("Check(72 two-byte characters) = %v, want the byte limit problem", err)
+	}
+	if err := policy.Check(strings.Repeat("é", 36)); err != nil {
+		t.Fatalf("Check(72 bytes) = %v", err)
+	}
+}
+
+func TestBreachedList(t *testing.T) {
+	// Enough hashes that lookups bisect the file before scanning it.
+	var hashes []string
+	for i := 0; i < 3000; i++ {
+		sum := sha1.Sum([]byte(fmt.Sprintf("breached-%d", i)))
+		hashes = append(hashes, strings.ToUpper(hex.EncodeToString(sum[:])))
+	}
+	sort.Strings(hashes)
+	var file strings.Builder
+	for i, hash := range hashes {
+		fmt.Fprintf(&file, "%s:%d\r\n", hash, i+1)
+	}
+
+	path := filepath.Join(t.TempDir(), "pwned.txt")
+	if err := os.WriteFile(path, []byte(file.String()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	list, err := OpenBreachedList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer list.Close()
+
+	for i := 0; i < 3000; i++ {
+		if found, err := list.Contains(fmt.Sprintf("breached-%d", i)); err != nil || !found {
+			t.Fatalf("Contains(breached-%d) = %v, %v; want true", i, found, err)
+		}
+		if found, err := list.Contains(fmt.Sprintf("safe-%d", i)); err != nil || found {
+			t.Fatalf("Contains(safe-%d) = %v, %v; want false", i, found, err)
+		}
+	}
+
+	policy := Policy{Breached: list}
+	if err := policy.Check("breached-42"); err == nil || !strings.Contains(err.Error(), "data breach") {
+		t.Fatalf("Check(breached) = %v, want a breach violation", err)
+	}
+
+	// A lowercase single line without a trailing newline is found too.
+	sum := sha1.Sum([]byte("hunter2-but-longer"))
+	single := hex.EncodeToString(sum[:])
+	if list, err := NewBreachedList(strings.NewReader(single), int64(len(single))); err != nil {
+		t.Fatal(err)
+	} else if found, err := list.Contains("hunter2-but-longer"); err != nil || !found {
+		t.Fatalf("Contains(single line) = %v, %v; want true", found, err)
+	}
+
+	if list, err := NewBreachedList(strings.NewReader(""), 0); err != nil {
+		t.Fatal(err)
+	} else if found, err := list.Contains("anything"); err != nil || found {
+		t.Fatalf("Contains(empty list) = %v, %v; want false", found, err)
+	}
+
+	if _, err := NewBreachedList(strings.NewReader("not-a-hash\n"), 11); err == nil {
+		t.Fatal("malformed list opened")
+	}
+}
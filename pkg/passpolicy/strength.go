@@ -0,0 +1,425 @@
+package passpolicy
+
+import (
+	_ "embed"
+	"math"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxScoredLength bounds the work Score does; anything past it is scored as
+// brute force. It matches the 72 bytes bcrypt hashes, the usual MaxBytes.
+const maxScoredLength = 72
+
+//go:embed common.txt
+var commonList string
+
+// commonRanks maps each entry of common.txt to its rank, most common first.
+var commonRanks = func() map[string]int {
+	ranks := make(map[string]int)
+	for _, line := range strings.Split(commonList, "\n") {
+		word := strings.TrimSpace(line)
+		if word == "" || strings.HasPrefix(word, "#") {
+			continue
+		}
+		if _, ok := ranks[word]; !ok {
+			ranks[word] = len(ranks) + 1
+		}
+	}
+	return ranks
+}()
+
+// longestCommon is the length in runes of the longest entry of common.txt.
+var longestCommon = func() int {
+	longest := 0
+	for word := range commonRanks {
+		longest = max(longest, utf8.RuneCountInString(word))
+	}
+	return longest
+}()
+
+var keyboardRows = []string{"`1234567890-=", "qwertyuiop[]\\", "asdfghjkl;'", "zxcvbnm,./"}
+
+// l33tTable lists the letters a substituted character may stand for.
+var l33tTable = map[rune][]rune{
+	'4': {'a'}, '@': {'a'}, '8': {'b'}, '(': {'c'}, '3': {'e'}, '6': {'g'}, '9': {'g'},
+	'1': {'i', 'l'}, '!': {'i'}, '|': {'i', 'l'}, '0': {'o'}, '$': {'s'}, '5': {'s'},
+	'7': {'t'}, '+': {'t'}, '2': {'z'},
+}
+
+// match is a span [i, j) of the password and the log10 of the number of
+// guesses an attacker needs to produce it.
+type match struct {
+	i, j    int
+	guesses float64
+}
+
+// Score estimates how hard password is to guess, in the manner of zxcvbn.
+// It finds the cheapest way to build the password out of common passwords
+// and words, the user's own details, repeats, sequences, keyboard runs,
+// years and brute-forced characters, and buckets the number of guesses that
+// takes from 0 (too guessable) to 4 (very unguessable). userInputs are
+// lowercase words treated as more likely than any dictionary entry.
+func Score(password string, userInputs ...string) int {
+	guesses := log10Guesses([]rune(password), userInputs, make(map[string]float64))
+	switch {
+	case guesses < 3:
+		return 0
+	case guesses < 6:
+		return 1
+	case guesses < 8:
+		return 2
+	case guesses < 10:
+		return 3
+	}
+	return 4
+}
+
+// log10Guesses returns the log10 of the guesses needed for the cheapest
+// sequence of matches covering password. Like zxcvbn it charges k! for
+// putting k matches in order. blocks caches the guesses for repeated blocks,
+// so a repetitive password scores each distinct block once rather than at
+// every position it repeats from.
+func log10Guesses(password []rune, userInputs []string, blocks map[string]float64) float64 {
+	n := len(password)
+	if n == 0 {
+		return 0
+	}
+	extra := 0.0
+	if n > maxScoredLength {
+		extra = float64(n - maxScoredLength)
+		password = password[:maxScoredLength]
+		n = maxScoredLength
+	}
+
+	lower := make([]rune, n)
+	for i, r := range password {
+		lower[i] = unicode.ToLower(r)
+	}
+
+	byEnd := make([][]match, n+1)
+	for _, m := range findMatches(password, lower, userInputs, blocks) {
+		byEnd[m.j] = append(byEnd[m.j], m)
+	}
+	for j := 1; j <= n; j++ {
+		for i := 0; i < j; i++ {
+			byEnd[j] = append(byEnd[j], match{i, j, bruteforceGuesses(j - i)})
+		}
+	}
+
+	// best[k][j] is the cheapest cover of password[:j] by k matches.
+	inf := math.Inf(1)
+	best := make([][]float64, n+1)
+	for k := range best {
+		best[k] = make([]float64, n+1)
+		for j := range best[k] {
+			best[k][j] = inf
+		}
+	}
+	best[0][0] = 0
+	for j := 1; j <= n; j++ {
+		for _, m := range byEnd[j] {
+			for k := 0; k < n; k++ {
+				if prev := best[k][m.i]; prev+m.guesses < best[k+1][j] {
+					best[k+1][j] = prev + m.guesses
+				}
+			}
+		}
+	}
+
+	total := inf
+	for k := 1; k <= n; k++ {
+		if g := best[k][n] + log10Factorial(k); g < total {
+			total = g
+		}
+	}
+	return total + extra
+}
+
+func findMatches(password, lower []rune, userInputs []string, blocks map[string]float64) []match {
+	var matches []match
+	matches = append(matches, dictionaryMatches(password, lower, userInputs)...)
+	matches = append(matches, repeatMatches(lower, userInputs, blocks)...)
+	matches = append(matches, sequenceMatches(lower)...)
+	matches = append(matches, keyboardMatches(lower)...)
+	matches = append(matches, yearMatches(lower)...)
+
+	// A match that is only part of the password is never cheaper than
+	// zxcvbn's floor for one, so "password1" is not rated as easy as
+	// "password".
+	for k := range matches {
+		if m := &matches[k]; m.j-m.i < len(password) {
+			m.guesses = math.Max(m.guesses, math.Log10(50))
+		}
+	}
+	return matches
+}
+
+func dictionaryMatches(password, lower []rune, userInputs []string) []match {
+	// No substring longer than the longest word can match one.
+	longest := longestCommon
+	inputs := make(map[string]bool, len(userInputs))
+	for _, input := range userInputs {
+		inputs[input] = true
+		longest = max(longest, utf8.RuneCountInString(input))
+	}
+	rank := func(word string) (float64, bool) {
+		if inputs[word] {
+			return 1, true
+		}
+		if r, ok := commonRanks[word]; ok {
+			return float64(r), true
+		}
+		return 0, false
+	}
+
+	var matches []match
+	for i := range lower {
+		for j := i + 1; j <= min(len(lower), i+longest); j++ {
+			word := lower[i:j]
+			best := math.Inf(1)
+
+			if r, ok := rank(string(word)); ok {
+				best = math.Min(best, math.Log10(r*caseVariations(password[i:j])))
+			}
+			if r, ok := rank(string(reversed(word))); ok && j-i > 1 {
+				best = math.Min(best, math.Log10(2*r*caseVariations(password[i:j])))
+			}
+			for _, alt := range []int{0, 1} {
+				plain, subs := unl33t(word, alt)
+				if subs == 0 {
+					continue
+				}
+				if r, ok := rank(plain); ok {
+					best = math.Min(best, math.Log10(r*caseVariations(password[i:j])*math.Pow(2, float64(subs))))
+				}
+			}
+
+			if !math.IsInf(best, 1) {
+				matches = append(matches, match{i, j, best})
+			}
+		}
+	}
+	return matches
+}
+
+// caseVariations is how many capitalisations of a word an attacker tries
+// before reaching this one: none for lowercase, two for a leading or
+// trailing capital or all caps, and every mix of upper and lower otherwise.
+func caseVariations(word []rune) float64 {
+	var upper, lower int
+	for _, r := range word {
+		switch {
+		case unicode.IsUpper(r):
+			upper++
+		case unicode.IsLower(r):
+			lower++
+		}
+	}
+	switch {
+	case upper == 0:
+		return 1
+	case lower == 0, upper == 1 && (unicode.IsUpper(word[0]) || unicode.IsUpper(word[len(word)-1])):
+		return 2
+	}
+	variations := 0.0
+	for k := 1; k <= upper && k <= lower; k++ {
+		variations += binomial(upper+lower, k)
+	}
+	return variations
+}
+
+// unl33t undoes character substitutions, taking the alt-th reading of
+// ambiguous ones, and reports how many distinct substitutions it undid.
+func unl33t(word []rune, alt int) (string, int) {
+	plain := make([]rune, len(word))
+	used := make(map[rune]bool)
+	for k, r := range word {
+		letters, ok := l33tTable[r]
+		if !ok {
+			plain[k] = r
+			continue
+		}
+		plain[k] = letters[min(alt, len(letters)-1)]
+		used[r] = true
+	}
+	return string(plain), len(used)
+}
+
+// repeatMatches finds runs of one character and of a repeated block, such
+// as "aaaa" and "abcabc". A block is scored as a password of its own.
+func repeatMatches(lower []rune, userInputs []string, blocks map[string]float64) []match {
+	var matches []match
+	n := len(lower)
+	for i := 0; i < n; i++ {
+		j := i + 1
+		for j < n && lower[j] == lower[i] {
+			j++
+		}
+		if j-i >= 3 {
+			matches = append(matches, match{i, j, math.Log10(cardinality(lower[i]) * float64(j-i))})
+		}
+
+		for size := 2; i+2*size <= n; size++ {
+			count := 1
+			for i+(count+1)*size <= n && slices.Equal(lower[i+count*size:i+(count+1)*size], lower[i:i+size]) {
+				count++
+			}
+			if count >= 2 {
+				block := string(lower[i : i+size])
+				base, ok := blocks[block]
+				if !ok {
+					base = log10Guesses(lower[i:i+size], userInputs, blocks)
+					blocks[block] = base
+				}
+				matches = append(matches, match{i, i + count*size, base + math.Log10(float64(count))})
+			}
+		}
+	}
+	return matches
+}
+
+// sequenceMatches finds runs such as "abcd", "4321" and "xyz".
+func sequenceMatches(lower []rune) []match {
+	var matches []match
+	n := len(lower)
+	for i := 0; i+2 < n; {
+		delta := lower[i+1] - lower[i]
+		j := i + 1
+		if delta == 1 || delta == -1 {
+			for j < n && lower[j]-lower[j-1] == delta && sameClass(lower[j], lower[i]) {
+				j++
+			}
+		}
+		for a := i; a+3 <= j; a++ {
+			for b := a + 3; b <= j; b++ {
+				matches = append(matches, match{a, b, sequenceGuesses(lower[a], b-a, delta < 0)})
+			}
+		}
+		if j-i > 1 {
+			i = j - 1
+		} else {
+			i = j
+		}
+	}
+	return matches
+}
+
+func sequenceGuesses(first rune, length int, descending bool) float64 {
+	base := 26.0
+	switch {
+	case strings.ContainsRune("a1z9", first):
+		base = 4
+	case unicode.IsDigit(first):
+		base = 10
+	}
+	if descending {
+		base *= 2
+	}
+	return math.Log10(base * float64(length))
+}
+
+// keyboardMatches finds runs of neighbouring keys on a QWERTY row, such as
+// "qwerty" and "lkjh".
+func keyboardMatches(lower []rune) []match {
+	var matches []match
+	n := len(lower)
+	for i := 0; i < n; i++ {
+		row, col := keyPosition(lower[i])
+		if row < 0 {
+			continue
+		}
+		turns, direction := 0, 0
+		for j := i + 1; j < n; j++ {
+			r, c := keyPosition(lower[j])
+			if r != row || (c-col != 1 && c-col != -1) {
+				break
+			}
+			if direction != 0 && c-col != direction {
+				turns++
+			}
+			direction, col = c-col, c
+
+			if length := j - i + 1; length >= 4 {
+				matches = append(matches, match{i, j + 1, math.Log10(float64(length-1)*47*4) + float64(turns)*math.Log10(4)})
+			}
+		}
+	}
+	return matches
+}
+
+func keyPosition(r rune) (row, col int) {
+	for row, keys := range keyboardRows {
+		if col := strings.IndexRune(keys, r); col >= 0 {
+			return row, col
+		}
+	}
+	return -1, -1
+}
+
+// yearMatches finds recent years, which people add to passwords far more
+// often than other four digit numbers.
+func yearMatches(lower []rune) []match {
+	var matches []match
+	current := time.Now().Year()
+	for i := 0; i+4 <= len(lower); i++ {
+		year := 0
+		for _, r := range lower[i : i+4] {
+			if r < '0' || r > '9' {
+				year = -1
+				break
+			}
+			year = year*10 + int(r-'0')
+		}
+		if year >= 1900 && year <= 2099 {
+			space := math.Max(math.Abs(float64(year-current)), 20)
+			matches = append(matches, match{i, i + 4, math.Log10(space)})
+		}
+	}
+	return matches
+}
+
+func bruteforceGuesses(length int) float64 {
+	if length == 1 {
+		return math.Log10(11)
+	}
+	return math.Max(float64(length), math.Log10(51))
+}
+
+func cardinality(r rune) float64 {
+	switch {
+	case unicode.IsDigit(r):
+		return 10
+	case unicode.IsLetter(r):
+		return 26
+	}
+	return 33
+}
+
+func sameClass(a, b rune) bool {
+	return unicode.IsDigit(a) == unicode.IsDigit(b) && unicode.IsLetter(a) == unicode.IsLetter(b)
+}
+
+func reversed(word []rune) []rune {
+	out := make([]rune, len(word))
+	for k, r := range word {
+		out[len(word)-1-k] = r
+	}
+	return out
+}
+
+func binomial(n, k int) float64 {
+	result := 1.0
+	for i := 1; i <= k; i++ {
+		result = result * float64(n-k+i) / float64(i)
+	}
+	return result
+}
+
+func log10Factorial(k int) float64 {
+	lgamma, _ := math.Lgamma(float64(k + 1))
+	return lgamma / math.Ln10
+}
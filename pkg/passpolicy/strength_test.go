@@ -0,0 +1,39 @@
+package passpolicy
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// worstCaseScored are passwords of maxScoredLength that make Score do the
+// most work: runs and short blocks repeat from every position.
+var worstCaseScored = []string{
+	strings.Repeat("a", maxScoredLength),
+	strings.Repeat("ab", maxScoredLength/2),
+	strings.Repeat("abc", maxScoredLength/3),
+	strings.Repeat("p@ss", maxScoredLength/4),
+}
+
+// TestScoreIsFastOnRepetitiveInput guards against scoring repeated blocks
+// from scratch at every position, which took seconds for a 72 character
+// run and made the unauthenticated password endpoints easy to overload.
+func TestScoreIsFastOnRepetitiveInput(t *testing.T) {
+	for _, password := range append(worstCaseScored, strings.Repeat("a", 100), strings.Repeat("ab", 5000)) {
+		start := time.Now()
+		Score(password)
+		if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+			t.Errorf("Score(%.8q... %d runes) took %s", password, len(password), elapsed)
+		}
+	}
+}
+
+func BenchmarkScoreWorstCase(b *testing.B) {
+	for _, password := range worstCaseScored {
+		b.Run(password[:4], func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				Score(password)
+			}
+		})
+	}
+}
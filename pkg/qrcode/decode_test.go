@@ -0,0 +1,559 @@
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"testing"
+)
+
+// The tests in this file read symbols back the way a scanner does, from the
+// PNG alone, and check them against tables taken from ISO/IEC 18004 rather
+// than against the encoder's own arithmetic.
+
+// byteCapacityM is the byte mode capacity of each version at level M
+// (Table 7).
+var byteCapacityM = [maxVersion + 1]int{
+	0, 14, 26, 42, 62, 84, 106, 122, 152, 180, 213,
+	251, 287, 331, 362, 412, 450, 504, 560, 624, 666,
+}
+
+// blocksM is the level M error correction block structure (Table 9):
+// error correction codewords per block, then the count and data codewords
+// of each group of blocks.
+var blocksM = [maxVersion + 1][5]int{
+	1:  {10, 1, 16, 0, 0},
+	2:  {16, 1, 28, 0, 0},
+	3:  {26, 1, 44, 0, 0},
+	4:  {18, 2, 32, 0, 0},
+	5:  {24, 2, 43, 0, 0},
+	6:  {16, 4, 27, 0, 0},
+	7:  {18, 4, 31, 0, 0},
+	8:  {22, 2, 38, 2, 39},
+	9:  {22, 3, 36, 2, 37},
+	10: {26, 4, 43, 1, 44},
+	11: {30, 1, 50, 4, 51},
+	12: {22, 6, 36, 2, 37},
+	13: {22, 8, 37, 1, 38},
+	14: {24, 4, 40, 5, 41},
+	15: {24, 5, 41, 5, 42},
+	16: {28, 7, 45, 3, 46},
+	17: {28, 10, 46, 1, 47},
+	18: {26, 9, 43, 4, 44},
+	19: {26, 3, 44, 11, 45},
+	20: {26, 3, 41, 13, 42},
+}
+
+// alignmentCentres lists the alignment pattern row and column centres
+// (Annex E).
+var alignmentCentres = [maxVersion + 1][]int{
+	2:  {6, 18},
+	3:  {6, 22},
+	4:  {6, 26},
+	5:  {6, 30},
+	6:  {6, 34},
+	7:  {6, 22, 38},
+	8:  {6, 24, 42},
+	9:  {6, 26, 46},
+	10: {6, 28, 50},
+	11: {6, 30, 54},
+	12: {6, 32, 58},
+	13: {6, 34, 62},
+	14: {6, 26, 46, 66},
+	15: {6, 26, 48, 70},
+	16: {6, 26, 50, 74},
+	17: {6, 30, 54, 78},
+	18: {6, 30, 56, 82},
+	19: {6, 30, 58, 86},
+	20: {6, 34, 62, 90},
+}
+
+// versionInfo is the 18-bit version information of versions 7 and up
+// (Annex D, Table D.1).
+var versionInfo = map[int]int{
+	7: 0x07C94, 8: 0x085BC, 9: 0x09A99, 10: 0x0A4D3, 11: 0x0BBF6,
+	12: 0x0C762, 13: 0x0D847, 14: 0x0E60D, 15: 0x0F928, 16: 0x10B78,
+	17: 0x1145D, 18: 0x12A17, 19: 0x13532, 20: 0x149A6,
+}
+
+// formatInfoM maps the masked 15-bit format information of level M to its
+// mask pattern (Annex C, Table C.1).
+var formatInfoM = map[int]int{
+	0x5412: 0, 0x5125: 1, 0x5E7C: 2, 0x5B4B: 3,
+	0x45F9: 4, 0x40CE: 5, 0x4F97: 6, 0x4AA0: 7,
+}
+
+func TestDecodeRoundTrip(t *testing.T) {
+	uri := []byte("otpauth://totp/Mini%20Project:alice@example.com?algorithm=SHA1&digits=6&issuer=Mini+Project&period=30&secret=JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP")
+	if _, version, err := decodePNG(mustPNG(t, uri, 4)); err != nil || version < 7 {
+		t.Fatalf("otpauth URI: version %d, error %v", version, err)
+	}
+
+	for version := 1; version <= maxVersion; version++ {
+		// The largest payload of each version, and one byte more, which
+		// must move up a version.
+		for _, n := range []int{byteCapacityM[version], byteCapacityM[version] + 1} {
+			want := version
+			if n > byteCapacityM[version] {
+				want++
+			}
+			if want > maxVersion {
+				continue
+			}
+
+			data := make([]byte, n)
+			for i := range data {
+				data[i] = byte(i*131 + version)
+			}
+			t.Run(fmt.Sprintf("v%d/%d bytes", want, n), func(t *testing.T) {
+				got, decodedVersion, err := decodePNG(mustPNG(t, data, 3))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if decodedVersion != want {
+					t.Fatalf("version = %d, want %d", decodedVersion, want)
+				}
+				if !bytes.Equal(got, data) {
+					t.Fatalf("decoded %x, want %x", got, data)
+				}
+			})
+		}
+	}
+}
+
+func TestDecodeRejectsDamage(t *testing.T) {
+	data := mustPNG(t, []byte("hello, scanner"), 2)
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Flip one data module near the bottom-right corner; the damaged block
+	// must fail its Reed-Solomon check.
+	damaged := image.NewPaletted(img.Bounds(), img.(*image.Paletted).Palette)
+	copy(damaged.Pix, img.(*image.Paletted).Pix)
+	x, y := (quietZone+20)*2, (quietZone+20)*2
+	flipped := 1 - damaged.ColorIndexAt(x, y)
+	for dy := 0; dy < 2; dy++ {
+		for dx := 0; dx < 2; dx++ {
+			damaged.SetColorIndex(x+dx, y+dy, flipped)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, damaged); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := decodePNG(buf.Bytes()); err == nil {
+		t.Fatal("decoded a damaged symbol without error")
+	}
+}
+
+func mustPNG(t *testing.T, data []byte, scale int) []byte {
+	t.Helper()
+	out, err := PNG(data, scale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// decodePNG reads a byte mode, level M symbol from an upright PNG.
+func decodePNG(data []byte) ([]byte, int, error) {
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, err
+	}
+	grid, err := sampleGrid(img)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	size := len(grid)
+	version := (size - 17) / 4
+	if size < 21 || (size-17)%4 != 0 || version > maxVersion {
+		return nil, 0, fmt.Errorf("symbol is %d modules wide", size)
+	}
+	dark := func(x, y int) bool { return grid[y][x] }
+
+	function, err := checkFunctionPatterns(dark, size, version)
+	if err != nil {
+		return nil, 0, err
+	}
+	if version >= 7 {
+		if err := checkVersionInfo(dark, size, version); err != nil {
+			return nil, 0, err
+		}
+	}
+	mask, err := readFormatInfo(dark, size)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	codewords := readCodewords(dark, function, size, mask)
+	payload, err := correctBlocks(codewords, blocksM[version])
+	if err != nil {
+		return nil, 0, err
+	}
+	result, err := parseByteSegment(payload, version)
+	return result, version, err
+}
+
+// sampleGrid finds the top-left finder pattern, derives the module size
+// from it and samples every module at its centre.
+func sampleGrid(img image.Image) ([][]bool, error) {
+	b := img.Bounds()
+	isDark := func(x, y int) bool {
+		r, g, bl, _ := img.At(x, y).RGBA()
+		return r+g+bl < 3*0x8000
+	}
+
+	left, top := -1, -1
+	for y := b.Min.Y; y < b.Max.Y && top < 0; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if isDark(x, y) {
+				left, top = x, y
+				break
+			}
+		}
+	}
+	if top < 0 {
+		return nil, errors.New("no dark modules")
+	}
+
+	// The finder's top edge is seven dark modules.
+	run := 0
+	for x := left; x < b.Max.X && isDark(x, top); x++ {
+		run++
+	}
+	if run%7 != 0 {
+		return nil, fmt.Errorf("finder edge is %d pixels", run)
+	}
+	scale := run / 7
+
+	// The top-right finder ends the symbol's top row.
+	right := b.Max.X - 1
+	for right > left && !isDark(right, top) {
+		right--
+	}
+	width := right - left + 1
+	if width%scale != 0 {
+		return nil, fmt.Errorf("symbol width %d is not a multiple of %d", width, scale)
+	}
+
+	size := width / scale
+	grid := make([][]bool, size)
+	for y := range grid {
+		grid[y] = make([]bool, size)
+		for x := range grid[y] {
+			grid[y][x] = isDark(left+x*scale+scale/2, top+y*scale+scale/2)
+		}
+	}
+	return grid, nil
+}
+
+// checkFunctionPatterns checks the finder, timing and alignment patterns
+// and returns which modules are function modules.
+func checkFunctionPatterns(dark func(x, y int) bool, size, version int) ([][]bool, error) {
+	function := make([][]bool, size)
+	for y := range function {
+		function[y] = make([]bool, size)
+	}
+	mark := func(x0, y0, w, h int) {
+		for y := y0; y < y0+h; y++ {
+			for x := x0; x < x0+w; x++ {
+				function[y][x] = true
+			}
+		}
+	}
+
+	for _, corner := range [][2]int{{0, 0}, {size - 7, 0}, {0, size - 7}} {
+		for dy := 0; dy < 7; dy++ {
+			for dx := 0; dx < 7; dx++ {
+				ring := max(abs(dx-3), abs(dy-3))
+				if dark(corner[0]+dx, corner[1]+dy) != (ring != 2) {
+					return nil, fmt.Errorf("finder at %v is damaged", corner)
+				}
+			}
+		}
+	}
+	// Finders with separators and format information.
+	mark(0, 0, 9, 9)
+	mark(size-8, 0, 8, 9)
+	mark(0, size-8, 9, 8)
+
+	for i := 8; i < size-8; i++ {
+		if dark(i, 6) != (i%2 == 0) || dark(6, i) != (i%2 == 0) {
+			return nil, fmt.Errorf("timing pattern breaks at %d", i)
+		}
+	}
+	mark(0, 6, size, 1)
+	mark(6, 0, 1, size)
+
+	centres := alignmentCentres[version]
+	for _, cy := range centres {
+		for _, cx := range centres {
+			nearLeft, nearTop := cx < 9, cy < 9
+			if (nearLeft && nearTop) || (cx >= size-8 && nearTop) || (nearLeft && cy >= size-8) {
+				continue // overlaps a finder
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					if dark(cx+dx, cy+dy) != (max(abs(dx), abs(dy)) != 1) {
+						return nil, fmt.Errorf("alignment pattern at (%d, %d) is damaged", cx, cy)
+					}
+				}
+			}
+			mark(cx-2, cy-2, 5, 5)
+		}
+	}
+
+	if version >= 7 {
+		mark(size-11, 0, 3, 6)
+		mark(0, size-11, 6, 3)
+	}
+	if !dark(8, size-8) {
+		return nil, errors.New("dark module is light")
+	}
+	return function, nil
+}
+
+// checkVersionInfo reads both copies of the version information, most
+// significant bit first.
+func checkVersionInfo(dark func(x, y int) bool, size, version int) error {
+	var topRight, bottomLeft int
+	for i := 17; i >= 0; i-- {
+		topRight = topRight<<1 | bit(dark(size-11+i%3, i/3))
+		bottomLeft = bottomLeft<<1 | bit(dark(i/3, size-11+i%3))
+	}
+	if topRight != versionInfo[version] || bottomLeft != versionInfo[version] {
+		return fmt.Errorf("version information %05X and %05X, want %05X", topRight, bottomLeft, versionInfo[version])
+	}
+	return nil
+}
+
+// readFormatInfo reads both copies of the format information and returns
+// the mask pattern they agree on.
+func readFormatInfo(dark func(x, y int) bool, size int) (int, error) {
+	// Positions of bits 14 down to 0 in each copy.
+	var first, second [15][2]int
+	for i := 0; i < 15; i++ {
+		switch {
+		case i < 6:
+			first[i] = [2]int{i, 8}
+		case i < 8:
+			first[i] = [2]int{i + 1, 8}
+		case i == 8:
+			first[i] = [2]int{8, 7}
+		default:
+			first[i] = [2]int{8, 14 - i}
+		}
+		if i < 7 {
+			second[i] = [2]int{8, size - 1 - i}
+		} else {
+			second[i] = [2]int{size - 15 + i, 8}
+		}
+	}
+
+	masks := make([]int, 2)
+	for n, positions := range [][15][2]int{first, second} {
+		value := 0
+		for _, p := range positions {
+			value = value<<1 | bit(dark(p[0], p[1]))
+		}
+		mask, ok := formatInfoM[value]
+		if !ok {
+			return 0, fmt.Errorf("format information %015b is not level M", value)
+		}
+		masks[n] = mask
+	}
+	if masks[0] != masks[1] {
+		return 0, fmt.Errorf("format information copies disagree: masks %d and %d", masks[0], masks[1])
+	}
+	return masks[0], nil
+}
+
+// readCodewords reads the zigzag from the bottom-right corner, removing the
+// mask as it goes (Table 10 and 7.7.3).
+func readCodewords(dark func(x, y int) bool, function [][]bool, size, mask int) []byte {
+	masked := func(i, j int) bool {
+		switch mask {
+		case 0:
+			return (i+j)%2 == 0
+		case 1:
+			return i%2 == 0
+		case 2:
+			return j%3 == 0
+		case 3:
+			return (i+j)%3 == 0
+		case 4:
+			return (i/2+j/3)%2 == 0
+		case 5:
+			return i*j%2+i*j%3 == 0
+		case 6:
+			return (i*j%2+i*j%3)%2 == 0
+		default:
+			return ((i+j)%2+i*j%3)%2 == 0
+		}
+	}
+
+	var codewords []byte
+	var current byte
+	n := 0
+	upward := true
+	for col := size - 1; col > 0; col -= 2 {
+		if col == 6 {
+			col--
+		}
+		for k := 0; k < size; k++ {
+			row := k
+			if upward {
+				row = size - 1 - k
+			}
+			for _, x := range []int{col, col - 1} {
+				if function[row][x] {
+					continue
+				}
+				current = current<<1 | byte(bit(dark(x, row) != masked(row, x)))
+				if n++; n%8 == 0 {
+					codewords = append(codewords, current)
+					current = 0
+				}
+			}
+		}
+		upward = !upward
+	}
+	return codewords
+}
+
+// correctBlocks de-interleaves the codewords into blocks, checks every
+// block's Reed-Solomon syndromes and returns the data codewords in order.
+func correctBlocks(codewords []byte, layout [5]int) ([]byte, error) {
+	ecc, count1, data1, count2, data2 := layout[0], layout[1], layout[2], layout[3], layout[4]
+	sizes := make([]int, 0, count1+count2)
+	for i := 0; i < count1; i++ {
+		sizes = append(sizes, data1)
+	}
+	for i := 0; i < count2; i++ {
+		sizes = append(sizes, data2)
+	}
+
+	total := count1*data1 + count2*data2 + (count1+count2)*ecc
+	if len(codewords) != total {
+		return nil, fmt.Errorf("read %d codewords, want %d", len(codewords), total)
+	}
+
+	blocks := make([][]byte, len(sizes))
+	next := 0
+	for i := 0; i < max(data1, data2); i++ {
+		for b, n := range sizes {
+			if i < n {
+				blocks[b] = append(blocks[b], codewords[next])
+				next++
+			}
+		}
+	}
+	for i := 0; i < ecc; i++ {
+		for b := range blocks {
+			blocks[b] = append(blocks[b], codewords[next])
+			next++
+		}
+	}
+
+	var data []byte
+	for b, block := range blocks {
+		for i := 0; i < ecc; i++ {
+			if s := syndrome(block, i); s != 0 {
+				return nil, fmt.Errorf("block %d: syndrome %d is %d", b, i, s)
+			}
+		}
+		data = append(data, block[:sizes[b]]...)
+	}
+	return data, nil
+}
+
+// gfExp and gfLog are exponent and logarithm tables for GF(256) with the
+// polynomial 0x11D, built independently of gfMultiply.
+var gfExp, gfLog = func() ([512]byte, [256]int) {
+	var exp [512]byte
+	var log [256]int
+	x := 1
+	for i := 0; i < 255; i++ {
+		exp[i], exp[i+255] = byte(x), byte(x)
+		log[x] = i
+		if x <<= 1; x&0x100 != 0 {
+			x ^= 0x11D
+		}
+	}
+	return exp, log
+}()
+
+// syndrome evaluates the block, as a polynomial with its first codeword as
+// the highest power, at alpha^i. Every syndrome of a valid block is zero.
+func syndrome(block []byte, i int) byte {
+	var s byte
+	for _, c := range block {
+		if s != 0 {
+			s = gfExp[gfLog[s]+i]
+		}
+		s ^= c
+	}
+	return s
+}
+
+// parseByteSegment reads a single byte mode segment and checks the
+// terminator and padding after it.
+func parseByteSegment(data []byte, version int) ([]byte, error) {
+	pos := 0
+	read := func(n int) int {
+		v := 0
+		for i := 0; i < n; i++ {
+			if pos < 8*len(data) {
+				v = v<<1 | int(data[pos/8]>>(7-pos%8)&1)
+			} else {
+				v <<= 1
+			}
+			pos++
+		}
+		return v
+	}
+
+	if mode := read(4); mode != 0x4 {
+		return nil, fmt.Errorf("mode indicator %04b, want byte mode", mode)
+	}
+	countBits := 8
+	if version >= 10 {
+		countBits = 16
+	}
+	n := read(countBits)
+	if pos+8*n > 8*len(data) {
+		return nil, fmt.Errorf("character count %d overruns the data", n)
+	}
+	out := make([]byte, n)
+	for i := range out {
+		out[i] = byte(read(8))
+	}
+
+	if left := 8*len(data) - pos; left > 0 {
+		if read(min(4, left)) != 0 {
+			return nil, errors.New("missing terminator")
+		}
+	}
+	if pos%8 != 0 && read(8-pos%8) != 0 {
+		return nil, errors.New("non-zero bit padding")
+	}
+	for i, pad := pos/8, byte(0xEC); i < len(data); i, pad = i+1, pad^0xEC^0x11 {
+		if data[i] != pad {
+			return nil, fmt.Errorf("pad codeword %d is %#x, want %#x", i, data[i], pad)
+		}
+	}
+	return out, nil
+}
+
+func bit(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
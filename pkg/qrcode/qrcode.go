@@ -0,0 +1,507 @@
+// Package qrcode renders short byte strings, such as otpauth:// URIs, as QR
+// codes. It implements the subset of ISO/IEC 18004 needed for that: byte
+// mode, error correction level M and versions 1 to 20.
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+// ErrTooLong is returned when the data does not fit in a version 20 symbol.
+var ErrTooLong = errors.New("qrcode: data too long")
+
+const (
+	maxVersion = 20
+	// quietZone is the blank border, in modules, required around a symbol.
+	quietZone = 4
+	// formatLevelM is the two-bit error correction level in the format
+	// information; M is encoded as 00.
+	formatLevelM = 0
+)
+
+// blockLayout describes how a version's codewords split into Reed-Solomon
+// blocks at level M. Blocks in the second group hold one more data codeword.
+type blockLayout struct {
+	eccPerBlock int
+	group1      int
+	group1Data  int
+	group2      int
+}
+
+var levelM = [maxVersion + 1]blockLayout{
+	1:  {10, 1, 16, 0},
+	2:  {16, 1, 28, 0},
+	3:  {26, 1, 44, 0},
+	4:  {18, 2, 32, 0},
+	5:  {24, 2, 43, 0},
+	6:  {16, 4, 27, 0},
+	7:  {18, 4, 31, 0},
+	8:  {22, 2, 38, 2},
+	9:  {22, 3, 36, 2},
+	10: {26, 4, 43, 1},
+	11: {30, 1, 50, 4},
+	12: {22, 6, 36, 2},
+	13: {22, 8, 37, 1},
+	14: {24, 4, 40, 5},
+	15: {24, 5, 41, 5},
+	16: {28, 7, 45, 3},
+	17: {28, 10, 46, 1},
+	18: {26, 9, 43, 4},
+	19: {26, 3, 44, 11},
+	20: {26, 3, 41, 13},
+}
+
+func (l blockLayout) dataCodewords() int {
+	return l.group1*l.group1Data + l.group2*(l.group1Data+1)
+}
+
+// Code is an encoded QR symbol.
+type Code struct {
+	version  int
+	size     int
+	modules  [][]bool
+	function [][]bool
+}
+
+// Encode returns the smallest symbol that holds data.
+func Encode(data []byte) (*Code, error) {
+	version := 0
+	for v := 1; v <= maxVersion; v++ {
+		if 4+countBits(v)+8*len(data) <= 8*levelM[v].dataCodewords() {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, ErrTooLong
+	}
+
+	size := 4*version + 17
+	c := &Code{version: version, size: size}
+	c.modules = make([][]bool, size)
+	c.function = make([][]bool, size)
+	for y := range c.modules {
+		c.modules[y] = make([]bool, size)
+		c.function[y] = make([]bool, size)
+	}
+
+	c.drawFunctionPatterns()
+	c.drawCodewords(addErrorCorrection(dataCodewords(data, version), levelM[version]))
+
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		c.applyMask(mask)
+		c.drawFormatBits(mask)
+		if penalty := c.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+		c.applyMask(mask) // masking is its own inverse
+	}
+	c.applyMask(best)
+	c.drawFormatBits(best)
+
+	return c, nil
+}
+
+// Size returns the width of the symbol in modules, without the quiet zone.
+func (c *Code) Size() int {
+	return c.size
+}
+
+// Dark reports whether the module at column x, row y is dark.
+func (c *Code) Dark(x, y int) bool {
+	return c.modules[y][x]
+}
+
+// Image renders the symbol with its quiet zone, scale pixels per module.
+func (c *Code) Image(scale int) image.Image {
+	if scale < 1 {
+		scale = 1
+	}
+
+	width := (c.size + 2*quietZone) * scale
+	img := image.NewPaletted(image.Rect(0, 0, width, width), color.Palette{color.White, color.Black})
+	for y := 0; y < c.size; y++ {
+		for x := 0; x < c.size; x++ {
+			if !c.modules[y][x] {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetColorIndex((x+quietZone)*scale+dx, (y+quietZone)*scale+dy, 1)
+				}
+			}
+		}
+	}
+	return img
+}
+
+// PNG encodes data and returns the symbol as a PNG image.
+func PNG(data []byte, scale int) ([]byte, error) {
+	c, err := Encode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, c.Image(scale)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// countBits is the width of the byte mode character count indicator.
+func countBits(version int) int {
+	if version < 10 {
+		return 8
+	}
+	return 16
+}
+
+// dataCodewords builds the byte mode segment padded to the version's data
+// capacity.
+func dataCodewords(data []byte, version int) []byte {
+	var bits bitBuffer
+	bits.append(0x4, 4) // byte mode
+	bits.append(len(data), countBits(version))
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+
+	capacity := 8 * levelM[version].dataCodewords()
+	terminator := capacity - len(bits)
+	if terminator > 4 {
+		terminator = 4
+	}
+	bits.append(0, terminator)
+	bits.append(0, (8-len(bits)%8)%8)
+
+	codewords := bits.bytes()
+	for pad := byte(0xEC); len(codewords) < capacity/8; pad ^= 0xEC ^ 0x11 {
+		codewords = append(codewords, pad)
+	}
+	return codewords
+}
+
+// addErrorCorrection splits data into blocks, appends each block's
+// Reed-Solomon codewords and interleaves the result.
+func addErrorCorrection(data []byte, layout blockLayout) []byte {
+	divisor := rsDivisor(layout.eccPerBlock)
+
+	var blocks, eccs [][]byte
+	for i := 0; i < layout.group1+layout.group2; i++ {
+		n := layout.group1Data
+		if i >= layout.group1 {
+			n++
+		}
+		blocks = append(blocks, data[:n])
+		eccs = append(eccs, rsRemainder(data[:n], divisor))
+		data = data[n:]
+	}
+
+	var result []byte
+	for i := 0; i <= layout.group1Data; i++ {
+		for _, block := range blocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+	for i := 0; i < layout.eccPerBlock; i++ {
+		for _, ecc := range eccs {
+			result = append(result, ecc[i])
+		}
+	}
+	return result
+}
+
+func (c *Code) setFunction(x, y int, dark bool) {
+	c.modules[y][x] = dark
+	c.function[y][x] = true
+}
+
+func (c *Code) drawFunctionPatterns() {
+	for i := 0; i < c.size; i++ {
+		c.setFunction(6, i, i%2 == 0)
+		c.setFunction(i, 6, i%2 == 0)
+	}
+
+	c.drawFinder(3, 3)
+	c.drawFinder(c.size-4, 3)
+	c.drawFinder(3, c.size-4)
+
+	positions := alignmentPositions(c.version)
+	last := len(positions) - 1
+	for i, x := range positions {
+		for j, y := range positions {
+			// Skip the three positions covered by finder patterns.
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			c.drawAlignment(x, y)
+		}
+	}
+
+	// Reserve the format areas; the real bits are drawn once a mask is
+	// chosen.
+	c.drawFormatBits(0)
+	c.drawVersion()
+}
+
+// drawFinder draws a finder pattern and its separator centred on x, y.
+func (c *Code) drawFinder(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx < 0 || xx >= c.size || yy < 0 || yy >= c.size {
+				continue
+			}
+			dist := max(abs(dx), abs(dy))
+			c.setFunction(xx, yy, dist != 2 && dist != 4)
+		}
+	}
+}
+
+func (c *Code) drawAlignment(x, y int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			c.setFunction(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// alignmentPositions returns the row and column centres of the alignment
+// patterns for a version.
+func alignmentPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+
+	count := version/7 + 2
+	step := (version*8 + count*3 + 5) / (count*4 - 4) * 2
+	positions := make([]int, count)
+	positions[0] = 6
+	for i, pos := count-1, 4*version+10; i > 0; i, pos = i-1, pos-step {
+		positions[i] = pos
+	}
+	return positions
+}
+
+// formatBits returns the 15-bit BCH-protected format information for level
+// M and the given mask.
+func formatBits(mask int) int {
+	data := formatLevelM<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+func (c *Code) drawFormatBits(mask int) {
+	bits := formatBits(mask)
+	bit := func(i int) bool { return (bits>>i)&1 != 0 }
+
+	// Around the top-left finder.
+	for i := 0; i <= 5; i++ {
+		c.setFunction(8, i, bit(i))
+	}
+	c.setFunction(8, 7, bit(6))
+	c.setFunction(8, 8, bit(7))
+	c.setFunction(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		c.setFunction(14-i, 8, bit(i))
+	}
+
+	// Split between the other two finders.
+	for i := 0; i < 8; i++ {
+		c.setFunction(c.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		c.setFunction(8, c.size-15+i, bit(i))
+	}
+	c.setFunction(8, c.size-8, true) // the dark module
+}
+
+func (c *Code) drawVersion() {
+	if c.version < 7 {
+		return
+	}
+
+	rem := c.version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	bits := c.version<<12 | rem
+
+	for i := 0; i < 18; i++ {
+		dark := (bits>>i)&1 != 0
+		a, b := c.size-11+i%3, i/3
+		c.setFunction(a, b, dark)
+		c.setFunction(b, a, dark)
+	}
+}
+
+// drawCodewords places the codewords in the two-module-wide zigzag that
+// runs up and down from the bottom-right corner, skipping function modules.
+func (c *Code) drawCodewords(codewords []byte) {
+	i := 0
+	for right := c.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5 // the vertical timing pattern
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < c.size; vert++ {
+			y := vert
+			if upward {
+				y = c.size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if c.function[y][x] || i >= len(codewords)*8 {
+					continue
+				}
+				c.modules[y][x] = (codewords[i>>3]>>(7-i&7))&1 != 0
+				i++
+			}
+		}
+	}
+}
+
+func (c *Code) applyMask(mask int) {
+	for y := 0; y < c.size; y++ {
+		for x := 0; x < c.size; x++ {
+			if c.function[y][x] {
+				continue
+			}
+
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert {
+				c.modules[y][x] = !c.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores the symbol with the four rules used to pick a mask; lower
+// is easier to scan.
+func (c *Code) penalty() int {
+	total := 0
+	line := make([]bool, c.size)
+
+	for _, horizontal := range []bool{true, false} {
+		for i := 0; i < c.size; i++ {
+			for j := 0; j < c.size; j++ {
+				if horizontal {
+					line[j] = c.modules[i][j]
+				} else {
+					line[j] = c.modules[j][i]
+				}
+			}
+			total += linePenalty(line)
+		}
+	}
+
+	dark := 0
+	for y := 0; y < c.size; y++ {
+		for x := 0; x < c.size; x++ {
+			if c.modules[y][x] {
+				dark++
+			}
+			if x+1 < c.size && y+1 < c.size {
+				v := c.modules[y][x]
+				if v == c.modules[y][x+1] && v == c.modules[y+1][x] && v == c.modules[y+1][x+1] {
+					total += 3
+				}
+			}
+		}
+	}
+
+	percent := dark * 100 / (c.size * c.size)
+	total += abs(percent-50) / 5 * 10
+	return total
+}
+
+// finderLike is the 1:1:3:1:1 finder ratio followed by four light modules.
+var finderLike = []bool{true, false, true, true, true, false, true, false, false, false, false}
+
+// linePenalty scores runs of five or more same-coloured modules and
+// finder-like patterns in one row or column.
+func linePenalty(line []bool) int {
+	total := 0
+
+	run := 1
+	for i := 1; i <= len(line); i++ {
+		if i < len(line) && line[i] == line[i-1] {
+			run++
+			continue
+		}
+		if run >= 5 {
+			total += 3 + run - 5
+		}
+		run = 1
+	}
+
+	n := len(finderLike)
+	for i := 0; i+n <= len(line); i++ {
+		forward, backward := true, true
+		for j := 0; j < n; j++ {
+			forward = forward && line[i+j] == finderLike[j]
+			backward = backward && line[i+j] == finderLike[n-1-j]
+		}
+		if forward {
+			total += 40
+		}
+		if backward {
+			total += 40
+		}
+	}
+	return total
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+type bitBuffer []bool
+
+func (b *bitBuffer) append(value, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*b = append(*b, (value>>i)&1 != 0)
+	}
+}
+
+func (b bitBuffer) bytes() []byte {
+	out := make([]byte, len(b)/8)
+	for i, bit := range b {
+		if bit {
+			out[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	return out
+}
@@ -0,0 +1,100 @@
+package qrcode
+
+import (
+	"bytes"
+	"image/png"
+	"testing"
+)
+
+// The version 1-M "HELLO WORLD" example from the standard's annex.
+func TestReedSolomon(t *testing.T) {
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+
+	got := rsRemainder(data, rsDivisor(len(want)))
+	if !bytes.Equal(got, want) {
+		t.Fatalf("rsRemainder = %v, want %v", got, want)
+	}
+}
+
+func TestFormatBits(t *testing.T) {
+	// Level M with masks 0 and 5, from the format information table.
+	if got := formatBits(0); got != 0b101010000010010 {
+		t.Errorf("formatBits(0) = %015b", got)
+	}
+	if got := formatBits(5); got != 0b100000011001110 {
+		t.Errorf("formatBits(5) = %015b", got)
+	}
+}
+
+// Every version must account for all of its modules: data plus error
+// correction codewords and remainder bits fill what function patterns leave.
+func TestBlockLayoutsFillSymbol(t *testing.T) {
+	for version := 1; version <= maxVersion; version++ {
+		c := &Code{version: version, size: 4*version + 17}
+		c.modules = make([][]bool, c.size)
+		c.function = make([][]bool, c.size)
+		for y := range c.modules {
+			c.modules[y] = make([]bool, c.size)
+			c.function[y] = make([]bool, c.size)
+		}
+		c.drawFunctionPatterns()
+
+		free := 0
+		for _, row := range c.function {
+			for _, isFunction := range row {
+				if !isFunction {
+					free++
+				}
+			}
+		}
+
+		layout := levelM[version]
+		codewords := layout.dataCodewords() + (layout.group1+layout.group2)*layout.eccPerBlock
+		if free/8 != codewords {
+			t.Errorf("version %d: %d free modules for %d codewords", version, free, codewords)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	uri := "otpauth://totp/Mini%20Project:alice@example.com?algorithm=SHA1&digits=6&issuer=Mini+Project&period=30&secret=JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"
+
+	c, err := Encode([]byte(uri))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Size() != 4*c.version+17 || c.version < 7 {
+		t.Fatalf("unexpected version %d, size %d", c.version, c.Size())
+	}
+
+	// Finder pattern corners are dark and their separators light.
+	for _, p := range [][2]int{{0, 0}, {c.Size() - 1, 0}, {0, c.Size() - 1}} {
+		if !c.Dark(p[0], p[1]) {
+			t.Errorf("finder corner %v is light", p)
+		}
+	}
+	if c.Dark(7, 7) {
+		t.Error("separator module (7, 7) is dark")
+	}
+
+	if _, err := Encode(make([]byte, 1000)); err != ErrTooLong {
+		t.Fatalf("Encode(1000 bytes) error = %v, want ErrTooLong", err)
+	}
+}
+
+func TestPNG(t *testing.T) {
+	data, err := PNG([]byte("hello"), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Version 1 is 21 modules plus a four module quiet zone on each side.
+	if width := img.Bounds().Dx(); width != (21+8)*4 {
+		t.Fatalf("image width = %d, want %d", width, (21+8)*4)
+	}
+}
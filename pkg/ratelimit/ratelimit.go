@@ -0,0 +1,45 @@
+// Package ratelimit counts hits in fixed time windows on top of a
+// store.Store, so limits are shared by every instance using the same Redis.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/store"
+)
+
+// LimitedError reports a rejected request and when the caller may retry.
+type LimitedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LimitedError) Error() string {
+	return fmt.Sprintf("rate limit exceeded, retry in %s", e.RetryAfter.Round(time.Second))
+}
+
+type Limiter struct {
+	store store.Store
+	now   func() time.Time
+}
+
+func New(store store.Store) *Limiter {
+	return &Limiter{store: store, now: time.Now}
+}
+
+// Allow records a hit for key and returns a *LimitedError if more than limit
+// hits have been recorded in the current window.
+func (l *Limiter) Allow(ctx context.Context, key string, limit int, window time.Duration) error {
+	now := l.now()
+	start := now.Truncate(window)
+
+	count, err := l.store.Incr(ctx, fmt.Sprintf("ratelimit:%s:%d", key, start.Unix()), window)
+	if err != nil {
+		return err
+	}
+	if count > int64(limit) {
+		return &LimitedError{RetryAfter: start.Add(window).Sub(now)}
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/store"
+)
+
+func TestLimiterAllow(t *testing.T) {
+	ctx := context.Background()
+	l := New(store.NewMemoryStore())
+	now := time.Date(2024, 1, 1, 12, 0, 10, 0, time.UTC)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if err := l.Allow(ctx, "key", 3, time.Minute); err != nil {
+			t.Fatalf("hit %d: %v", i+1, err)
+		}
+	}
+
+	var limited *LimitedError
+	if err := l.Allow(ctx, "key", 3, time.Minute); !errors.As(err, &limited) {
+		t.Fatalf("hit 4: err = %v, want *LimitedError", err)
+	}
+	if limited.RetryAfter != 50*time.Second {
+		t.Fatalf("RetryAfter = %s, want 50s", limited.RetryAfter)
+	}
+
+	if err := l.Allow(ctx, "other", 3, time.Minute); err != nil {
+		t.Fatalf("other key: %v", err)
+	}
+
+	now = now.Add(50 * time.Second)
+	if err := l.Allow(ctx, "key", 3, time.Minute); err != nil {
+		t.Fatalf("next window: %v", err)
+	}
+}
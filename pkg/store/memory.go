@@ -0,0 +1,235 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	value     string
+	hash      map[string]string
+	expiresAt time.Time
+}
+
+func (e memoryEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+// MemoryStore is a thread-safe, process-local Store. Expired keys are
+// dropped lazily when they are next touched.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+	now     func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: make(map[string]memoryEntry),
+		now:     time.Now,
+	}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.lookup(key)
+	if !ok {
+		return "", ErrNotFound
+	}
+	return entry.value, nil
+}
+
+func (s *MemoryStore) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[key] = s.newEntry(value, ttl)
+	return nil
+}
+
+func (s *MemoryStore) Del(ctx context.Context, keys ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range keys {
+		delete(s.entries, key)
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetDel(ctx context.Context, key string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.lookup(key)
+	if !ok {
+		return "", ErrNotFound
+	}
+	delete(s.entries, key)
+	return entry.value, nil
+}
+
+func (s *MemoryStore) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.lookup(key)
+	if !ok {
+		entry = s.newEntry("0", ttl)
+	}
+
+	n, err := strconv.ParseInt(entry.value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("store: value of %q is not an integer", key)
+	}
+	n++
+	entry.value = strconv.FormatInt(n, 10)
+	s.entries[key] = entry
+	return n, nil
+}
+
+func (s *MemoryStore) Exists(ctx context.Context, key string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.lookup(key)
+	return ok, nil
+}
+
+func (s *MemoryStore) HSet(ctx context.Context, key, field, value string, ttl time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hash := make(map[string]string)
+	if entry, ok := s.lookup(key); ok {
+		for k, v := range entry.hash {
+			hash[k] = v
+		}
+	}
+	hash[field] = value
+
+	entry := s.newEntry("", ttl)
+	entry.hash = hash
+	s.entries[key] = entry
+	return nil
+}
+
+func (s *MemoryStore) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fields := make(map[string]string)
+	if entry, ok := s.lookup(key); ok {
+		for k, v := range entry.hash {
+			fields[k] = v
+		}
+	}
+	return fields, nil
+}
+
+func (s *MemoryStore) HDel(ctx context.Context, key string, fields ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.lookup(key)
+	if !ok {
+		return nil
+	}
+
+	hash := make(map[string]string, len(entry.hash))
+	for k, v := range entry.hash {
+		hash[k] = v
+	}
+	for _, field := range fields {
+		delete(hash, field)
+	}
+
+	if len(hash) == 0 {
+		delete(s.entries, key)
+		return nil
+	}
+	entry.hash = hash
+	s.entries[key] = entry
+	return nil
+}
+
+func (s *MemoryStore) CompareAndSwap(ctx context.Context, key, old, next string, ttl time.Duration) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.lookup(key)
+	if !ok {
+		return false, ErrNotFound
+	}
+	if entry.value != old {
+		return false, nil
+	}
+	s.entries[key] = s.newEntry(next, ttl)
+	return true, nil
+}
+
+// lookup must be called with s.mu held.
+func (s *MemoryStore) lookup(key string) (memoryEntry, bool) {
+	entry, ok := s.entries[key]
+	if !ok {
+		return memoryEntry{}, false
+	}
+	if entry.expired(s.now()) {
+		delete(s.entries, key)
+		return memoryEntry{}, false
+	}
+	return entry, true
+}
+
+func (s *MemoryStore) newEntry(value string, ttl time.Duration) memoryEntry {
+	entry := memoryEntry{value: value}
+	if ttl > 0 {
+		entry.expiresAt = s.now().Add(ttl)
+	}
+	return entry
+}
@@ -0,0 +1,121 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreExpiry(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	if err := s.Set(ctx, "key", "value", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := s.Get(ctx, "key"); err != nil || value != "value" {
+		t.Fatalf("Get = %q, %v; want %q, nil", value, err, "value")
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := s.Get(ctx, "key"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get after expiry: err = %v, want ErrNotFound", err)
+	}
+	if exists, _ := s.Exists(ctx, "key"); exists {
+		t.Fatal("expired key still exists")
+	}
+}
+
+func TestMemoryStoreCompareAndSwap(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+
+	if _, err := s.CompareAndSwap(ctx, "key", "a", "b", 0); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("CompareAndSwap on missing key: err = %v, want ErrNotFound", err)
+	}
+
+	s.Set(ctx, "key", "a", 0)
+	if swapped, err := s.CompareAndSwap(ctx, "key", "a", "b", 0); err != nil || !swapped {
+		t.Fatalf("CompareAndSwap(a→b) = %v, %v; want true, nil", swapped, err)
+	}
+	if swapped, err := s.CompareAndSwap(ctx, "key", "a", "c", 0); err != nil || swapped {
+		t.Fatalf("CompareAndSwap with stale value = %v, %v; want false, nil", swapped, err)
+	}
+	if value, _ := s.Get(ctx, "key"); value != "b" {
+		t.Fatalf("value = %q, want %q", value, "b")
+	}
+}
+
+func TestMemoryStoreGetDel(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+
+	s.Set(ctx, "key", "value", time.Minute)
+	if value, err := s.GetDel(ctx, "key"); err != nil || value != "value" {
+		t.Fatalf("GetDel = %q, %v; want %q, nil", value, err, "value")
+	}
+	if _, err := s.GetDel(ctx, "key"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("second GetDel: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemoryStoreIncr(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	for want := int64(1); want <= 3; want++ {
+		if n, err := s.Incr(ctx, "counter", time.Minute); err != nil || n != want {
+			t.Fatalf("Incr = %d, %v; want %d, nil", n, err, want)
+		}
+		now = now.Add(10 * time.Second)
+	}
+
+	// The ttl is set when the key is created, not on every increment.
+	now = now.Add(30 * time.Second)
+	if n, _ := s.Incr(ctx, "counter", time.Minute); n != 1 {
+		t.Fatalf("Incr after the window = %d, want 1", n)
+	}
+
+	s.Set(ctx, "text", "abc", 0)
+	if _, err := s.Incr(ctx, "text", 0); err == nil {
+		t.Fatal("Incr on a non-integer value succeeded")
+	}
+}
+
+func TestMemoryStoreHash(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	s.HSet(ctx, "hash", "a", "1", time.Minute)
+	now = now.Add(45 * time.Second)
+	s.HSet(ctx, "hash", "b", "2", time.Minute)
+
+	fields, err := s.HGetAll(ctx, "hash")
+	if err != nil || len(fields) != 2 || fields["a"] != "1" || fields["b"] != "2" {
+		t.Fatalf("HGetAll = %v, %v; want a=1 b=2", fields, err)
+	}
+
+	// The second write pushed the expiry out.
+	now = now.Add(45 * time.Second)
+	if fields, _ := s.HGetAll(ctx, "hash"); len(fields) != 2 {
+		t.Fatalf("HGetAll after first ttl = %v, want both fields", fields)
+	}
+
+	s.HDel(ctx, "hash", "a")
+	if fields, _ := s.HGetAll(ctx, "hash"); len(fields) != 1 || fields["b"] != "2" {
+		t.Fatalf("HGetAll after HDel = %v, want only b", fields)
+	}
+
+	now = now.Add(time.Minute)
+	if fields, _ := s.HGetAll(ctx, "hash"); len(fields) != 0 {
+		t.Fatalf("HGetAll after expiry = %v, want empty", fields)
+	}
+}
@@ -0,0 +1,155 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var compareAndSwapScript = redis.NewScript(`
+local current = redis.call("GET", KEYS[1])
+if not current then
+	return -1
+end
+if current ~= ARGV[1] then
+	return 0
+end
+if tonumber(ARGV[3]) > 0 then
+	redis.call("SET", KEYS[1], ARGV[2], "PX", ARGV[3])
+else
+	redis.call("SET", KEYS[1], ARGV[2])
+end
+return 1
+`)
+
+var incrScript = redis.NewScript(`
+local n = redis.call("INCR", KEYS[1])
+if n == 1 and tonumber(ARGV[1]) > 0 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return n
+`)
+
+type RedisStore struct {
+	client  *redis.Client
+	timeout time.Duration
+}
+
+// NewRedisStore wraps client. Every operation is bounded by timeout in
+// addition to the caller's context; a zero timeout relies on the caller alone.
+func NewRedisStore(client *redis.Client, timeout time.Duration) *RedisStore {
+	return &RedisStore{client: client, timeout: timeout}
+}
+
+func (s *RedisStore) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, s.timeout)
+}
+
+func (s *RedisStore) Get(ctx context.Context, key string) (string, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	value, err := s.client.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", ErrNotFound
+	}
+	return value, err
+}
+
+func (s *RedisStore) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.client.Set(ctx, key, value, ttl).Err()
+}
+
+func (s *RedisStore) Del(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.client.Del(ctx, keys...).Err()
+}
+
+// GetDel needs Redis 6.2 or later.
+func (s *RedisStore) GetDel(ctx context.Context, key string) (string, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	value, err := s.client.GetDel(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", ErrNotFound
+	}
+	return value, err
+}
+
+func (s *RedisStore) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return incrScript.Run(ctx, s.client, []string{key}, ttl.Milliseconds()).Int64()
+}
+
+func (s *RedisStore) Exists(ctx context.Context, key string) (bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	n, err := s.client.Exists(ctx, key).Result()
+	return n > 0, err
+}
+
+func (s *RedisStore) HSet(ctx context.Context, key, field, value string, ttl time.Duration) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, field, value)
+		if ttl > 0 {
+			pipe.PExpire(ctx, key, ttl)
+		} else {
+			pipe.Persist(ctx, key)
+		}
+		return nil
+	})
+	return err
+}
+
+func (s *RedisStore) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.client.HGetAll(ctx, key).Result()
+}
+
+func (s *RedisStore) HDel(ctx context.Context, key string, fields ...string) error {
+	if len(fields) == 0 {
+		return nil
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	return s.client.HDel(ctx, key, fields...).Err()
+}
+
+func (s *RedisStore) CompareAndSwap(ctx context.Context, key, old, next string, ttl time.Duration) (bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	result, err := compareAndSwapScript.Run(ctx, s.client, []string{key}, old, next, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	if result < 0 {
+		return false, ErrNotFound
+	}
+	return result == 1, nil
+}
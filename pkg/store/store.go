@@ -0,0 +1,42 @@
+// Package store abstracts the small set of key/value operations the services
+// need from Redis, so they can run against an in-memory implementation in
+// tests and local development.
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrNotFound = errors.New("store: key not found")
+
+type Store interface {
+	// Get returns ErrNotFound if the key does not exist.
+	Get(ctx context.Context, key string) (string, error)
+	// Set stores value under key. A zero ttl keeps the key forever.
+	Set(ctx context.Context, key, value string, ttl time.Duration) error
+	Del(ctx context.Context, keys ...string) error
+	// GetDel returns the value of key and deletes it atomically, so only one
+	// caller can ever observe it. It returns ErrNotFound if the key does not
+	// exist.
+	GetDel(ctx context.Context, key string) (string, error)
+	// Incr atomically increments the integer stored at key, treating a
+	// missing key as 0, and returns the new value. When Incr creates the key
+	// it expires after ttl; a zero ttl keeps it forever. Later increments
+	// leave the expiry alone, which makes fixed-window counters easy.
+	Incr(ctx context.Context, key string, ttl time.Duration) (int64, error)
+	Exists(ctx context.Context, key string) (bool, error)
+	// HSet sets field of the hash at key and resets the hash's ttl, so a hash
+	// lives for ttl after its last write. A zero ttl keeps it forever.
+	HSet(ctx context.Context, key, field, value string, ttl time.Duration) error
+	// HGetAll returns every field of the hash at key, or an empty map if the
+	// key does not exist.
+	HGetAll(ctx context.Context, key string) (map[string]string, error)
+	// HDel removes fields from the hash at key.
+	HDel(ctx context.Context, key string, fields ...string) error
+	// CompareAndSwap replaces the value of key with next, resetting its ttl,
+	// only if the current value equals old. It returns ErrNotFound if the key
+	// does not exist and false if the current value differs.
+	CompareAndSwap(ctx context.Context, key, old, next string, ttl time.Duration) (bool, error)
+}
@@ -0,0 +1,266 @@
+// Package textdiff compares texts line by line or word by word with the
+// Myers algorithm, and renders line diffs in unified format.
+package textdiff
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+const (
+	Equal  = "equal"
+	Insert = "insert"
+	Delete = "delete"
+)
+
+// maxEdits bounds the work and memory of a diff. Texts further apart than
+// this are reported as one deletion followed by one insertion.
+const maxEdits = 2000
+
+// Edit is a run of text that both sides share, or that only the new or the
+// old side has.
+type Edit struct {
+	Kind string
+	Text string
+}
+
+// Lines diffs a and b line by line. Each edit holds one or more whole lines
+// including their newlines.
+func Lines(a, b string) []Edit {
+	return merge(diff(splitLines(a), splitLines(b)))
+}
+
+// Words diffs a and b word by word. Whitespace runs are tokens of their own,
+// so concatenating the Equal and Delete edits gives back a, and the Equal
+// and Insert edits give back b.
+func Words(a, b string) []Edit {
+	return merge(diff(splitWords(a), splitWords(b)))
+}
+
+// Unified renders the line diff of a and b in unified format with context
+// lines around each change. It returns "" when the texts are equal.
+func Unified(fromName, toName, a, b string, context int) string {
+	ops := diff(splitLines(a), splitLines(b))
+
+	var out strings.Builder
+	for _, h := range hunks(ops, context) {
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(h.fromLine, h.fromCount), hunkRange(h.toLine, h.toCount))
+		for _, op := range h.ops {
+			prefix := " "
+			switch op.Kind {
+			case Insert:
+				prefix = "+"
+			case Delete:
+				prefix = "-"
+			}
+			out.WriteString(prefix + op.Text)
+			if !strings.HasSuffix(op.Text, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+	}
+	return out.String()
+}
+
+type hunk struct {
+	fromLine, fromCount int
+	toLine, toCount     int
+	ops                 []Edit
+}
+
+// hunks groups single-line ops into hunks of changes with up to context
+// unchanged lines on either side; changes closer than 2*context apart share
+// a hunk.
+func hunks(ops []Edit, context int) []hunk {
+	// fromAt[i] and toAt[i] are the line numbers ops[i] starts at.
+	fromAt, toAt := make([]int, len(ops)), make([]int, len(ops))
+	var changes []int
+	fromLine, toLine := 1, 1
+	for i, op := range ops {
+		fromAt[i], toAt[i] = fromLine, toLine
+		if op.Kind != Delete {
+			toLine++
+		}
+		if op.Kind != Insert {
+			fromLine++
+		}
+		if op.Kind != Equal {
+			changes = append(changes, i)
+		}
+	}
+
+	var result []hunk
+	for c := 0; c < len(changes); {
+		last := c
+		for last+1 < len(changes) && changes[last+1]-changes[last] <= 2*context {
+			last++
+		}
+		start := max(changes[c]-context, 0)
+		end := min(changes[last]+context+1, len(ops))
+
+		h := hunk{fromLine: fromAt[start], toLine: toAt[start], ops: ops[start:end]}
+		for _, op := range h.ops {
+			if op.Kind != Insert {
+				h.fromCount++
+			}
+			if op.Kind != Delete {
+				h.toCount++
+			}
+		}
+		result = append(result, h)
+		c = last + 1
+	}
+	return result
+}
+
+// hunkRange formats a hunk header range. An empty range names the line
+// before it, as diff -u does.
+func hunkRange(line, count int) string {
+	if count == 0 {
+		line--
+	}
+	if count == 1 {
+		return fmt.Sprint(line)
+	}
+	return fmt.Sprintf("%d,%d", line, count)
+}
+
+// diff returns the shortest edit script turning a into b, one op per token.
+func diff(a, b []string) []Edit {
+	n, m := len(a), len(b)
+	limit := min(n+m, maxEdits)
+	offset := limit + 1
+	v := make([]int, 2*limit+3)
+
+	// trace[d] holds v[-d..d] as it was before step d, for backtracking.
+	var trace [][]int
+	for d := 0; d <= limit; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(a, b, trace)
+			}
+		}
+	}
+
+	ops := make([]Edit, 0, n+m)
+	for _, token := range a {
+		ops = append(ops, Edit{Delete, token})
+	}
+	for _, token := range b {
+		ops = append(ops, Edit{Insert, token})
+	}
+	return ops
+}
+
+func backtrack(a, b []string, trace [][]int) []Edit {
+	var ops []Edit
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d >= 0; d-- {
+		at := func(k int) int { return trace[d][k+d] }
+		k := x - y
+
+		prevK := k - 1
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		}
+		prevX := 0
+		if d > 0 {
+			prevX = at(prevK)
+		}
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			ops = append(ops, Edit{Equal, a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				ops = append(ops, Edit{Insert, b[y-1]})
+			} else {
+				ops = append(ops, Edit{Delete, a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// merge joins neighbouring ops of the same kind and, within a change,
+// puts deletions before insertions.
+func merge(ops []Edit) []Edit {
+	var merged []Edit
+	for i := 0; i < len(ops); {
+		if ops[i].Kind == Equal {
+			var text strings.Builder
+			for ; i < len(ops) && ops[i].Kind == Equal; i++ {
+				text.WriteString(ops[i].Text)
+			}
+			merged = append(merged, Edit{Equal, text.String()})
+			continue
+		}
+
+		var deleted, inserted strings.Builder
+		for ; i < len(ops) && ops[i].Kind != Equal; i++ {
+			if ops[i].Kind == Delete {
+				deleted.WriteString(ops[i].Text)
+			} else {
+				inserted.WriteString(ops[i].Text)
+			}
+		}
+		if deleted.Len() > 0 {
+			merged = append(merged, Edit{Delete, deleted.String()})
+		}
+		if inserted.Len() > 0 {
+			merged = append(merged, Edit{Insert, inserted.String()})
+		}
+	}
+	return merged
+}
+
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// splitWords splits s into alternating runs of whitespace and of other
+// characters.
+func splitWords(s string) []string {
+	var tokens []string
+	start, space := 0, false
+	for i, r := range s {
+		if i > start && unicode.IsSpace(r) != space {
+			tokens = append(tokens, s[start:i])
+			start = i
+		}
+		space = unicode.IsSpace(r)
+	}
+	if start < len(s) {
+		tokens = append(tokens, s[start:])
+	}
+	return tokens
+}
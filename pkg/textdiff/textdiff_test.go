@@ -0,0 +1,90 @@
+package textdiff
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWords(t *testing.T) {
+	got := Words("the quick brown fox", "the slow brown dog jumps")
+	want := []Edit{
+		{Equal, "the "},
+		{Delete, "quick"},
+		{Insert, "slow"},
+		{Equal, " brown "},
+		{Delete, "fox"},
+		{Insert, "dog jumps"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Words = %q, want %q", got, want)
+	}
+}
+
+func TestEditsRebuildBothSides(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	words := []string{"a", "b", "c", "d", " ", "\n", "é"}
+	random := func() string {
+		var b strings.Builder
+		for i := rng.Intn(30); i > 0; i-- {
+			b.WriteString(words[rng.Intn(len(words))])
+		}
+		return b.String()
+	}
+
+	for i := 0; i < 500; i++ {
+		a, b := random(), random()
+		for _, edits := range [][]Edit{Words(a, b), Lines(a, b)} {
+			var from, to strings.Builder
+			for _, e := range edits {
+				if e.Kind != Insert {
+					from.WriteString(e.Text)
+				}
+				if e.Kind != Delete {
+					to.WriteString(e.Text)
+				}
+			}
+			if from.String() != a || to.String() != b {
+				t.Fatalf("edits %q rebuild %q -> %q, want %q -> %q", edits, from.String(), to.String(), a, b)
+			}
+		}
+	}
+}
+
+func TestUnified(t *testing.T) {
+	a := "one\ntwo\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\n"
+	b := "one\ntwo\nTHREE\nfour\nfive\nsix\nseven\neight\nnine\nten\neleven"
+	want := `--- revision 1
++++ revision 2
+@@ -1,6 +1,6 @@
+ one
+ two
+-three
++THREE
+ four
+ five
+ six
+@@ -8,3 +8,4 @@
+ eight
+ nine
+ ten
++eleven
+\ No newline at end of file
+`
+	if got := Unified("revision 1", "revision 2", a, b, 3); got != want {
+		t.Fatalf("Unified =\n%s\nwant\n%s", got, want)
+	}
+	if got := Unified("a", "b", a, a, 3); got != "" {
+		t.Fatalf("Unified of equal texts = %q, want empty", got)
+	}
+}
+
+func TestLargeDiffFallsBack(t *testing.T) {
+	a := strings.Repeat("x ", maxEdits)
+	b := strings.Repeat("y ", maxEdits)
+	edits := Words(a, b)
+	if len(edits) != 2 || edits[0] != (Edit{Delete, a}) || edits[1] != (Edit{Insert, b}) {
+		t.Fatalf("Words of distant texts = %d edits, want one deletion and one insertion", len(edits))
+	}
+}
@@ -0,0 +1,68 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The SHA-1 vectors from RFC 6238 appendix B, truncated to six digits.
+func TestCodeMatchesRFC6238(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		got, err := Code(secret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateAllowsSkew(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1700000000, 0)
+	previous, _ := Code(secret, Step(now)-1)
+
+	step, ok := Validate(secret, previous, now, 1)
+	if !ok || step != Step(now)-1 {
+		t.Fatalf("Validate(previous step, skew 1) = %d, %v; want %d, true", step, ok, Step(now)-1)
+	}
+	if _, ok := Validate(secret, previous, now, 0); ok {
+		t.Fatal("Validate accepted the previous step with no skew")
+	}
+	if _, ok := Validate(secret, "12345", now, 1); ok {
+		t.Fatal("Validate accepted a short code")
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("Mini Project", "alice@example.com", "JBSWY3DPEHPK3PXP")
+
+	if !strings.HasPrefix(uri, "otpauth://totp/Mini%20Project:alice@example.com?") {
+		t.Fatalf("unexpected label in %s", uri)
+	}
+	for _, param := range []string{"secret=JBSWY3DPEHPK3PXP", "issuer=Mini+Project", "digits=6", "period=30"} {
+		if !strings.Contains(uri, param) {
+			t.Errorf("%s is missing %s", uri, param)
+		}
+	}
+}
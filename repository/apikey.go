@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/tamabsndra/miniproject/miniproject-backend/models"
+)
+
+const apiKeyColumns = "id, user_id, name, prefix, key_hash, scopes, expires_at, last_used_at, last_used_ip, created_at"
+
+type PostgresAPIKeyRepository struct {
+	db           *sql.DB
+	queryTimeout time.Duration
+}
+
+func NewAPIKeyRepository(db *sql.DB, queryTimeout time.Duration) *PostgresAPIKeyRepository {
+	return &PostgresAPIKeyRepository{db: db, queryTimeout: queryTimeout}
+}
+
+func (r *PostgresAPIKeyRepository) Create(ctx context.Context, key *models.APIKey) (err error) {
+	ctx, finish := withQueryTimeout(ctx, r.queryTimeout)
+	defer finish(&err)
+
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`,
+		key.UserID, key.Name, key.Prefix, key.KeyHash, pq.Array(key.Scopes), key.ExpiresAt,
+	).Scan(&key.ID, &key.CreatedAt)
+}
+
+func (r *PostgresAPIKeyRepository) GetByHash(ctx context.Context, keyHash string) (_ *models.APIKey, err error) {
+	ctx, finish := withQueryTimeout(ctx, r.queryTimeout)
+	defer finish(&err)
+
+	key, err := scanAPIKey(r.db.QueryRowContext(ctx,
+		"SELECT "+apiKeyColumns+" FROM api_keys WHERE key_hash = $1",
+		keyHash,
+	))
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r *PostgresAPIKeyRepository) ListByUser(ctx context.Context, userID uint) (_ []models.APIKey, err error) {
+	ctx, finish := withQueryTimeout(ctx, r.queryTimeout)
+	defer finish(&err)
+
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT "+apiKeyColumns+" FROM api_keys WHERE user_id = $1 ORDER BY created_at DESC, id DESC",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (r *PostgresAPIKeyRepository) Delete(ctx context.Context, userID, id uint) (err error) {
+	ctx, finish := withQueryTimeout(ctx, r.queryTimeout)
+	defer finish(&err)
+
+	result, err := r.db.ExecContext(ctx, "DELETE FROM api_keys WHERE id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *PostgresAPIKeyRepository) Touch(ctx context.Context, id uint, ip string, at time.Time) (err error) {
+	ctx, finish := withQueryTimeout(ctx, r.queryTimeout)
+	defer finish(&err)
+
+	_, err = r.db.ExecContext(ctx,
+		"UPDATE api_keys SET last_used_at = $2, last_used_ip = $3 WHERE id = $1",
+		id, at, ip,
+	)
+	return err
+}
+
+func scanAPIKey(row rowScanner) (models.APIKey, error) {
+	var key models.APIKey
+	err := row.Scan(
+		&key.ID,
+		&key.UserID,
+		&key.Name,
+		&key.Prefix,
+		&key.KeyHash,
+		pq.Array(&key.Scopes),
+		&key.ExpiresAt,
+		&key.LastUsedAt,
+		&key.LastUsedIP,
+		&key.CreatedAt,
+	)
+	return key, err
+}
@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/tamabsndra/miniproject/miniproject-backend/models"
+)
+
+type PostgresIdentityRepository struct {
+	db           *sql.DB
+	queryTimeout time.Duration
+}
+
+func NewIdentityRepository(db *sql.DB, queryTimeout time.Duration) *PostgresIdentityRepository {
+	return &PostgresIdentityRepository{db: db, queryTimeout: queryTimeout}
+}
+
+func (r *PostgresIdentityRepository) Get(ctx context.Context, provider, subject string) (_ *models.UserIdentity, err error) {
+	ctx, finish := withQueryTimeout(ctx, r.queryTimeout)
+	defer finish(&err)
+
+	var identity models.UserIdentity
+	err = r.db.QueryRowContext(ctx,
+		"SELECT id, user_id, provider, subject, email, created_at FROM user_identities WHERE provider = $1 AND subject = $2",
+		provider, subject,
+	).Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email, &identity.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func (r *PostgresIdentityRepository) Create(ctx context.Context, identity *models.UserIdentity) (err error) {
+	ctx, finish := withQueryTimeout(ctx, r.queryTimeout)
+	defer finish(&err)
+
+	return r.db.QueryRowContext(ctx, `
+		INSERT INTO user_identities (user_id, provider, subject, email)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`,
+		identity.UserID, identity.Provider, identity.Subject, identity.Email,
+	).Scan(&identity.ID, &identity.CreatedAt)
+}
@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tamabsndra/miniproject/miniproject-backend/models"
+)
+
+// MemoryAPIKeyRepository is a process-local APIKeyRepository for tests and
+// local development.
+type MemoryAPIKeyRepository struct {
+	mu     sync.RWMutex
+	keys   map[uint]models.APIKey
+	nextID uint
+}
+
+func NewMemoryAPIKeyRepository() *MemoryAPIKeyRepository {
+	return &MemoryAPIKeyRepository{
+		keys:   make(map[uint]models.APIKey),
+		nextID: 1,
+	}
+}
+
+func (r *MemoryAPIKeyRepository) Create(ctx context.Context, key *models.APIKey) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key.ID = r.nextID
+	key.CreatedAt = time.Now()
+	r.nextID++
+	r.keys[key.ID] = copyAPIKey(*key)
+	return nil
+}
+
+func (r *MemoryAPIKeyRepository) GetByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, key := range r.keys {
+		if key.KeyHash == keyHash {
+			key = copyAPIKey(key)
+			return &key, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r *MemoryAPIKeyRepository) ListByUser(ctx context.Context, userID uint) ([]models.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	keys := []models.APIKey{}
+	for _, key := range r.keys {
+		if key.UserID == userID {
+			keys = append(keys, copyAPIKey(key))
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID > keys[j].ID })
+	return keys, nil
+}
+
+func (r *MemoryAPIKeyRepository) Delete(ctx context.Context, userID, id uint) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.keys[id]
+	if !ok || key.UserID != userID {
+		return sql.ErrNoRows
+	}
+	delete(r.keys, id)
+	return nil
+}
+
+func (r *MemoryAPIKeyRepository) Touch(ctx context.Context, id uint, ip string, at time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.keys[id]
+	if !ok {
+		return nil
+	}
+	key.LastUsedAt = &at
+	key.LastUsedIP = ip
+	r.keys[id] = key
+	return nil
+}
+
+func copyAPIKey(key models.APIKey) models.APIKey {
+	key.Scopes = append([]string(nil), key.Scopes...)
+	return key
+}
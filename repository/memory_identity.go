@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/tamabsndra/miniproject/miniproject-backend/models"
+)
+
+var ErrDuplicateIdentity = errors.New("identity already linked")
+
+// MemoryIdentityRepository is a process-local IdentityRepository for tests
+// and local development.
+type MemoryIdentityRepository struct {
+	mu         sync.RWMutex
+	identities map[string]models.UserIdentity
+	nextID     uint
+}
+
+func NewMemoryIdentityRepository() *MemoryIdentityRepository {
+	return &MemoryIdentityRepository{
+		identities: make(map[string]models.UserIdentity),
+		nextID:     1,
+	}
+}
+
+func (r *MemoryIdentityRepository) Get(ctx context.Context, provider, subject string) (*models.UserIdentity, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	identity, ok := r.identities[identityKey(provider, subject)]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &identity, nil
+}
+
+func (r *MemoryIdentityRepository) Create(ctx context.Context, identity *models.UserIdentity) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := identityKey(identity.Provider, identity.Subject)
+	if _, ok := r.identities[key]; ok {
+		return ErrDuplicateIdentity
+	}
+
+	identity.ID = r.nextID
+	identity.CreatedAt = time.Now()
+	r.nextID++
+	r.identities[key] = *identity
+	return nil
+}
+
+func identityKey(provider, subject string) string {
+	return provider + "\x00" + subject
+}
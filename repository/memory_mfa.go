@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/tamabsndra/miniproject/miniproject-backend/models"
+)
+
+// MemoryMFARepository is a process-local MFARepository for tests and local
+// development.
+type MemoryMFARepository struct {
+	mu          sync.RWMutex
+	enrollments map[uint]models.TOTPEnrollment
+	// recoveryCodes maps user ID to code hash to whether it has been used.
+	recoveryCodes map[uint]map[string]bool
+}
+
+func NewMemoryMFARepository() *MemoryMFARepository {
+	return &MemoryMFARepository{
+		enrollments:   make(map[uint]models.TOTPEnrollment),
+		recoveryCodes: make(map[uint]map[string]bool),
+	}
+}
+
+func (r *MemoryMFARepository) GetTOTP(ctx context.Context, userID uint) (*models.TOTPEnrollment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	enrollment, ok := r.enrollments[userID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &enrollment, nil
+}
+
+func (r *MemoryMFARepository) SavePendingTOTP(ctx context.Context, userID uint, secret string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if existing, ok := r.enrollments[userID]; ok && existing.EnabledAt != nil {
+		return sql.ErrNoRows
+	}
+	r.enrollments[userID] = models.TOTPEnrollment{UserID: userID, Secret: secret, CreatedAt: time.Now()}
+	return nil
+}
+
+func (r *MemoryMFARepository) EnableTOTP(ctx context.Context, userID uint, recoveryCodeHashes []string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	enrollment, ok := r.enrollments[userID]
+	if !ok || enrollment.EnabledAt != nil {
+		return sql.ErrNoRows
+	}
+
+	now := time.Now()
+	enrollment.EnabledAt = &now
+	r.enrollments[userID] = enrollment
+
+	codes := make(map[string]bool, len(recoveryCodeHashes))
+	for _, hash := range recoveryCodeHashes {
+		codes[hash] = false
+	}
+	r.recoveryCodes[userID] = codes
+	return nil
+}
+
+func (r *MemoryMFARepository) DeleteTOTP(ctx context.Context, userID uint) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.enrollments[userID]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(r.enrollments, userID)
+	delete(r.recoveryCodes, userID)
+	return nil
+}
+
+func (r *MemoryMFARepository) UseRecoveryCode(ctx context.Context, userID uint, codeHash string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	used, ok := r.recoveryCodes[userID][codeHash]
+	if !ok || used {
+		return sql.ErrNoRows
+	}
+	r.recoveryCodes[userID][codeHash] = true
+	return nil
+}
@@ -0,0 +1,595 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"html"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/tamabsndra/miniproject/miniproject-backend/models"
+)
+
+// MemoryPostRepository is a thread-safe, process-local PostRepository for
+// tests and local development. It joins authors from users.
+type MemoryPostRepository struct {
+	mu        sync.RWMutex
+	posts     map[uint]models.Post
+	revisions map[uint][]models.PostRevision
+	nextID    uint
+	users     *MemoryUserRepository
+}
+
+func NewMemoryPostRepository(users *MemoryUserRepository) *MemoryPostRepository {
+	return &MemoryPostRepository{
+		posts:     make(map[uint]models.Post),
+		revisions: make(map[uint][]models.PostRevision),
+		nextID:    1,
+		users:     users,
+	}
+}
+
+func (r *MemoryPostRepository) Create(ctx context.Context, post *models.Post) (*models.Post, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users.get(post.UserID); !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	now := time.Now()
+	post.ID = r.nextID
+	post.CreatedAt = now
+	post.UpdatedAt = now
+	r.nextID++
+
+	r.posts[post.ID] = *post
+	r.addRevision(*post, post.UserID)
+	return post, nil
+}
+
+func (r *MemoryPostRepository) GetAll(ctx context.Context, q models.PostListQuery) (*models.PostPage, error) {
+	posts, info, err := r.list(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	return &models.PostPage{Data: posts, Pagination: *info}, nil
+}
+
+func (r *MemoryPostRepository) GetByID(ctx context.Context, id uint) (*models.Post, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	post, ok := r.posts[id]
+	if !ok || post.DeletedAt != nil {
+		return nil, sql.ErrNoRows
+	}
+	return &post, nil
+}
+
+func (r *MemoryPostRepository) GetByUserID(ctx context.Context, userID uint, q models.PostListQuery) (*models.PostPage, error) {
+	q.AuthorID = userID
+	return r.GetAll(ctx, q)
+}
+
+func (r *MemoryPostRepository) Update(ctx context.Context, id, editorID uint, req models.UpdatePostRequest) (*models.Post, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	post, ok := r.posts[id]
+	if !ok || post.DeletedAt != nil {
+		return nil, sql.ErrNoRows
+	}
+
+	post.Title = req.Title
+	post.Content = req.Content
+	post.UpdatedAt = time.Now()
+	r.posts[id] = post
+	r.addRevision(post, editorID)
+	return &post, nil
+}
+
+func (r *MemoryPostRepository) ListRevisions(ctx context.Context, postID uint) ([]models.PostRevision, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	stored := r.revisions[postID]
+	revisions := make([]models.PostRevision, 0, len(stored))
+	for i := len(stored) - 1; i >= 0; i-- {
+		revisions = append(revisions, stored[i])
+	}
+	return revisions, nil
+}
+
+func (r *MemoryPostRepository) GetRevision(ctx context.Context, postID uint, revision int) (*models.PostRevision, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	stored := r.revisions[postID]
+	if revision < 1 || revision > len(stored) {
+		return nil, sql.ErrNoRows
+	}
+	result := stored[revision-1]
+	return &result, nil
+}
+
+// addRevision records post's current title and content as its next
+// revision. The caller holds r.mu.
+func (r *MemoryPostRepository) addRevision(post models.Post, editorID uint) {
+	editor := editorID
+	r.revisions[post.ID] = append(r.revisions[post.ID], models.PostRevision{
+		PostID:    post.ID,
+		Revision:  len(r.revisions[post.ID]) + 1,
+		EditorID:  &editor,
+		Title:     post.Title,
+		Content:   post.Content,
+		CreatedAt: post.UpdatedAt,
+	})
+}
+
+func (r *MemoryPostRepository) SetStatus(ctx context.Context, id uint, status string, publishedAt *time.Time) (*models.Post, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	post, ok := r.posts[id]
+	if !ok || post.DeletedAt != nil {
+		return nil, sql.ErrNoRows
+	}
+
+	post.Status = status
+	post.PublishedAt = publishedAt
+	r.posts[id] = post
+	return &post, nil
+}
+
+func (r *MemoryPostRepository) PublishDue(ctx context.Context, now time.Time) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var published int64
+	for id, post := range r.posts {
+		if post.Status == models.PostStatusScheduled && !post.PublishedAt.After(now) && post.DeletedAt == nil {
+			post.Status = models.PostStatusPublished
+			r.posts[id] = post
+			published++
+		}
+	}
+	return published, nil
+}
+
+func (r *MemoryPostRepository) Delete(ctx context.Context, id uint) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	post, ok := r.posts[id]
+	if !ok || post.DeletedAt != nil {
+		return sql.ErrNoRows
+	}
+	now := time.Now()
+	post.DeletedAt = &now
+	r.posts[id] = post
+	return nil
+}
+
+func (r *MemoryPostRepository) Remove(ctx context.Context, id uint) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	post, ok := r.posts[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if post.DeletedAt == nil {
+		now := time.Now()
+		post.DeletedAt = &now
+	}
+	post.RemovedByModerator = true
+	r.posts[id] = post
+	return nil
+}
+
+func (r *MemoryPostRepository) GetTrashed(ctx context.Context, id uint) (*models.Post, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	post, ok := r.posts[id]
+	if !ok || post.DeletedAt == nil {
+		return nil, sql.ErrNoRows
+	}
+	return &post, nil
+}
+
+func (r *MemoryPostRepository) Restore(ctx context.Context, id uint) (*models.Post, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	post, ok := r.posts[id]
+	if !ok || post.DeletedAt == nil || post.RemovedByModerator {
+		return nil, sql.ErrNoRows
+	}
+	post.DeletedAt = nil
+	r.posts[id] = post
+	return &post, nil
+}
+
+func (r *MemoryPostRepository) Purge(ctx context.Context, id uint) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	post, ok := r.posts[id]
+	if !ok || post.DeletedAt == nil {
+		return sql.ErrNoRows
+	}
+	delete(r.posts, id)
+	delete(r.revisions, id)
+	return nil
+}
+
+func (r *MemoryPostRepository) PurgeDeletedBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var purged int64
+	for id, post := range r.posts {
+		if post.DeletedAt != nil && post.DeletedAt.Before(cutoff) {
+			delete(r.posts, id)
+			delete(r.revisions, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (r *MemoryPostRepository) GetPostDetail(ctx context.Context, q models.PostListQuery) (*models.PostWithUserPage, error) {
+	posts, info, err := r.list(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	details := make([]models.PostWithUser, 0, len(posts))
+	for _, post := range posts {
+		user, _ := r.users.get(post.UserID)
+		details = append(details, models.PostWithUser{
+			Post: post,
+			User: models.UserInPost{ID: user.ID, Name: user.Name, Email: user.Email},
+		})
+	}
+	return &models.PostWithUserPage{Data: details, Pagination: *info}, nil
+}
+
+// Search approximates the Postgres full-text search: posts match when they
+// contain every query word (as a prefix in prefix mode), and are ranked by
+// how often the words occur, with title hits counting double.
+func (r *MemoryPostRepository) Search(ctx context.Context, q models.PostSearchQuery) (*models.PostSearchPage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	limit, offset := offsetPage(q.Limit, q.Offset)
+
+	page := &models.PostSearchPage{
+		Data:       []models.PostSearchResult{},
+		Pagination: models.PageInfo{Limit: limit, Offset: offset},
+	}
+
+	terms := searchWords(q.Q)
+	if len(terms) == 0 {
+		return page, nil
+	}
+	prefix := q.Mode == "prefix"
+	phrase := q.Mode == "phrase"
+
+	r.mu.RLock()
+	var results []models.PostSearchResult
+	for _, post := range r.posts {
+		if post.DeletedAt != nil || !visibleTo(post, q.ViewerID) {
+			continue
+		}
+		titleHits := countMatches(post.Title, terms, prefix)
+		contentHits := countMatches(post.Content, terms, prefix)
+		if phrase {
+			if !containsPhrase(post.Title, terms) && !containsPhrase(post.Content, terms) {
+				continue
+			}
+		} else if !matchesAll(post.Title+" "+post.Content, terms, prefix) {
+			continue
+		}
+		results = append(results, models.PostSearchResult{
+			Post:           post,
+			Rank:           float64(2*titleHits + contentHits),
+			TitleHighlight: highlight(post.Title, terms, prefix),
+			Snippet:        highlight(post.Content, terms, prefix),
+		})
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Rank != results[j].Rank {
+			return results[i].Rank > results[j].Rank
+		}
+		return results[i].ID > results[j].ID
+	})
+
+	page.Pagination.Total = int64(len(results))
+	if offset < len(results) {
+		end := offset + limit
+		if end > len(results) {
+			end = len(results)
+		}
+		page.Data = append(page.Data, results[offset:end]...)
+	}
+	return page, nil
+}
+
+func (r *MemoryPostRepository) list(ctx context.Context, q models.PostListQuery) ([]models.Post, *models.PageInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	plan, err := newPostListPlan(q)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var after func(models.Post) bool
+	if plan.cursor != nil {
+		value, err := cursorValue(plan.sortBy, plan.cursor.Value)
+		if err != nil {
+			return nil, nil, err
+		}
+		after = func(post models.Post) bool {
+			cmp := comparePostKey(post, plan.sortBy, value, plan.cursor.ID)
+			if plan.scanDescending() {
+				return cmp < 0
+			}
+			return cmp > 0
+		}
+	}
+
+	r.mu.RLock()
+	var matched []models.Post
+	for _, post := range r.posts {
+		if matchesListQuery(post, plan.query) {
+			matched = append(matched, post)
+		}
+	}
+	r.mu.RUnlock()
+
+	total := int64(len(matched))
+
+	sort.Slice(matched, func(i, j int) bool {
+		cmp := comparePosts(matched[i], matched[j], plan.sortBy)
+		if plan.scanDescending() {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+
+	var window []models.Post
+	skipped := 0
+	for _, post := range matched {
+		if after != nil && !after(post) {
+			continue
+		}
+		if skipped < plan.offset {
+			skipped++
+			continue
+		}
+		window = append(window, post)
+		if len(window) > plan.limit {
+			break
+		}
+	}
+
+	posts, info := finishPage(plan, window, total, func(post models.Post) models.Post {
+		return post
+	})
+	if posts == nil {
+		posts = []models.Post{}
+	}
+	return posts, info, nil
+}
+
+func matchesListQuery(post models.Post, q models.PostListQuery) bool {
+	if (post.DeletedAt != nil) != q.Trashed {
+		return false
+	}
+	if q.AuthorID != 0 && post.UserID != q.AuthorID {
+		return false
+	}
+	if q.Title != "" && !strings.Contains(strings.ToLower(post.Title), strings.ToLower(q.Title)) {
+		return false
+	}
+	if q.CreatedFrom != nil && post.CreatedAt.Before(*q.CreatedFrom) {
+		return false
+	}
+	if q.CreatedTo != nil && post.CreatedAt.After(*q.CreatedTo) {
+		return false
+	}
+	if q.UpdatedFrom != nil && post.UpdatedAt.Before(*q.UpdatedFrom) {
+		return false
+	}
+	if q.UpdatedTo != nil && post.UpdatedAt.After(*q.UpdatedTo) {
+		return false
+	}
+	if q.Status != "" && post.Status != q.Status {
+		return false
+	}
+	return visibleTo(post, q.ViewerID)
+}
+
+// visibleTo reports whether viewer may see post; viewer 0 sees every post.
+func visibleTo(post models.Post, viewer uint) bool {
+	return viewer == 0 || post.Status == models.PostStatusPublished || post.UserID == viewer
+}
+
+// comparePosts orders posts by sortBy, breaking ties by ID.
+func comparePosts(a, b models.Post, sortBy string) int {
+	switch sortBy {
+	case "updated_at":
+		return comparePostKey(a, sortBy, b.UpdatedAt, b.ID)
+	case "title":
+		return comparePostKey(a, sortBy, b.Title, b.ID)
+	case "id":
+		return comparePostKey(a, sortBy, nil, b.ID)
+	default:
+		return comparePostKey(a, sortBy, b.CreatedAt, b.ID)
+	}
+}
+
+// comparePostKey compares post against the (value, id) key of a cursor.
+func comparePostKey(post models.Post, sortBy string, value interface{}, id uint) int {
+	cmp := 0
+	switch sortBy {
+	case "created_at":
+		cmp = post.CreatedAt.Compare(value.(time.Time))
+	case "updated_at":
+		cmp = post.UpdatedAt.Compare(value.(time.Time))
+	case "title":
+		cmp = strings.Compare(post.Title, value.(string))
+	}
+	if cmp != 0 {
+		return cmp
+	}
+	switch {
+	case post.ID < id:
+		return -1
+	case post.ID > id:
+		return 1
+	}
+	return 0
+}
+
+func searchWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func wordMatches(word, term string, prefix bool) bool {
+	if prefix {
+		return strings.HasPrefix(word, term)
+	}
+	return word == term
+}
+
+func countMatches(text string, terms []string, prefix bool) int {
+	count := 0
+	for _, word := range searchWords(text) {
+		for _, term := range terms {
+			if wordMatches(word, term, prefix) {
+				count++
+				break
+			}
+		}
+	}
+	return count
+}
+
+func matchesAll(text string, terms []string, prefix bool) bool {
+	words := searchWords(text)
+	for _, term := range terms {
+		found := false
+		for _, word := range words {
+			if wordMatches(word, term, prefix) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// containsPhrase reports whether terms appear in text as consecutive words.
+func containsPhrase(text string, terms []string) bool {
+	words := searchWords(text)
+	for i := 0; i+len(terms) <= len(words); i++ {
+		if slices.Equal(words[i:i+len(terms)], terms) {
+			return true
+		}
+	}
+	return false
+}
+
+// highlight HTML-escapes text and wraps the words that match in <mark>
+// tags, as markHighlights does for Postgres headlines.
+func highlight(text string, terms []string, prefix bool) string {
+	fields := strings.Fields(text)
+	for i, field := range fields {
+		escaped := html.EscapeString(field)
+		fields[i] = escaped
+		for _, word := range searchWords(field) {
+			matched := false
+			for _, term := range terms {
+				if wordMatches(word, term, prefix) {
+					matched = true
+					break
+				}
+			}
+			if matched {
+				fields[i] = "<mark>" + escaped + "</mark>"
+				break
+			}
+		}
+	}
+	return strings.Join(fields, " ")
+}
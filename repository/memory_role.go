@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/tamabsndra/miniproject/miniproject-backend/models"
+)
+
+// MemoryRoleRepository is a process-local RoleRepository seeded with the
+// same grants as the database migration.
+type MemoryRoleRepository struct {
+	mu     sync.RWMutex
+	grants map[string][]string
+}
+
+func NewMemoryRoleRepository() *MemoryRoleRepository {
+	return &MemoryRoleRepository{
+		grants: map[string][]string{
+			models.RoleModerator: {models.PermissionPostsModerate},
+			models.RoleAdmin: {
+				models.PermissionPostsModerate,
+				models.PermissionUsersRead,
+				models.PermissionUsersManageRoles,
+				models.PermissionUsersUnlock,
+			},
+		},
+	}
+}
+
+func (r *MemoryRoleRepository) PermissionsForRoles(ctx context.Context, roles []string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	var permissions []string
+	for _, role := range roles {
+		for _, permission := range r.grants[role] {
+			if !seen[permission] {
+				seen[permission] = true
+				permissions = append(permissions, permission)
+			}
+		}
+	}
+	sort.Strings(permissions)
+	return permissions, nil
+}
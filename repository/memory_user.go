@@ -0,0 +1,248 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tamabsndra/miniproject/miniproject-backend/models"
+)
+
+var ErrDuplicateEmail = errors.New("email already registered")
+
+// MemoryUserRepository is a thread-safe, process-local UserRepository for
+// tests and local development.
+type MemoryUserRepository struct {
+	mu     sync.RWMutex
+	users  map[uint]models.User
+	nextID uint
+}
+
+func NewMemoryUserRepository() *MemoryUserRepository {
+	return &MemoryUserRepository{
+		users:  make(map[uint]models.User),
+		nextID: 1,
+	}
+}
+
+func (r *MemoryUserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, user := range r.users {
+		if user.Email == email {
+			return &user, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r *MemoryUserRepository) GetByID(ctx context.Context, id uint) (*models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	user, ok := r.get(id)
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &user, nil
+}
+
+func (r *MemoryUserRepository) Create(ctx context.Context, user *models.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.users {
+		if existing.Email == user.Email {
+			return ErrDuplicateEmail
+		}
+	}
+
+	if len(user.Roles) == 0 {
+		user.Roles = []string{models.RoleUser}
+	}
+
+	now := time.Now()
+	user.ID = r.nextID
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	r.nextID++
+
+	r.users[user.ID] = *user
+	return nil
+}
+
+func (r *MemoryUserRepository) UpdateProfile(ctx context.Context, id uint, req models.UpdateProfileRequest) (*models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	for _, field := range []struct {
+		dst *string
+		src *string
+	}{
+		{&user.Name, req.Name},
+		{&user.Bio, req.Bio},
+		{&user.AvatarURL, req.AvatarURL},
+		{&user.Location, req.Location},
+		{&user.Website, req.Website},
+	} {
+		if field.src != nil {
+			*field.dst = *field.src
+		}
+	}
+	user.UpdatedAt = time.Now()
+	r.users[id] = user
+	return &user, nil
+}
+
+func (r *MemoryUserRepository) UpdatePassword(ctx context.Context, id uint, passwordHash string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	user.Password = passwordHash
+	user.UpdatedAt = time.Now()
+	r.users[id] = user
+	return nil
+}
+
+func (r *MemoryUserRepository) RehashPassword(ctx context.Context, id uint, oldHash, newHash string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok || user.Password != oldHash {
+		return sql.ErrNoRows
+	}
+
+	user.Password = newHash
+	r.users[id] = user
+	return nil
+}
+
+func (r *MemoryUserRepository) MarkEmailVerified(ctx context.Context, id uint) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	now := time.Now()
+	if user.EmailVerifiedAt == nil {
+		user.EmailVerifiedAt = &now
+	}
+	user.UpdatedAt = now
+	r.users[id] = user
+	return nil
+}
+
+func (r *MemoryUserRepository) List(ctx context.Context, q models.UserListQuery) (*models.UserPage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	limit, offset := offsetPage(q.Limit, q.Offset)
+	page := &models.UserPage{
+		Data:       []models.User{},
+		Pagination: models.PageInfo{Limit: limit, Offset: offset},
+	}
+
+	r.mu.RLock()
+	var users []models.User
+	for _, user := range r.users {
+		if q.Role == "" || hasRole(user, q.Role) {
+			user.Password = ""
+			users = append(users, user)
+		}
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+
+	page.Pagination.Total = int64(len(users))
+	if offset < len(users) {
+		end := offset + limit
+		if end > len(users) {
+			end = len(users)
+		}
+		page.Data = append(page.Data, users[offset:end]...)
+	}
+	return page, nil
+}
+
+func (r *MemoryUserRepository) SetRoles(ctx context.Context, id uint, roles []string) (*models.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	user.Roles = append([]string(nil), roles...)
+	sort.Strings(user.Roles)
+	user.UpdatedAt = time.Now()
+	r.users[id] = user
+	return &user, nil
+}
+
+func hasRole(user models.User, role string) bool {
+	for _, r := range user.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// get returns a copy of the user with the given ID.
+func (r *MemoryUserRepository) get(id uint) (models.User, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[id]
+	return user, ok
+}
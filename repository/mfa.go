@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/tamabsndra/miniproject/miniproject-backend/models"
+)
+
+type PostgresMFARepository struct {
+	db           *sql.DB
+	queryTimeout time.Duration
+}
+
+func NewMFARepository(db *sql.DB, queryTimeout time.Duration) *PostgresMFARepository {
+	return &PostgresMFARepository{db: db, queryTimeout: queryTimeout}
+}
+
+func (r *PostgresMFARepository) GetTOTP(ctx context.Context, userID uint) (_ *models.TOTPEnrollment, err error) {
+	ctx, finish := withQueryTimeout(ctx, r.queryTimeout)
+	defer finish(&err)
+
+	var enrollment models.TOTPEnrollment
+	err = r.db.QueryRowContext(ctx,
+		"SELECT user_id, secret, enabled_at, created_at FROM user_totp WHERE user_id = $1",
+		userID,
+	).Scan(&enrollment.UserID, &enrollment.Secret, &enrollment.EnabledAt, &enrollment.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &enrollment, nil
+}
+
+func (r *PostgresMFARepository) SavePendingTOTP(ctx context.Context, userID uint, secret string) (err error) {
+	ctx, finish := withQueryTimeout(ctx, r.queryTimeout)
+	defer finish(&err)
+
+	// An enabled enrollment is never overwritten; it has to be disabled
+	// first.
+	result, err := r.db.ExecContext(ctx, `
+		INSERT INTO user_totp (user_id, secret) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, created_at = NOW()
+		WHERE user_totp.enabled_at IS NULL`,
+		userID, secret,
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *PostgresMFARepository) EnableTOTP(ctx context.Context, userID uint, recoveryCodeHashes []string) (err error) {
+	ctx, finish := withQueryTimeout(ctx, r.queryTimeout)
+	defer finish(&err)
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx,
+		"UPDATE user_totp SET enabled_at = NOW() WHERE user_id = $1 AND enabled_at IS NULL",
+		userID,
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, recoveryCodeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *PostgresMFARepository) DeleteTOTP(ctx context.Context, userID uint) (err error) {
+	ctx, finish := withQueryTimeout(ctx, r.queryTimeout)
+	defer finish(&err)
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM user_totp WHERE user_id = $1", userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM mfa_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *PostgresMFARepository) UseRecoveryCode(ctx context.Context, userID uint, codeHash string) (err error) {
+	ctx, finish := withQueryTimeout(ctx, r.queryTimeout)
+	defer finish(&err)
+
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE mfa_recovery_codes SET used_at = NOW() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL",
+		userID, codeHash,
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID uint, codeHashes []string) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM mfa_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return err
+	}
+	for _, hash := range codeHashes {
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)",
+			userID, hash,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,308 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tamabsndra/miniproject/miniproject-backend/models"
+	"github.com/tamabsndra/miniproject/miniproject-backend/utils"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+var postSortColumns = map[string]string{
+	"created_at": "p.created_at",
+	"updated_at": "p.updated_at",
+	"title":      "p.title",
+	"id":         "p.id",
+}
+
+// offsetPage clamps limit and offset for offset-paginated listings.
+func offsetPage(limit, offset int) (int, int) {
+	if limit <= 0 {
+		limit = defaultPageLimit
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// postListPlan is a PostListQuery resolved into SQL fragments.
+type postListPlan struct {
+	query    models.PostListQuery
+	where    []string
+	args     []interface{}
+	sortBy   string
+	order    string
+	limit    int
+	offset   int
+	cursor   *utils.Cursor
+	backward bool
+}
+
+func newPostListPlan(q models.PostListQuery) (*postListPlan, error) {
+	plan := &postListPlan{
+		query:  q,
+		sortBy: q.SortBy,
+		order:  strings.ToLower(q.Order),
+		limit:  q.Limit,
+		offset: q.Offset,
+	}
+	if _, ok := postSortColumns[plan.sortBy]; !ok {
+		plan.sortBy = "created_at"
+	}
+	if plan.order != "asc" {
+		plan.order = "desc"
+	}
+	if plan.limit <= 0 {
+		plan.limit = defaultPageLimit
+	}
+	if plan.limit > maxPageLimit {
+		plan.limit = maxPageLimit
+	}
+	if plan.offset < 0 {
+		plan.offset = 0
+	}
+
+	if q.Trashed {
+		plan.where = append(plan.where, "p.deleted_at IS NOT NULL")
+	} else {
+		plan.where = append(plan.where, "p.deleted_at IS NULL")
+	}
+	if q.AuthorID != 0 {
+		plan.addFilter("p.user_id = $%d", q.AuthorID)
+	}
+	if q.Title != "" {
+		plan.addFilter(`p.title ILIKE ('%%' || $%d || '%%') ESCAPE '\'`, escapeLike(q.Title))
+	}
+	if q.CreatedFrom != nil {
+		plan.addFilter("p.created_at >= $%d", *q.CreatedFrom)
+	}
+	if q.CreatedTo != nil {
+		plan.addFilter("p.created_at <= $%d", *q.CreatedTo)
+	}
+	if q.UpdatedFrom != nil {
+		plan.addFilter("p.updated_at >= $%d", *q.UpdatedFrom)
+	}
+	if q.UpdatedTo != nil {
+		plan.addFilter("p.updated_at <= $%d", *q.UpdatedTo)
+	}
+	if q.Status != "" {
+		plan.addFilter("p.status = $%d", q.Status)
+	}
+	if q.ViewerID != 0 {
+		plan.addFilter("(p.status = 'published' OR p.user_id = $%d)", q.ViewerID)
+	}
+
+	if q.Cursor != "" {
+		cursor, err := utils.DecodeCursor(q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if cursor.SortBy != plan.sortBy || cursor.Order != plan.order {
+			return nil, utils.ErrInvalidCursor
+		}
+		plan.cursor = cursor
+		plan.backward = cursor.Backward
+		plan.offset = 0
+	}
+
+	return plan, nil
+}
+
+func (p *postListPlan) addFilter(format string, arg interface{}) {
+	p.args = append(p.args, arg)
+	p.where = append(p.where, fmt.Sprintf(format, len(p.args)))
+}
+
+func (p *postListPlan) whereClause() string {
+	if len(p.where) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(p.where, " AND ")
+}
+
+// pageClause returns the keyset, ORDER BY and LIMIT/OFFSET part of the query
+// together with the full argument list. One extra row is requested so the
+// caller can tell whether another page exists.
+func (p *postListPlan) pageClause() (string, []interface{}, error) {
+	args := append([]interface{}{}, p.args...)
+	where := append([]string{}, p.where...)
+
+	direction, comparator := "ASC", ">"
+	if p.scanDescending() {
+		direction, comparator = "DESC", "<"
+	}
+
+	column := postSortColumns[p.sortBy]
+	if p.cursor != nil {
+		if p.sortBy == "id" {
+			args = append(args, p.cursor.ID)
+			where = append(where, fmt.Sprintf("p.id %s $%d", comparator, len(args)))
+		} else {
+			value, err := cursorValue(p.sortBy, p.cursor.Value)
+			if err != nil {
+				return "", nil, err
+			}
+			args = append(args, value, p.cursor.ID)
+			where = append(where, fmt.Sprintf("(%s, p.id) %s ($%d, $%d)", column, comparator, len(args)-1, len(args)))
+		}
+	}
+
+	clause := ""
+	if len(where) > 0 {
+		clause = " WHERE " + strings.Join(where, " AND ")
+	}
+
+	order := fmt.Sprintf(" ORDER BY %s %s", column, direction)
+	if p.sortBy != "id" {
+		order += fmt.Sprintf(", p.id %s", direction)
+	}
+
+	args = append(args, p.limit+1, p.offset)
+	clause += order + fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+	return clause, args, nil
+}
+
+// scanDescending reports the direction rows are read in. Walking backwards
+// reverses it; rows are flipped back into the requested order afterwards.
+func (p *postListPlan) scanDescending() bool {
+	descending := p.order == "desc"
+	if p.backward {
+		descending = !descending
+	}
+	return descending
+}
+
+func (p *postListPlan) cursorFor(post models.Post, backward bool) string {
+	cursor := utils.Cursor{
+		SortBy:   p.sortBy,
+		Order:    p.order,
+		ID:       post.ID,
+		Backward: backward,
+	}
+	switch p.sortBy {
+	case "created_at":
+		cursor.Value = post.CreatedAt.Format(time.RFC3339Nano)
+	case "updated_at":
+		cursor.Value = post.UpdatedAt.Format(time.RFC3339Nano)
+	case "title":
+		cursor.Value = post.Title
+	}
+	return utils.EncodeCursor(cursor)
+}
+
+func cursorValue(sortBy, value string) (interface{}, error) {
+	switch sortBy {
+	case "created_at", "updated_at":
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return nil, utils.ErrInvalidCursor
+		}
+		return t, nil
+	default:
+		return value, nil
+	}
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// queryPostPage runs a paginated listing over posts aliased as p. selectSQL
+// is everything before the WHERE clause; scan reads one row and post returns
+// the embedded post used to build cursors.
+func queryPostPage[T any](
+	ctx context.Context,
+	db *sql.DB,
+	q models.PostListQuery,
+	selectSQL string,
+	countSQL string,
+	scan func(rowScanner) (T, error),
+	post func(T) models.Post,
+) ([]T, *models.PageInfo, error) {
+	plan, err := newPostListPlan(q)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var total int64
+	if err := db.QueryRowContext(ctx, countSQL+plan.whereClause(), plan.args...).Scan(&total); err != nil {
+		return nil, nil, err
+	}
+
+	clause, args, err := plan.pageClause()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, selectSQL+clause, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	items := make([]T, 0, plan.limit+1)
+	for rows.Next() {
+		item, err := scan(rows)
+		if err != nil {
+			return nil, nil, err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	items, info := finishPage(plan, items, total, post)
+	return items, info, nil
+}
+
+// finishPage takes up to limit+1 rows read in scan order, trims the
+// look-ahead row, restores the requested order and builds the page cursors.
+func finishPage[T any](plan *postListPlan, items []T, total int64, post func(T) models.Post) ([]T, *models.PageInfo) {
+	hasMore := len(items) > plan.limit
+	if hasMore {
+		items = items[:plan.limit]
+	}
+	if plan.backward {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+
+	info := &models.PageInfo{
+		Total:  total,
+		Limit:  plan.limit,
+		Offset: plan.offset,
+	}
+	if len(items) == 0 {
+		return items, info
+	}
+
+	hasNext, hasPrev := hasMore, plan.cursor != nil || plan.offset > 0
+	if plan.backward {
+		hasNext, hasPrev = true, hasMore
+	}
+	if hasNext {
+		info.NextCursor = plan.cursorFor(post(items[len(items)-1]), false)
+	}
+	if hasPrev {
+		info.PrevCursor = plan.cursorFor(post(items[0]), true)
+	}
+	return items, info
+}
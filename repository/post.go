@@ -1,185 +1,505 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
+	"html"
+	"strings"
+	"time"
+	"unicode"
 
 	"github.com/tamabsndra/miniproject/miniproject-backend/models"
 )
 
-type PostRepository struct {
-	db *sql.DB
+type PostgresPostRepository struct {
+	db           *sql.DB
+	queryTimeout time.Duration
 }
 
-func NewPostRepository(db *sql.DB) *PostRepository {
-	return &PostRepository{db: db}
+func NewPostRepository(db *sql.DB, queryTimeout time.Duration) *PostgresPostRepository {
+	return &PostgresPostRepository{db: db, queryTimeout: queryTimeout}
 }
 
-func (r *PostRepository) Create(post *models.Post) (*models.Post, error) {
+// Create saves the post and its first revision, attributed to the author.
+func (r *PostgresPostRepository) Create(ctx context.Context, post *models.Post) (_ *models.Post, err error) {
+	ctx, finish := withQueryTimeout(ctx, r.queryTimeout)
+	defer finish(&err)
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
 	query := `
-        INSERT INTO posts (user_id, title, content, created_at, updated_at)
-        VALUES ($1, $2, $3, NOW(), NOW())
+        INSERT INTO posts (user_id, title, content, status, published_at, created_at, updated_at)
+        VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
         RETURNING id, created_at, updated_at
     `
-	err := r.db.QueryRow(
+	err = tx.QueryRowContext(
+		ctx,
 		query,
 		post.UserID,
 		post.Title,
 		post.Content,
+		post.Status,
+		post.PublishedAt,
 	).Scan(&post.ID, &post.CreatedAt, &post.UpdatedAt)
 
 	if err != nil {
 		return nil, err
 	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO post_revisions (post_id, revision, editor_id, title, content, created_at)
+		VALUES ($1, 1, $2, $3, $4, $5)
+	`, post.ID, post.UserID, post.Title, post.Content, post.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
 	return post, nil
 }
 
-func (r *PostRepository) GetAll() ([]models.Post, error) {
+func (r *PostgresPostRepository) GetAll(ctx context.Context, q models.PostListQuery) (_ *models.PostPage, err error) {
+	ctx, finish := withQueryTimeout(ctx, r.queryTimeout)
+	defer finish(&err)
+
 	query := `
-        SELECT id, user_id, title, content, created_at, updated_at
-        FROM posts
-        ORDER BY created_at DESC
+        SELECT p.id, p.user_id, p.title, p.content, p.status, p.published_at, p.created_at, p.updated_at, p.deleted_at, p.removed_by_moderator
+        FROM posts p
     `
-	rows, err := r.db.Query(query)
+	posts, info, err := queryPostPage(ctx, r.db, q, query, "SELECT COUNT(*) FROM posts p", scanPost, func(post models.Post) models.Post {
+		return post
+	})
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var posts []models.Post
-	for rows.Next() {
-		var post models.Post
-		err := rows.Scan(
-			&post.ID,
-			&post.UserID,
-			&post.Title,
-			&post.Content,
-			&post.CreatedAt,
-			&post.UpdatedAt,
-		)
-		if err != nil {
-			return nil, err
-		}
-		posts = append(posts, post)
-	}
-	return posts, nil
+	return &models.PostPage{Data: posts, Pagination: *info}, nil
 }
 
-func (r *PostRepository) GetByID(id uint) (*models.Post, error) {
-	post := &models.Post{}
+func (r *PostgresPostRepository) GetByID(ctx context.Context, id uint) (_ *models.Post, err error) {
+	ctx, finish := withQueryTimeout(ctx, r.queryTimeout)
+	defer finish(&err)
+
 	query := `
-        SELECT id, user_id, title, content, created_at, updated_at
+        SELECT id, user_id, title, content, status, published_at, created_at, updated_at, deleted_at, removed_by_moderator
         FROM posts
-        WHERE id = $1
+        WHERE id = $1 AND deleted_at IS NULL
     `
-	err := r.db.QueryRow(query, id).Scan(
-		&post.ID,
-		&post.UserID,
-		&post.Title,
-		&post.Content,
-		&post.CreatedAt,
-		&post.UpdatedAt,
-	)
+	post, err := scanPost(r.db.QueryRowContext(ctx, query, id))
 	if err != nil {
 		return nil, err
 	}
-	return post, nil
+	return &post, nil
 }
 
-func (r *PostRepository) GetByUserID(userID uint) ([]models.Post, error) {
+func (r *PostgresPostRepository) GetByUserID(ctx context.Context, userID uint, q models.PostListQuery) (*models.PostPage, error) {
+	q.AuthorID = userID
+	return r.GetAll(ctx, q)
+}
+
+// Update saves the new title and content and records them as the post's
+// next revision, attributed to editorID.
+func (r *PostgresPostRepository) Update(ctx context.Context, id, editorID uint, req models.UpdatePostRequest) (_ *models.Post, err error) {
+	ctx, finish := withQueryTimeout(ctx, r.queryTimeout)
+	defer finish(&err)
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
 	query := `
-		SELECT id, user_id, title, content, created_at, updated_at
-		FROM posts
-		WHERE user_id = $1
-		ORDER BY created_at DESC
+		UPDATE posts
+		SET title = $1, content = $2, updated_at = NOW()
+		WHERE id = $3 AND deleted_at IS NULL
+		RETURNING id, user_id, title, content, status, published_at, created_at, updated_at, deleted_at, removed_by_moderator
 	`
-	rows, err := r.db.Query(query, userID)
+	post, err := scanPost(tx.QueryRowContext(ctx, query, req.Title, req.Content, id))
+	if err != nil {
+		return nil, err
+	}
+
+	// The UPDATE holds the post's row lock until commit, so concurrent
+	// edits number their revisions one after the other.
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO post_revisions (post_id, revision, editor_id, title, content, created_at)
+		SELECT $1, COALESCE(MAX(revision), 0) + 1, $2, $3, $4, $5
+		FROM post_revisions
+		WHERE post_id = $1
+	`, id, editorID, post.Title, post.Content, post.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
+
+// ListRevisions returns the post's revisions, newest first.
+func (r *PostgresPostRepository) ListRevisions(ctx context.Context, postID uint) (_ []models.PostRevision, err error) {
+	ctx, finish := withQueryTimeout(ctx, r.queryTimeout)
+	defer finish(&err)
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT post_id, revision, editor_id, title, content, created_at
+		FROM post_revisions
+		WHERE post_id = $1
+		ORDER BY revision DESC
+	`, postID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var posts []models.Post
+	revisions := []models.PostRevision{}
 	for rows.Next() {
-		var post models.Post
-		err := rows.Scan(
-			&post.ID,
-			&post.UserID,
-			&post.Title,
-			&post.Content,
-			&post.CreatedAt,
-			&post.UpdatedAt,
-		)
+		revision, err := scanPostRevision(rows)
 		if err != nil {
 			return nil, err
 		}
-		posts = append(posts, post)
+		revisions = append(revisions, revision)
 	}
-	return posts, nil
+	return revisions, rows.Err()
 }
 
-func (r *PostRepository) Update(id uint, req models.UpdatePostRequest) (*models.Post, error) {
-	post := &models.Post{}
+func (r *PostgresPostRepository) GetRevision(ctx context.Context, postID uint, revision int) (_ *models.PostRevision, err error) {
+	ctx, finish := withQueryTimeout(ctx, r.queryTimeout)
+	defer finish(&err)
+
+	row := r.db.QueryRowContext(ctx, `
+		SELECT post_id, revision, editor_id, title, content, created_at
+		FROM post_revisions
+		WHERE post_id = $1 AND revision = $2
+	`, postID, revision)
+	result, err := scanPostRevision(row)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// SetStatus moves a post to status and sets its published_at, without
+// counting as an edit.
+func (r *PostgresPostRepository) SetStatus(ctx context.Context, id uint, status string, publishedAt *time.Time) (_ *models.Post, err error) {
+	ctx, finish := withQueryTimeout(ctx, r.queryTimeout)
+	defer finish(&err)
+
 	query := `
 		UPDATE posts
-		SET title = $1, content = $2, updated_at = NOW()
-		WHERE id = $3
-		RETURNING id, user_id, title, content, created_at, updated_at
+		SET status = $1, published_at = $2
+		WHERE id = $3 AND deleted_at IS NULL
+		RETURNING id, user_id, title, content, status, published_at, created_at, updated_at, deleted_at, removed_by_moderator
 	`
-	err := r.db.QueryRow(
-		query,
-		req.Title,
-		req.Content,
-		id,
-	).Scan(
-		&post.ID,
-		&post.UserID,
-		&post.Title,
-		&post.Content,
-		&post.CreatedAt,
-		&post.UpdatedAt,
-	)
+	post, err := scanPost(r.db.QueryRowContext(ctx, query, status, publishedAt, id))
 	if err != nil {
 		return nil, err
 	}
-	return post, nil
+	return &post, nil
 }
 
-func (r *PostRepository) Delete(id uint) error {
-	_, err := r.db.Exec("DELETE FROM posts WHERE id = $1", id)
-	return err
+// PublishDue publishes every scheduled post whose time has come and returns
+// how many there were.
+func (r *PostgresPostRepository) PublishDue(ctx context.Context, now time.Time) (_ int64, err error) {
+	ctx, finish := withQueryTimeout(ctx, r.queryTimeout)
+	defer finish(&err)
+
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE posts
+		SET status = 'published'
+		WHERE status = 'scheduled' AND published_at <= $1 AND deleted_at IS NULL
+	`, now)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Delete moves a post to the trash.
+func (r *PostgresPostRepository) Delete(ctx context.Context, id uint) (err error) {
+	ctx, finish := withQueryTimeout(ctx, r.queryTimeout)
+	defer finish(&err)
+
+	result, err := r.db.ExecContext(ctx, "UPDATE posts SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL", id)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
 }
 
-func (r *PostRepository) GetPostDetail() ([]models.PostWithUser, error) {
+// Remove moves a post to the trash on a moderator's behalf, marking it so
+// its author cannot restore it. Posts already in the trash are marked too.
+func (r *PostgresPostRepository) Remove(ctx context.Context, id uint) (err error) {
+	ctx, finish := withQueryTimeout(ctx, r.queryTimeout)
+	defer finish(&err)
+
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE posts
+		SET deleted_at = COALESCE(deleted_at, NOW()), removed_by_moderator = TRUE
+		WHERE id = $1
+	`, id)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// GetTrashed returns a post that is in the trash.
+func (r *PostgresPostRepository) GetTrashed(ctx context.Context, id uint) (_ *models.Post, err error) {
+	ctx, finish := withQueryTimeout(ctx, r.queryTimeout)
+	defer finish(&err)
+
+	query := `
+		SELECT id, user_id, title, content, status, published_at, created_at, updated_at, deleted_at, removed_by_moderator
+		FROM posts
+		WHERE id = $1 AND deleted_at IS NOT NULL
+	`
+	post, err := scanPost(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
+
+// Restore takes a post back out of the trash.
+func (r *PostgresPostRepository) Restore(ctx context.Context, id uint) (_ *models.Post, err error) {
+	ctx, finish := withQueryTimeout(ctx, r.queryTimeout)
+	defer finish(&err)
+
 	query := `
-		SELECT p.id, p.user_id, p.title, p.content, p.created_at, p.updated_at, u.id, u.name, u.email
+		UPDATE posts
+		SET deleted_at = NULL
+		WHERE id = $1 AND deleted_at IS NOT NULL AND NOT removed_by_moderator
+		RETURNING id, user_id, title, content, status, published_at, created_at, updated_at, deleted_at, removed_by_moderator
+	`
+	post, err := scanPost(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
+
+// Purge permanently deletes a post that is in the trash, together with its
+// revisions.
+func (r *PostgresPostRepository) Purge(ctx context.Context, id uint) (err error) {
+	ctx, finish := withQueryTimeout(ctx, r.queryTimeout)
+	defer finish(&err)
+
+	result, err := r.db.ExecContext(ctx, "DELETE FROM posts WHERE id = $1 AND deleted_at IS NOT NULL", id)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+// PurgeDeletedBefore permanently deletes every post moved to the trash
+// before cutoff and returns how many there were.
+func (r *PostgresPostRepository) PurgeDeletedBefore(ctx context.Context, cutoff time.Time) (_ int64, err error) {
+	ctx, finish := withQueryTimeout(ctx, r.queryTimeout)
+	defer finish(&err)
+
+	result, err := r.db.ExecContext(ctx, "DELETE FROM posts WHERE deleted_at < $1", cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (r *PostgresPostRepository) GetPostDetail(ctx context.Context, q models.PostListQuery) (_ *models.PostWithUserPage, err error) {
+	ctx, finish := withQueryTimeout(ctx, r.queryTimeout)
+	defer finish(&err)
+
+	query := `
+		SELECT p.id, p.user_id, p.title, p.content, p.status, p.published_at, p.created_at, p.updated_at, p.deleted_at, p.removed_by_moderator, u.id, u.name, u.email
 		FROM posts p
 		JOIN users u ON p.user_id = u.id
-		ORDER BY p.created_at DESC
 	`
-	rows, err := r.db.Query(query)
+	posts, info, err := queryPostPage(ctx, r.db, q, query, "SELECT COUNT(*) FROM posts p", scanPostWithUser, func(post models.PostWithUser) models.Post {
+		return post.Post
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &models.PostWithUserPage{Data: posts, Pagination: *info}, nil
+}
+
+func (r *PostgresPostRepository) Search(ctx context.Context, q models.PostSearchQuery) (_ *models.PostSearchPage, err error) {
+	ctx, finish := withQueryTimeout(ctx, r.queryTimeout)
+	defer finish(&err)
+
+	tsquery, term := searchTSQuery(q.Mode, q.Q)
+
+	limit, offset := offsetPage(q.Limit, q.Offset)
+
+	page := &models.PostSearchPage{
+		Data:       []models.PostSearchResult{},
+		Pagination: models.PageInfo{Limit: limit, Offset: offset},
+	}
+	if term == "" {
+		return page, nil
+	}
+
+	// A viewer sees published posts and their own; viewer 0 sees every post
+	// that is not in the trash.
+	visible := `p.deleted_at IS NULL AND ($2 = 0 OR p.status = 'published' OR p.user_id = $2)`
+
+	countQuery := `SELECT COUNT(*) FROM posts p WHERE p.search_vector @@ ` + tsquery + ` AND ` + visible
+	if err := r.db.QueryRowContext(ctx, countQuery, term, q.ViewerID).Scan(&page.Pagination.Total); err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT p.id, p.user_id, p.title, p.content, p.status, p.published_at, p.created_at, p.updated_at,
+			ts_rank_cd(p.search_vector, q.query) AS rank,
+			` + headlineSQL("p.title", "HighlightAll=true") + `,
+			` + headlineSQL("p.content", "MaxFragments=2, MaxWords=30, MinWords=10") + `
+		FROM posts p, (SELECT ` + tsquery + ` AS query) q
+		WHERE p.search_vector @@ q.query AND ` + visible + `
+		ORDER BY rank DESC, p.id DESC
+		LIMIT $3 OFFSET $4
+	`
+	rows, err := r.db.QueryContext(ctx, query, term, q.ViewerID, limit, offset)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var posts []models.PostWithUser
 	for rows.Next() {
-		var post models.PostWithUser
+		var result models.PostSearchResult
 		err := rows.Scan(
-			&post.ID,
-			&post.UserID,
-			&post.Title,
-			&post.Content,
-			&post.CreatedAt,
-			&post.UpdatedAt,
-			&post.User.ID,
-			&post.User.Name,
-			&post.User.Email,
+			&result.ID,
+			&result.UserID,
+			&result.Title,
+			&result.Content,
+			&result.Status,
+			&result.PublishedAt,
+			&result.CreatedAt,
+			&result.UpdatedAt,
+			&result.Rank,
+			&result.TitleHighlight,
+			&result.Snippet,
 		)
 		if err != nil {
 			return nil, err
 		}
-		posts = append(posts, post)
+		result.TitleHighlight = markHighlights(result.TitleHighlight)
+		result.Snippet = markHighlights(result.Snippet)
+		page.Data = append(page.Data, result)
+	}
+	return page, rows.Err()
+}
+
+// headlineSQL returns a ts_headline call for column that marks matches
+// with the control characters STX and ETX rather than HTML. They are
+// stripped from the text first, so every one in the output is a real
+// delimiter; markHighlights then escapes the text and turns them into <mark>
+// tags. Highlighting with <mark> in SQL would pass author-supplied HTML
+// through unescaped.
+func headlineSQL(column, options string) string {
+	return "ts_headline('english', translate(" + column + ", chr(2) || chr(3), ''), q.query, " +
+		"'StartSel=' || chr(2) || ', StopSel=' || chr(3) || ', " + options + "')"
+}
+
+var highlightMarks = strings.NewReplacer("\x02", "<mark>", "\x03", "</mark>")
+
+// markHighlights HTML-escapes a headline built by headlineSQL and wraps its
+// matches in <mark> tags.
+func markHighlights(headline string) string {
+	return highlightMarks.Replace(html.EscapeString(headline))
+}
+
+// searchTSQuery returns the tsquery constructor for the search mode and the
+// search term to bind to it. Prefix searches are assembled here because
+// Postgres has no constructor that adds :* to user input safely.
+func searchTSQuery(mode, input string) (string, string) {
+	switch mode {
+	case "plain":
+		return "plainto_tsquery('english', $1)", strings.TrimSpace(input)
+	case "phrase":
+		return "phraseto_tsquery('english', $1)", strings.TrimSpace(input)
+	case "prefix":
+		words := strings.FieldsFunc(input, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for i, word := range words {
+			words[i] = word + ":*"
+		}
+		return "to_tsquery('english', $1)", strings.Join(words, " & ")
+	default:
+		return "websearch_to_tsquery('english', $1)", strings.TrimSpace(input)
+	}
+}
+
+func scanPost(row rowScanner) (models.Post, error) {
+	var post models.Post
+	err := row.Scan(
+		&post.ID,
+		&post.UserID,
+		&post.Title,
+		&post.Content,
+		&post.Status,
+		&post.PublishedAt,
+		&post.CreatedAt,
+		&post.UpdatedAt,
+		&post.DeletedAt,
+		&post.RemovedByModerator,
+	)
+	return post, err
+}
+
+func scanPostWithUser(row rowScanner) (models.PostWithUser, error) {
+	var post models.PostWithUser
+	err := row.Scan(
+		&post.ID,
+		&post.UserID,
+		&post.Title,
+		&post.Content,
+		&post.Status,
+		&post.PublishedAt,
+		&post.CreatedAt,
+		&post.UpdatedAt,
+		&post.DeletedAt,
+		&post.RemovedByModerator,
+		&post.User.ID,
+		&post.User.Name,
+		&post.User.Email,
+	)
+	return post, err
+}
+
+func scanPostRevision(row rowScanner) (models.PostRevision, error) {
+	var revision models.PostRevision
+	var editorID sql.NullInt64
+	err := row.Scan(
+		&revision.PostID,
+		&revision.Revision,
+		&editorID,
+		&revision.Title,
+		&revision.Content,
+		&revision.CreatedAt,
+	)
+	if editorID.Valid {
+		id := uint(editorID.Int64)
+		revision.EditorID = &id
+	}
+	return revision, err
+}
+
+// expectAffected turns a statement that matched no rows into sql.ErrNoRows.
+func expectAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
 	}
-	return posts, nil
+	return nil
 }
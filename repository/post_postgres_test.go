@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+
+	"github.com/tamabsndra/miniproject/miniproject-backend/models"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/database/migrations"
+)
+
+// openTestDB connects to the Postgres database named by TEST_DATABASE_URL
+// and migrates it to the latest version. Tests using it are skipped when the
+// variable is unset; point it at a disposable database.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := migrations.New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestPostgresSearch(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+
+	user := &models.User{Email: fmt.Sprintf("search-%d@example.com", time.Now().UnixNano()), Password: "x", Name: "Search"}
+	if err := NewUserRepository(db, 5*time.Second).Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Exec("DELETE FROM users WHERE id = $1", user.ID) })
+
+	posts := NewPostRepository(db, 5*time.Second)
+	post, err := posts.Create(ctx, &models.Post{
+		UserID:  user.ID,
+		Title:   "Quesadilla <script>alert(1)</script>",
+		Content: "Fold the quesadilla and toast both sides.",
+		Status:  models.PostStatusPublished,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := posts.Search(ctx, models.PostSearchQuery{Q: "quesadilla", ViewerID: user.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found *models.PostSearchResult
+	for i := range page.Data {
+		if page.Data[i].ID == post.ID {
+			found = &page.Data[i]
+		}
+	}
+	if found == nil {
+		t.Fatalf("search did not return post %d: %+v", post.ID, page.Data)
+	}
+	if want := "<mark>Quesadilla</mark> &lt;script&gt;alert(1)&lt;/script&gt;"; found.TitleHighlight != want {
+		t.Fatalf("title highlight = %q, want %q", found.TitleHighlight, want)
+	}
+
+	if err := posts.Delete(ctx, post.ID); err != nil {
+		t.Fatal(err)
+	}
+	page, err = posts.Search(ctx, models.PostSearchQuery{Q: "quesadilla", ViewerID: user.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range page.Data {
+		if result.ID == post.ID {
+			t.Fatal("search returned a trashed post")
+		}
+	}
+}
+
+func TestPostgresRestoreKeepsModeratorRemoval(t *testing.T) {
+	db := openTestDB(t)
+
+	user := &models.User{Email: fmt.Sprintf("restore-%d@example.com", time.Now().UnixNano()), Password: "x", Name: "Restore"}
+	if err := NewUserRepository(db, 5*time.Second).Create(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Exec("DELETE FROM users WHERE id = $1", user.ID) })
+
+	testRestoreKeepsModeratorRemoval(t, NewPostRepository(db, 5*time.Second), user.ID)
+}
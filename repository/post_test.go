@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/tamabsndra/miniproject/miniproject-backend/models"
+)
+
+func TestMarkHighlights(t *testing.T) {
+	tests := []struct {
+		headline string
+		want     string
+	}{
+		{"plain \x02words\x03 only", "plain <mark>words</mark> only"},
+		{"\x02<script>\x03alert(1)</script>", "<mark>&lt;script&gt;</mark>alert(1)&lt;/script&gt;"},
+		{`say "hi" & <b>bye</b>`, "say &#34;hi&#34; &amp; &lt;b&gt;bye&lt;/b&gt;"},
+	}
+	for _, tt := range tests {
+		if got := markHighlights(tt.headline); got != tt.want {
+			t.Errorf("markHighlights(%q) = %q, want %q", tt.headline, got, tt.want)
+		}
+	}
+}
+
+func TestMemoryRestoreKeepsModeratorRemoval(t *testing.T) {
+	users := NewMemoryUserRepository()
+	user := &models.User{Email: "author@example.com", Password: "x", Name: "Author"}
+	if err := users.Create(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	testRestoreKeepsModeratorRemoval(t, NewMemoryPostRepository(users), user.ID)
+}
+
+// testRestoreKeepsModeratorRemoval has a moderator remove a post the author
+// already trashed: Restore must refuse it and leave the removal in place.
+func testRestoreKeepsModeratorRemoval(t *testing.T, posts PostRepository, userID uint) {
+	t.Helper()
+	ctx := context.Background()
+
+	post, err := posts.Create(ctx, &models.Post{UserID: userID, Title: "Trashed", Content: "Then removed", Status: models.PostStatusPublished})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := posts.Delete(ctx, post.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := posts.Remove(ctx, post.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := posts.Restore(ctx, post.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("Restore(removed) err = %v, want sql.ErrNoRows", err)
+	}
+	trashed, err := posts.GetTrashed(ctx, post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !trashed.RemovedByModerator {
+		t.Fatal("Restore cleared the moderator removal")
+	}
+
+	own, err := posts.Create(ctx, &models.Post{UserID: userID, Title: "Trashed", Content: "By the author", Status: models.PostStatusPublished})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := posts.Delete(ctx, own.ID); err != nil {
+		t.Fatal(err)
+	}
+	if restored, err := posts.Restore(ctx, own.ID); err != nil || restored.DeletedAt != nil {
+		t.Fatalf("Restore(own) = %+v, %v; want the post back", restored, err)
+	}
+	if _, err := posts.Restore(ctx, own.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("Restore(live) err = %v, want sql.ErrNoRows", err)
+	}
+}
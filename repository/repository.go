@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/tamabsndra/miniproject/miniproject-backend/models"
+)
+
+// Lookups that find nothing return sql.ErrNoRows, as do updates and deletes
+// that affect no rows, regardless of the implementation.
+
+type UserRepository interface {
+	GetByEmail(ctx context.Context, email string) (*models.User, error)
+	GetByID(ctx context.Context, id uint) (*models.User, error)
+	Create(ctx context.Context, user *models.User) error
+	UpdateProfile(ctx context.Context, id uint, req models.UpdateProfileRequest) (*models.User, error)
+	UpdatePassword(ctx context.Context, id uint, passwordHash string) error
+	// RehashPassword replaces the hash only if it is still oldHash.
+	RehashPassword(ctx context.Context, id uint, oldHash, newHash string) error
+	MarkEmailVerified(ctx context.Context, id uint) error
+	List(ctx context.Context, q models.UserListQuery) (*models.UserPage, error)
+	SetRoles(ctx context.Context, id uint, roles []string) (*models.User, error)
+}
+
+type RoleRepository interface {
+	PermissionsForRoles(ctx context.Context, roles []string) ([]string, error)
+}
+
+// MFARepository stores TOTP enrollments and hashed recovery codes.
+type MFARepository interface {
+	GetTOTP(ctx context.Context, userID uint) (*models.TOTPEnrollment, error)
+	// SavePendingTOTP starts or restarts enrollment with a new secret. It
+	// returns sql.ErrNoRows if the user already has TOTP enabled.
+	SavePendingTOTP(ctx context.Context, userID uint, secret string) error
+	// EnableTOTP activates a pending enrollment and replaces the user's
+	// recovery codes.
+	EnableTOTP(ctx context.Context, userID uint, recoveryCodeHashes []string) error
+	DeleteTOTP(ctx context.Context, userID uint) error
+	// UseRecoveryCode marks an unused recovery code as used.
+	UseRecoveryCode(ctx context.Context, userID uint, codeHash string) error
+}
+
+// IdentityRepository links external OpenID identities to users.
+type IdentityRepository interface {
+	Get(ctx context.Context, provider, subject string) (*models.UserIdentity, error)
+	Create(ctx context.Context, identity *models.UserIdentity) error
+}
+
+// APIKeyRepository stores personal API keys by the hash of the key.
+type APIKeyRepository interface {
+	Create(ctx context.Context, key *models.APIKey) error
+	GetByHash(ctx context.Context, keyHash string) (*models.APIKey, error)
+	ListByUser(ctx context.Context, userID uint) ([]models.APIKey, error)
+	// Delete removes one of the user's keys.
+	Delete(ctx context.Context, userID, id uint) error
+	// Touch records when and from where a key was last used.
+	Touch(ctx context.Context, id uint, ip string, at time.Time) error
+}
+
+type PostRepository interface {
+	Create(ctx context.Context, post *models.Post) (*models.Post, error)
+	GetAll(ctx context.Context, q models.PostListQuery) (*models.PostPage, error)
+	GetByID(ctx context.Context, id uint) (*models.Post, error)
+	GetByUserID(ctx context.Context, userID uint, q models.PostListQuery) (*models.PostPage, error)
+	Update(ctx context.Context, id, editorID uint, req models.UpdatePostRequest) (*models.Post, error)
+	ListRevisions(ctx context.Context, postID uint) ([]models.PostRevision, error)
+	GetRevision(ctx context.Context, postID uint, revision int) (*models.PostRevision, error)
+	SetStatus(ctx context.Context, id uint, status string, publishedAt *time.Time) (*models.Post, error)
+	PublishDue(ctx context.Context, now time.Time) (int64, error)
+	// Delete moves a post to the trash, where GetByID and the listings no
+	// longer see it; Remove does the same for a moderator and marks the
+	// post RemovedByModerator. Restore only takes back posts that are in the
+	// trash and were not removed by a moderator, returning sql.ErrNoRows
+	// otherwise. Purge and PurgeDeletedBefore remove trashed posts for good.
+	Delete(ctx context.Context, id uint) error
+	Remove(ctx context.Context, id uint) error
+	GetTrashed(ctx context.Context, id uint) (*models.Post, error)
+	Restore(ctx context.Context, id uint) (*models.Post, error)
+	Purge(ctx context.Context, id uint) error
+	PurgeDeletedBefore(ctx context.Context, cutoff time.Time) (int64, error)
+	GetPostDetail(ctx context.Context, q models.PostListQuery) (*models.PostWithUserPage, error)
+	Search(ctx context.Context, q models.PostSearchQuery) (*models.PostSearchPage, error)
+}
+
+var (
+	_ UserRepository     = (*PostgresUserRepository)(nil)
+	_ UserRepository     = (*MemoryUserRepository)(nil)
+	_ RoleRepository     = (*PostgresRoleRepository)(nil)
+	_ RoleRepository     = (*MemoryRoleRepository)(nil)
+	_ MFARepository      = (*PostgresMFARepository)(nil)
+	_ MFARepository      = (*MemoryMFARepository)(nil)
+	_ IdentityRepository = (*PostgresIdentityRepository)(nil)
+	_ IdentityRepository = (*MemoryIdentityRepository)(nil)
+	_ PostRepository     = (*PostgresPostRepository)(nil)
+	_ PostRepository     = (*MemoryPostRepository)(nil)
+	_ APIKeyRepository   = (*PostgresAPIKeyRepository)(nil)
+	_ APIKeyRepository   = (*MemoryAPIKeyRepository)(nil)
+)
+
+// withQueryTimeout derives the context for a single database operation. The
+// returned finish func must be deferred with the operation's error: it
+// releases the context and, when the context ended the operation, replaces
+// the driver's error with the context error so callers can match it with
+// errors.Is(err, context.DeadlineExceeded).
+func withQueryTimeout(ctx context.Context, timeout time.Duration) (context.Context, func(*error)) {
+	cancel := context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	return ctx, func(err *error) {
+		if *err != nil && ctx.Err() != nil {
+			*err = ctx.Err()
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type PostgresRoleRepository struct {
+	db           *sql.DB
+	queryTimeout time.Duration
+}
+
+func NewRoleRepository(db *sql.DB, queryTimeout time.Duration) *PostgresRoleRepository {
+	return &PostgresRoleRepository{db: db, queryTimeout: queryTimeout}
+}
+
+func (r *PostgresRoleRepository) PermissionsForRoles(ctx context.Context, roles []string) (_ []string, err error) {
+	ctx, finish := withQueryTimeout(ctx, r.queryTimeout)
+	defer finish(&err)
+
+	rows, err := r.db.QueryContext(ctx,
+		"SELECT DISTINCT permission FROM role_permissions WHERE role = ANY($1) ORDER BY permission",
+		pq.Array(roles),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var permissions []string
+	for rows.Next() {
+		var permission string
+		if err := rows.Scan(&permission); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+	return permissions, rows.Err()
+}
@@ -1,50 +1,278 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
 
 	"github.com/tamabsndra/miniproject/miniproject-backend/models"
 )
 
-type UserRepository struct {
-	db *sql.DB
+// userColumns selects a user together with its roles, for scanUser.
+const userColumns = `
+	u.id, u.email, u.password, u.name, u.bio, u.avatar_url, u.location, u.website,
+	ARRAY(SELECT ur.role FROM user_roles ur WHERE ur.user_id = u.id ORDER BY ur.role),
+	u.email_verified_at, u.created_at, u.updated_at
+`
+
+type PostgresUserRepository struct {
+	db           *sql.DB
+	queryTimeout time.Duration
 }
 
-func NewUserRepository(db *sql.DB) *UserRepository {
-	return &UserRepository{db: db}
+func NewUserRepository(db *sql.DB, queryTimeout time.Duration) *PostgresUserRepository {
+	return &PostgresUserRepository{db: db, queryTimeout: queryTimeout}
 }
 
-func (r *UserRepository) GetByEmail(email string) (*models.User, error) {
-	user := &models.User{}
-	query := `
-        SELECT id, email, password, name, created_at, updated_at
-        FROM users
-        WHERE email = $1
-    `
-	err := r.db.QueryRow(query, email).Scan(
-		&user.ID,
-		&user.Email,
-		&user.Password,
-		&user.Name,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
+func (r *PostgresUserRepository) GetByEmail(ctx context.Context, email string) (_ *models.User, err error) {
+	ctx, finish := withQueryTimeout(ctx, r.queryTimeout)
+	defer finish(&err)
+
+	query := `SELECT ` + userColumns + ` FROM users u WHERE u.email = $1`
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, email))
 	if err != nil {
 		return nil, err
 	}
-	return user, nil
+	return &user, nil
 }
 
-func (r *UserRepository) Create(user *models.User) error {
+func (r *PostgresUserRepository) GetByID(ctx context.Context, id uint) (_ *models.User, err error) {
+	ctx, finish := withQueryTimeout(ctx, r.queryTimeout)
+	defer finish(&err)
+
+	query := `SELECT ` + userColumns + ` FROM users u WHERE u.id = $1`
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// Create inserts the user and its roles in one statement. Users created
+// without roles get the default user role.
+func (r *PostgresUserRepository) Create(ctx context.Context, user *models.User) (err error) {
+	ctx, finish := withQueryTimeout(ctx, r.queryTimeout)
+	defer finish(&err)
+
+	if len(user.Roles) == 0 {
+		user.Roles = []string{models.RoleUser}
+	}
+
 	query := `
-        INSERT INTO users (email, password, name, created_at, updated_at)
-        VALUES ($1, $2, $3, NOW(), NOW())
-        RETURNING id, created_at, updated_at
-    `
-	return r.db.QueryRow(
+		WITH u AS (
+			INSERT INTO users (email, password, name, created_at, updated_at)
+			VALUES ($1, $2, $3, NOW(), NOW())
+			RETURNING id, created_at, updated_at
+		), r AS (
+			INSERT INTO user_roles (user_id, role)
+			SELECT u.id, unnest($4::varchar[]) FROM u
+		)
+		SELECT id, created_at, updated_at FROM u
+	`
+	return r.db.QueryRowContext(
+		ctx,
 		query,
 		user.Email,
 		user.Password,
 		user.Name,
+		pq.Array(user.Roles),
 	).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
 }
+
+func (r *PostgresUserRepository) List(ctx context.Context, q models.UserListQuery) (_ *models.UserPage, err error) {
+	ctx, finish := withQueryTimeout(ctx, r.queryTimeout)
+	defer finish(&err)
+
+	limit, offset := offsetPage(q.Limit, q.Offset)
+	page := &models.UserPage{
+		Data:       []models.User{},
+		Pagination: models.PageInfo{Limit: limit, Offset: offset},
+	}
+
+	where := ""
+	args := []interface{}{}
+	if q.Role != "" {
+		where = ` WHERE EXISTS (SELECT 1 FROM user_roles ur WHERE ur.user_id = u.id AND ur.role = $1)`
+		args = append(args, q.Role)
+	}
+
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users u`+where, args...).Scan(&page.Pagination.Total); err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(`SELECT %s FROM users u%s ORDER BY u.id LIMIT $%d OFFSET $%d`,
+		userColumns, where, len(args)+1, len(args)+2)
+	rows, err := r.db.QueryContext(ctx, query, append(args, limit, offset)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		user.Password = ""
+		page.Data = append(page.Data, user)
+	}
+	return page, rows.Err()
+}
+
+// UpdateProfile sets the profile fields present in req and leaves the rest
+// unchanged.
+func (r *PostgresUserRepository) UpdateProfile(ctx context.Context, id uint, req models.UpdateProfileRequest) (_ *models.User, err error) {
+	ctx, finish := withQueryTimeout(ctx, r.queryTimeout)
+	defer finish(&err)
+
+	query := `
+		WITH u AS (
+			UPDATE users
+			SET name = COALESCE($2, name),
+				bio = COALESCE($3, bio),
+				avatar_url = COALESCE($4, avatar_url),
+				location = COALESCE($5, location),
+				website = COALESCE($6, website),
+				updated_at = NOW()
+			WHERE id = $1
+			RETURNING *
+		)
+		SELECT ` + userColumns + ` FROM u
+	`
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, id, req.Name, req.Bio, req.AvatarURL, req.Location, req.Website))
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *PostgresUserRepository) UpdatePassword(ctx context.Context, id uint, passwordHash string) (err error) {
+	ctx, finish := withQueryTimeout(ctx, r.queryTimeout)
+	defer finish(&err)
+
+	result, err := r.db.ExecContext(ctx, "UPDATE users SET password = $1, updated_at = NOW() WHERE id = $2", passwordHash, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// RehashPassword swaps the stored hash for an equivalent one made with
+// current parameters. It leaves updated_at alone and returns sql.ErrNoRows
+// if the password changed since oldHash was read.
+func (r *PostgresUserRepository) RehashPassword(ctx context.Context, id uint, oldHash, newHash string) (err error) {
+	ctx, finish := withQueryTimeout(ctx, r.queryTimeout)
+	defer finish(&err)
+
+	result, err := r.db.ExecContext(ctx, "UPDATE users SET password = $1 WHERE id = $2 AND password = $3", newHash, id, oldHash)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// MarkEmailVerified records that the user proved ownership of their email.
+// Verifying an already verified user keeps the original time.
+func (r *PostgresUserRepository) MarkEmailVerified(ctx context.Context, id uint) (err error) {
+	ctx, finish := withQueryTimeout(ctx, r.queryTimeout)
+	defer finish(&err)
+
+	result, err := r.db.ExecContext(ctx,
+		"UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()), updated_at = NOW() WHERE id = $1",
+		id,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetRoles replaces every role of the user with roles.
+func (r *PostgresUserRepository) SetRoles(ctx context.Context, id uint, roles []string) (_ *models.User, err error) {
+	ctx, finish := withQueryTimeout(ctx, r.queryTimeout)
+	defer finish(&err)
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "UPDATE users SET updated_at = NOW() WHERE id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affected == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM user_roles WHERE user_id = $1", id); err != nil {
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO user_roles (user_id, role) SELECT $1, unnest($2::varchar[]) ON CONFLICT DO NOTHING",
+		id, pq.Array(roles),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := scanUser(tx.QueryRowContext(ctx, `SELECT `+userColumns+` FROM users u WHERE u.id = $1`, id))
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func scanUser(row rowScanner) (models.User, error) {
+	var user models.User
+	err := row.Scan(
+		&user.ID,
+		&user.Email,
+		&user.Password,
+		&user.Name,
+		&user.Bio,
+		&user.AvatarURL,
+		&user.Location,
+		&user.Website,
+		pq.Array(&user.Roles),
+		&user.EmailVerifiedAt,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+	return user, err
+}
@@ -0,0 +1,154 @@
+package router
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	swaggerFiles "github.com/swaggo/files"
+	ginSwagger "github.com/swaggo/gin-swagger"
+
+	"github.com/tamabsndra/miniproject/miniproject-backend/handlers"
+	"github.com/tamabsndra/miniproject/miniproject-backend/middleware"
+	"github.com/tamabsndra/miniproject/miniproject-backend/models"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/ratelimit"
+	"github.com/tamabsndra/miniproject/miniproject-backend/services"
+)
+
+// Per-IP limits for the unauthenticated email verification and password
+// reset endpoints.
+const (
+	verifyEmailLimit        = 10
+	resendVerificationLimit = 5
+	forgotPasswordLimit     = 5
+	emailLimitWindow        = time.Minute
+)
+
+type Config struct {
+	RequestTimeout time.Duration
+	// AllowedOrigins are the front-end origins allowed to make credentialed
+	// cross-origin requests.
+	AllowedOrigins []string
+	// TrustedProxies are the addresses or CIDR ranges whose X-Forwarded-For
+	// and X-Real-IP headers are believed. With none, the client IP is the
+	// connection's remote address, so clients cannot pick the IP that the
+	// login guard and rate limits count against.
+	TrustedProxies      []string
+	TokenService        *services.TokenService
+	APIKeyService       *services.APIKeyService
+	RBACService         *services.RBACService
+	VerificationService *services.EmailVerificationService
+	RateLimiter         *ratelimit.Limiter
+	AuthHandler         *handlers.AuthHandler
+	PostHandler         *handlers.PostHandler
+	HealthHandler       *handlers.HealthHandler
+	AdminHandler        *handlers.AdminHandler
+	UserHandler         *handlers.UserHandler
+	PasswordHandler     *handlers.PasswordHandler
+	VerificationHandler *handlers.VerificationHandler
+	SessionHandler      *handlers.SessionHandler
+	MFAHandler          *handlers.MFAHandler
+	JWKSHandler         *handlers.JWKSHandler
+	OIDCHandler         *handlers.OIDCHandler
+	APIKeyHandler       *handlers.APIKeyHandler
+}
+
+func New(cfg Config) (*gin.Engine, error) {
+	authHandler := cfg.AuthHandler
+	postHandler := cfg.PostHandler
+	adminHandler := cfg.AdminHandler
+	userHandler := cfg.UserHandler
+	passwordHandler := cfg.PasswordHandler
+	verificationHandler := cfg.VerificationHandler
+	sessionHandler := cfg.SessionHandler
+	mfaHandler := cfg.MFAHandler
+	oidcHandler := cfg.OIDCHandler
+	apiKeyHandler := cfg.APIKeyHandler
+
+	router := gin.Default()
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		return nil, err
+	}
+
+	router.Use(middleware.CORS(cfg.AllowedOrigins))
+	router.Use(middleware.Timeout(cfg.RequestTimeout))
+
+	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+
+	router.GET("/healthz", cfg.HealthHandler.Liveness)
+	router.GET("/readyz", cfg.HealthHandler.Readiness)
+	router.GET("/.well-known/jwks.json", cfg.JWKSHandler.Get)
+
+	api := router.Group("/api")
+	{
+		api.POST("/login", authHandler.Login)
+		api.POST("/login/mfa", authHandler.LoginMFA)
+		api.POST("/register", authHandler.Register)
+		api.POST("/refresh", authHandler.Refresh)
+		api.POST("/auth/oidc/:provider/start", oidcHandler.Start)
+		api.POST("/auth/oidc/:provider/callback", oidcHandler.Callback)
+		api.POST("/validate-token", authHandler.ValidateToken)
+		api.POST("/password/forgot",
+			middleware.RateLimit(cfg.RateLimiter, "password_forgot", forgotPasswordLimit, emailLimitWindow),
+			passwordHandler.Forgot)
+		api.POST("/password/reset", passwordHandler.Reset)
+		api.POST("/verify-email",
+			middleware.RateLimit(cfg.RateLimiter, "verify_email", verifyEmailLimit, emailLimitWindow),
+			verificationHandler.Verify)
+		api.POST("/verify-email/resend",
+			middleware.RateLimit(cfg.RateLimiter, "verify_email_resend", resendVerificationLimit, emailLimitWindow),
+			verificationHandler.Resend)
+		api.GET("/users/:id", userHandler.GetProfile)
+
+		protected := api.Group("")
+		protected.Use(middleware.AuthMiddleware(cfg.TokenService, cfg.APIKeyService))
+		{
+			protected.GET("/me", middleware.RequireScope(models.ScopeProfileRead), userHandler.GetMe)
+			protected.PATCH("/me", middleware.RequireScope(models.ScopeProfileWrite), userHandler.UpdateMe)
+
+			protected.POST("/posts", middleware.RequireScope(models.ScopePostsWrite), middleware.RequireVerifiedEmailToPost(cfg.VerificationService), postHandler.Create)
+			protected.GET("/posts", middleware.RequireScope(models.ScopePostsRead), postHandler.GetAll)
+			protected.GET("/post-detail", middleware.RequireScope(models.ScopePostsRead), postHandler.GetPostDetail)
+			protected.GET("/posts/search", middleware.RequireScope(models.ScopePostsRead), postHandler.Search)
+			protected.GET("/posts/trash", middleware.RequireScope(models.ScopePostsRead), postHandler.Trash)
+			protected.GET("/posts/:id", middleware.RequireScope(models.ScopePostsRead), postHandler.GetByID)
+			protected.GET("/posts/my/:id", middleware.RequireScope(models.ScopePostsRead), postHandler.GetByUserID)
+			protected.PUT("/posts/:id", middleware.RequireScope(models.ScopePostsWrite), postHandler.Update)
+			protected.DELETE("/posts/:id", middleware.RequireScope(models.ScopePostsWrite), postHandler.Delete)
+			protected.POST("/posts/:id/publish", middleware.RequireScope(models.ScopePostsWrite), postHandler.Publish)
+			protected.POST("/posts/:id/unpublish", middleware.RequireScope(models.ScopePostsWrite), postHandler.Unpublish)
+			protected.POST("/posts/:id/archive", middleware.RequireScope(models.ScopePostsWrite), postHandler.Archive)
+			protected.POST("/posts/:id/restore", middleware.RequireScope(models.ScopePostsWrite), postHandler.Restore)
+			protected.DELETE("/posts/:id/purge", middleware.RequireScope(models.ScopePostsWrite), postHandler.Purge)
+			protected.GET("/posts/:id/revisions", middleware.RequireScope(models.ScopePostsRead), postHandler.Revisions)
+			protected.GET("/posts/:id/revisions/diff", middleware.RequireScope(models.ScopePostsRead), postHandler.DiffRevisions)
+			protected.POST("/posts/:id/revisions/:revision/restore", middleware.RequireScope(models.ScopePostsWrite), postHandler.RestoreRevision)
+		}
+
+		// Account management needs a signed-in session, not an API key.
+		account := protected.Group("", middleware.RejectAPIKeys())
+		{
+			account.POST("/logout", authHandler.Logout)
+			account.POST("/logout-all", sessionHandler.LogoutAll)
+			account.GET("/sessions", sessionHandler.List)
+			account.DELETE("/sessions/:id", sessionHandler.Revoke)
+			account.POST("/me/password", authHandler.ChangePassword)
+			account.POST("/me/mfa/totp", mfaHandler.Setup)
+			account.POST("/me/mfa/totp/confirm", mfaHandler.Confirm)
+			account.POST("/me/mfa/totp/disable", mfaHandler.Disable)
+			account.GET("/me/api-keys", apiKeyHandler.List)
+			account.POST("/me/api-keys", apiKeyHandler.Create)
+			account.DELETE("/me/api-keys/:id", apiKeyHandler.Revoke)
+		}
+
+		admin := protected.Group("/admin", middleware.RequireScope(models.ScopeAdmin))
+		{
+			admin.GET("/users", middleware.RequirePermission(cfg.RBACService, models.PermissionUsersRead), adminHandler.ListUsers)
+			admin.PUT("/users/:id/roles", middleware.RequirePermission(cfg.RBACService, models.PermissionUsersManageRoles), adminHandler.UpdateUserRoles)
+			admin.POST("/users/:id/unlock", middleware.RequirePermission(cfg.RBACService, models.PermissionUsersUnlock), adminHandler.UnlockUser)
+			admin.PUT("/posts/:id", middleware.RequirePermission(cfg.RBACService, models.PermissionPostsModerate), adminHandler.UpdatePost)
+			admin.DELETE("/posts/:id", middleware.RequirePermission(cfg.RBACService, models.PermissionPostsModerate), adminHandler.DeletePost)
+		}
+	}
+
+	return router, nil
+}
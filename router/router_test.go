@@ -0,0 +1,1828 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/tamabsndra/miniproject/miniproject-backend/handlers"
+	"github.com/tamabsndra/miniproject/miniproject-backend/models"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/audit"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/keyring"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/mailer"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/oidc"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/oidc/oidctest"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/passhash"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/passpolicy"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/ratelimit"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/store"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/totp"
+	"github.com/tamabsndra/miniproject/miniproject-backend/repository"
+	"github.com/tamabsndra/miniproject/miniproject-backend/services"
+	"github.com/tamabsndra/miniproject/miniproject-backend/utils"
+)
+
+const testSecret = "test-secret"
+
+type testServer struct {
+	t      *testing.T
+	router *gin.Engine
+	users  *repository.MemoryUserRepository
+	posts  *repository.MemoryPostRepository
+	health *services.HealthService
+	mail   *recordingMailer
+	audit  *audit.MemoryRecorder
+	// background is waited for after each request, so tests see the mail
+	// sent off the request path.
+	background []interface{ Wait() }
+}
+
+// recordingMailer keeps sent messages so tests can read the links in them.
+type recordingMailer struct {
+	// delay makes each send take that long, like a slow SMTP server.
+	delay    time.Duration
+	mu       sync.Mutex
+	messages []mailer.Message
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg mailer.Message) error {
+	time.Sleep(m.delay)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// lastToken returns the token query parameter of the last link mailed to
+// the given address.
+func (m *recordingMailer) lastToken(t *testing.T, to string) string {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if m.messages[i].To != to {
+			continue
+		}
+		match := mailTokenPattern.FindStringSubmatch(m.messages[i].Body)
+		if match == nil {
+			t.Fatalf("mail to %s has no token link: %q", to, m.messages[i].Body)
+		}
+		token, err := url.QueryUnescape(match[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	t.Fatalf("no mail sent to %s", to)
+	return ""
+}
+
+var mailTokenPattern = regexp.MustCompile(`token=([^\s&]+)`)
+
+func newTestServer(t *testing.T, options ...func(*Config)) *testServer {
+	t.Helper()
+	return newTestServerWithPolicy(t, services.VerificationPolicy{}, options...)
+}
+
+func newTestServerWithPolicy(t *testing.T, policy services.VerificationPolicy, options ...func(*Config)) *testServer {
+	t.Helper()
+	return newTestServerWithSetup(t, testSetup{policy: policy}, options...)
+}
+
+// testSetup overrides dependencies that newTestServer otherwise defaults.
+type testSetup struct {
+	policy services.VerificationPolicy
+	// keys defaults to an HS256 keyring.
+	keys          *keyring.KeyRing
+	oidcProviders map[string]services.OIDCProvider
+	// hasher defaults to the cheapest bcrypt cost.
+	hasher *passhash.Hasher
+	// passwordPolicy defaults to a six character minimum.
+	passwordPolicy *passpolicy.Policy
+	// loginGuard defaults to defaultLoginGuardPolicy.
+	loginGuard *services.LoginGuardPolicy
+	// passwordResetCooldown defaults to a minute.
+	passwordResetCooldown time.Duration
+}
+
+var defaultLoginGuardPolicy = services.LoginGuardPolicy{
+	AccountFreeAttempts:     3,
+	IPFreeAttempts:          20,
+	BackoffBase:             time.Second,
+	BackoffMax:              time.Minute,
+	AccountLockoutThreshold: 10,
+	IPLockoutThreshold:      50,
+	LockoutDuration:         15 * time.Minute,
+	FailureWindow:           time.Hour,
+}
+
+func newTestServerWithSetup(t *testing.T, setup testSetup, options ...func(*Config)) *testServer {
+	t.Helper()
+	policy := setup.policy
+	keys := setup.keys
+	if keys == nil {
+		keys = keyring.NewHMAC(testSecret)
+	}
+	gin.SetMode(gin.TestMode)
+	gin.DefaultWriter = io.Discard
+
+	users := repository.NewMemoryUserRepository()
+	posts := repository.NewMemoryPostRepository(users)
+
+	memoryStore := store.NewMemoryStore()
+	signer := utils.NewTokenSigner(keys, "test-issuer", "test-audience")
+	tokenService := services.NewTokenService(memoryStore, 15*time.Minute, time.Hour, signer)
+	mail := &recordingMailer{}
+	limiter := ratelimit.New(memoryStore)
+	verificationService := services.NewEmailVerificationService(users, memoryStore, mail, limiter, policy, time.Hour, time.Minute, "http://app.test")
+	mfaService := services.NewMFAService(repository.NewMemoryMFARepository(), users, tokenService, memoryStore, limiter, "Test", 5*time.Minute)
+	hasher := setup.hasher
+	if hasher == nil {
+		var err error
+		if hasher, err = passhash.NewBcrypt(bcrypt.MinCost); err != nil {
+			t.Fatal(err)
+		}
+	}
+	passwordPolicy := setup.passwordPolicy
+	if passwordPolicy == nil {
+		passwordPolicy = &passpolicy.Policy{MinLength: 6}
+	}
+	loginGuardPolicy := defaultLoginGuardPolicy
+	if setup.loginGuard != nil {
+		loginGuardPolicy = *setup.loginGuard
+	}
+	passwordResetCooldown := setup.passwordResetCooldown
+	if passwordResetCooldown == 0 {
+		passwordResetCooldown = time.Minute
+	}
+	auditRecorder := &audit.MemoryRecorder{}
+	loginGuard := services.NewLoginGuard(memoryStore, users, auditRecorder, loginGuardPolicy)
+	authService := services.NewAuthService(users, hasher, passwordPolicy, tokenService, verificationService, mfaService, loginGuard)
+	oidcService := services.NewOIDCService(setup.oidcProviders, repository.NewMemoryIdentityRepository(), users, hasher, authService, memoryStore, 10*time.Minute)
+	apiKeyService := services.NewAPIKeyService(repository.NewMemoryAPIKeyRepository(), users)
+	postService := services.NewPostService(posts)
+	userService := services.NewUserService(users, tokenService)
+	passwordResetService := services.NewPasswordResetService(users, hasher, passwordPolicy, memoryStore, limiter, tokenService, mail, time.Hour, passwordResetCooldown, "http://app.test")
+	healthService := services.NewHealthService(time.Second, services.HealthCheck{
+		Name: "store",
+		Check: func(ctx context.Context) error {
+			_, err := memoryStore.Exists(ctx, "health")
+			return err
+		},
+	})
+
+	cfg := Config{
+		AllowedOrigins:      []string{"http://app.test"},
+		TokenService:        tokenService,
+		APIKeyService:       apiKeyService,
+		RBACService:         services.NewRBACService(repository.NewMemoryRoleRepository()),
+		VerificationService: verificationService,
+		RateLimiter:         limiter,
+		AuthHandler:         handlers.NewAuthHandler(authService, tokenService),
+		PostHandler:         handlers.NewPostHandler(postService),
+		HealthHandler:       handlers.NewHealthHandler(healthService),
+		AdminHandler:        handlers.NewAdminHandler(userService, postService, loginGuard),
+		UserHandler:         handlers.NewUserHandler(userService),
+		PasswordHandler:     handlers.NewPasswordHandler(passwordResetService),
+		VerificationHandler: handlers.NewVerificationHandler(verificationService),
+		SessionHandler:      handlers.NewSessionHandler(tokenService),
+		MFAHandler:          handlers.NewMFAHandler(mfaService),
+		JWKSHandler:         handlers.NewJWKSHandler(keys),
+		OIDCHandler:         handlers.NewOIDCHandler(oidcService),
+		APIKeyHandler:       handlers.NewAPIKeyHandler(apiKeyService),
+	}
+	for _, option := range options {
+		option(&cfg)
+	}
+	router, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testServer{
+		t:          t,
+		router:     router,
+		users:      users,
+		posts:      posts,
+		health:     healthService,
+		mail:       mail,
+		audit:      auditRecorder,
+		background: []interface{ Wait() }{passwordResetService, verificationService},
+	}
+}
+
+// createUser inserts a user directly with a cheap bcrypt hash so tests do
+// not pay the production hashing cost on every login.
+func (s *testServer) createUser(email, password string, roles ...string) models.User {
+	s.t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	user := models.User{Email: email, Password: string(hash), Name: email, Roles: roles}
+	if err := s.users.Create(context.Background(), &user); err != nil {
+		s.t.Fatal(err)
+	}
+	return user
+}
+
+func (s *testServer) login(email, password string) models.LoginResponse {
+	s.t.Helper()
+	var resp models.LoginResponse
+	s.do(http.MethodPost, "/api/login", "", models.LoginRequest{Email: email, Password: password}, http.StatusOK, &resp)
+	return resp
+}
+
+func (s *testServer) do(method, path, token string, body interface{}, wantStatus int, out interface{}) {
+	s.t.Helper()
+
+	rec := s.raw(method, path, token, body)
+	if rec.Code != wantStatus {
+		s.t.Fatalf("%s %s: status = %d, want %d; body: %s", method, path, rec.Code, wantStatus, rec.Body.String())
+	}
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			s.t.Fatalf("%s %s: decode response: %v", method, path, err)
+		}
+	}
+}
+
+// raw performs the request and returns the recorded response without
+// checking it.
+func (s *testServer) raw(method, path, token string, body interface{}) *httptest.ResponseRecorder {
+	s.t.Helper()
+	authorization := ""
+	if token != "" {
+		authorization = "Bearer " + token
+	}
+	return s.rawWithAuthorization(method, path, authorization, body)
+}
+
+func (s *testServer) rawWithAuthorization(method, path, authorization string, body interface{}) *httptest.ResponseRecorder {
+	s.t.Helper()
+	header := http.Header{}
+	if authorization != "" {
+		header.Set("Authorization", authorization)
+	}
+	return s.rawWithHeader(method, path, header, body)
+}
+
+// rawWithHeader sends the request with header added. httptest gives every
+// request the remote address 192.0.2.1.
+func (s *testServer) rawWithHeader(method, path string, header http.Header, body interface{}) *httptest.ResponseRecorder {
+	s.t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	for _, service := range s.background {
+		service.Wait()
+	}
+	return rec
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	s := newTestServer(t)
+
+	s.do(http.MethodPost, "/api/register", "", models.RegisterRequest{
+		Email:    "alice@example.com",
+		Password: "secret123",
+		Name:     "Alice",
+	}, http.StatusOK, nil)
+
+	resp := s.login("alice@example.com", "secret123")
+	if resp.Token == "" || resp.RefreshToken == "" {
+		t.Fatalf("login returned empty tokens: %+v", resp)
+	}
+	if resp.User.Password != "" {
+		t.Fatal("login response leaked the password hash")
+	}
+
+	s.do(http.MethodPost, "/api/login", "", models.LoginRequest{
+		Email:    "alice@example.com",
+		Password: "wrong",
+	}, http.StatusUnauthorized, nil)
+}
+
+func TestProtectedRoutesRequireToken(t *testing.T) {
+	s := newTestServer(t)
+
+	s.do(http.MethodGet, "/api/posts", "", nil, http.StatusUnauthorized, nil)
+	s.do(http.MethodGet, "/api/posts", "not-a-jwt", nil, http.StatusUnauthorized, nil)
+}
+
+func TestRequestTimeoutReturnsGatewayTimeout(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.RequestTimeout = time.Nanosecond
+	})
+
+	s.do(http.MethodPost, "/api/login", "", models.LoginRequest{
+		Email:    "alice@example.com",
+		Password: "secret123",
+	}, http.StatusGatewayTimeout, nil)
+}
+
+func TestRefreshRotatesAndDetectsReuse(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("alice@example.com", "secret123")
+	login := s.login("alice@example.com", "secret123")
+
+	var rotated models.TokenPair
+	s.do(http.MethodPost, "/api/refresh", "", models.RefreshTokenRequest{RefreshToken: login.RefreshToken}, http.StatusOK, &rotated)
+	if rotated.RefreshToken == login.RefreshToken {
+		t.Fatal("refresh token was not rotated")
+	}
+	s.do(http.MethodGet, "/api/posts", rotated.Token, nil, http.StatusOK, nil)
+
+	// Replaying the first refresh token revokes the family, including the
+	// token that replaced it.
+	s.do(http.MethodPost, "/api/refresh", "", models.RefreshTokenRequest{RefreshToken: login.RefreshToken}, http.StatusUnauthorized, nil)
+	s.do(http.MethodPost, "/api/refresh", "", models.RefreshTokenRequest{RefreshToken: rotated.RefreshToken}, http.StatusUnauthorized, nil)
+
+	// An access token is not accepted as a refresh token.
+	s.do(http.MethodPost, "/api/refresh", "", models.RefreshTokenRequest{RefreshToken: rotated.Token}, http.StatusUnauthorized, nil)
+}
+
+func TestLogoutRevokesTokens(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("alice@example.com", "secret123")
+	login := s.login("alice@example.com", "secret123")
+
+	s.do(http.MethodPost, "/api/logout", login.Token, nil, http.StatusOK, nil)
+	s.do(http.MethodGet, "/api/posts", login.Token, nil, http.StatusUnauthorized, nil)
+	s.do(http.MethodPost, "/api/refresh", "", models.RefreshTokenRequest{RefreshToken: login.RefreshToken}, http.StatusUnauthorized, nil)
+
+	var result models.TokenValidationResult
+	s.do(http.MethodPost, "/api/validate-token", "", models.ValidateTokenRequest{Token: login.Token}, http.StatusOK, &result)
+	if result.Valid {
+		t.Fatal("revoked token reported as valid")
+	}
+}
+
+func TestPostOwnership(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("alice@example.com", "secret123")
+	s.createUser("bob@example.com", "secret123")
+	alice := s.login("alice@example.com", "secret123").Token
+	bob := s.login("bob@example.com", "secret123").Token
+
+	var post models.Post
+	s.do(http.MethodPost, "/api/posts", alice, models.CreatePostRequest{
+		Title:   "Hello world",
+		Content: "The very first post.",
+	}, http.StatusCreated, &post)
+
+	path := fmt.Sprintf("/api/posts/%d", post.ID)
+	update := models.UpdatePostRequest{Title: "Hijacked", Content: "Not my post to edit."}
+
+	s.do(http.MethodPut, path, bob, update, http.StatusForbidden, nil)
+	s.do(http.MethodDelete, path, bob, nil, http.StatusForbidden, nil)
+	s.do(http.MethodPut, "/api/posts/999", alice, update, http.StatusNotFound, nil)
+	s.do(http.MethodDelete, "/api/posts/999", alice, nil, http.StatusNotFound, nil)
+
+	var updated models.Post
+	s.do(http.MethodPut, path, alice, models.UpdatePostRequest{
+		Title:   "Hello again",
+		Content: "The very first post, edited.",
+	}, http.StatusOK, &updated)
+	if updated.Title != "Hello again" {
+		t.Fatalf("title = %q, want %q", updated.Title, "Hello again")
+	}
+
+	s.do(http.MethodDelete, path, alice, nil, http.StatusOK, nil)
+	s.do(http.MethodGet, path, alice, nil, http.StatusNotFound, nil)
+}
+
+func TestPostLifecycle(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("alice@example.com", "secret123")
+	s.createUser("bob@example.com", "secret123")
+	alice := s.login("alice@example.com", "secret123").Token
+	bob := s.login("bob@example.com", "secret123").Token
+
+	var post models.Post
+	s.do(http.MethodPost, "/api/posts", alice, models.CreatePostRequest{Title: "Lifecycle", Content: "A post that changes state."}, http.StatusCreated, &post)
+	if post.Status != models.PostStatusDraft || post.PublishedAt != nil {
+		t.Fatalf("new post = %s at %v, want an unpublished draft", post.Status, post.PublishedAt)
+	}
+	path := fmt.Sprintf("/api/posts/%d", post.ID)
+
+	visible := func(token string) bool {
+		t.Helper()
+		var page models.PostPage
+		s.do(http.MethodGet, "/api/posts", token, nil, http.StatusOK, &page)
+		var details models.PostWithUserPage
+		s.do(http.MethodGet, "/api/post-detail", token, nil, http.StatusOK, &details)
+		var results models.PostSearchPage
+		s.do(http.MethodGet, "/api/posts/search?q=lifecycle", token, nil, http.StatusOK, &results)
+
+		status := http.StatusOK
+		listed := len(page.Data) == 1 && len(details.Data) == 1 && len(results.Data) == 1
+		if !listed {
+			status = http.StatusNotFound
+			if len(page.Data)+len(details.Data)+len(results.Data) != 0 {
+				t.Fatalf("post listed inconsistently: %d posts, %d details, %d results", len(page.Data), len(details.Data), len(results.Data))
+			}
+		}
+		s.do(http.MethodGet, path, token, nil, status, nil)
+		return listed
+	}
+
+	if !visible(alice) || visible(bob) {
+		t.Fatal("draft should be visible to its author only")
+	}
+	s.do(http.MethodPost, path+"/publish", bob, nil, http.StatusForbidden, nil)
+
+	s.do(http.MethodPost, path+"/publish", alice, nil, http.StatusOK, &post)
+	if post.Status != models.PostStatusPublished || post.PublishedAt == nil {
+		t.Fatalf("published post = %s at %v", post.Status, post.PublishedAt)
+	}
+	if !visible(bob) {
+		t.Fatal("published post is hidden")
+	}
+
+	s.do(http.MethodPost, path+"/unpublish", alice, nil, http.StatusOK, &post)
+	if post.Status != models.PostStatusDraft || visible(bob) {
+		t.Fatalf("unpublished post = %s, want a hidden draft", post.Status)
+	}
+
+	publishAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	s.do(http.MethodPost, path+"/publish", alice, models.PublishPostRequest{PublishAt: &publishAt}, http.StatusOK, &post)
+	if post.Status != models.PostStatusScheduled || !post.PublishedAt.Equal(publishAt) || visible(bob) {
+		t.Fatalf("scheduled post = %s at %v, want hidden until %v", post.Status, post.PublishedAt, publishAt)
+	}
+
+	// Run the scheduler as it would after the hour has passed.
+	if n, err := s.posts.PublishDue(context.Background(), time.Now()); err != nil || n != 0 {
+		t.Fatalf("PublishDue(now) = %d, %v, want nothing due", n, err)
+	}
+	if n, err := s.posts.PublishDue(context.Background(), publishAt); err != nil || n != 1 {
+		t.Fatalf("PublishDue(publish_at) = %d, %v, want 1", n, err)
+	}
+	s.do(http.MethodGet, path, bob, nil, http.StatusOK, &post)
+	if post.Status != models.PostStatusPublished || !post.PublishedAt.Equal(publishAt) {
+		t.Fatalf("post after schedule = %s at %v", post.Status, post.PublishedAt)
+	}
+
+	s.do(http.MethodPost, path+"/archive", alice, nil, http.StatusOK, &post)
+	if post.Status != models.PostStatusArchived || post.PublishedAt == nil || visible(bob) {
+		t.Fatalf("archived post = %s at %v, want hidden with its publication time", post.Status, post.PublishedAt)
+	}
+
+	var scheduled models.Post
+	s.do(http.MethodPost, "/api/posts", alice, models.CreatePostRequest{Title: "Later", Content: "Scheduled from the start.", Status: models.PostStatusScheduled}, http.StatusBadRequest, nil)
+	s.do(http.MethodPost, "/api/posts", alice, models.CreatePostRequest{Title: "Later", Content: "Scheduled from the start.", Status: models.PostStatusScheduled, PublishAt: &publishAt}, http.StatusCreated, &scheduled)
+	if scheduled.Status != models.PostStatusScheduled {
+		t.Fatalf("created post status = %s, want scheduled", scheduled.Status)
+	}
+
+	var mine models.PostPage
+	s.do(http.MethodGet, "/api/posts?status=scheduled", alice, nil, http.StatusOK, &mine)
+	if len(mine.Data) != 1 || mine.Data[0].ID != scheduled.ID {
+		t.Fatalf("status filter returned %+v, want only the scheduled post", mine.Data)
+	}
+}
+
+func TestPostRevisions(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("alice@example.com", "secret123")
+	s.createUser("bob@example.com", "secret123")
+	alice := s.login("alice@example.com", "secret123").Token
+	bob := s.login("bob@example.com", "secret123").Token
+
+	var post models.Post
+	s.do(http.MethodPost, "/api/posts", alice, models.CreatePostRequest{Title: "First title", Content: "one\ntwo\nthree\n"}, http.StatusCreated, &post)
+	path := fmt.Sprintf("/api/posts/%d", post.ID)
+	s.do(http.MethodPut, path, alice, models.UpdatePostRequest{Title: "Second title", Content: "one\n2\nthree\n"}, http.StatusOK, nil)
+	s.do(http.MethodPut, path, alice, models.UpdatePostRequest{Title: "Third title", Content: "one\n2\nthree\nfour\n"}, http.StatusOK, nil)
+
+	var revisions []models.PostRevision
+	s.do(http.MethodGet, path+"/revisions", alice, nil, http.StatusOK, &revisions)
+	if len(revisions) != 3 || revisions[0].Revision != 3 || revisions[0].Title != "Third title" || revisions[2].Title != "First title" {
+		t.Fatalf("revisions = %+v, want 3 newest first", revisions)
+	}
+	if revisions[0].EditorID == nil || *revisions[0].EditorID != post.UserID {
+		t.Fatalf("editor = %v, want the author", revisions[0].EditorID)
+	}
+	s.do(http.MethodGet, path+"/revisions", bob, nil, http.StatusForbidden, nil)
+
+	var diff models.PostRevisionDiff
+	s.do(http.MethodGet, path+"/revisions/diff?from=1&to=2", alice, nil, http.StatusOK, &diff)
+	wantTitle := []models.DiffSegment{{Op: "delete", Text: "First"}, {Op: "insert", Text: "Second"}, {Op: "equal", Text: " title"}}
+	if fmt.Sprint(diff.Title) != fmt.Sprint(wantTitle) {
+		t.Fatalf("title diff = %+v, want %+v", diff.Title, wantTitle)
+	}
+	wantUnified := "--- revision 1\n+++ revision 2\n@@ -1,3 +1,3 @@\n one\n-two\n+2\n three\n"
+	if diff.Unified != wantUnified {
+		t.Fatalf("unified diff = %q, want %q", diff.Unified, wantUnified)
+	}
+	s.do(http.MethodGet, path+"/revisions/diff?from=1", alice, nil, http.StatusBadRequest, nil)
+	s.do(http.MethodGet, path+"/revisions/diff?from=1&to=9", alice, nil, http.StatusNotFound, nil)
+
+	s.do(http.MethodPost, path+"/revisions/1/restore", bob, nil, http.StatusForbidden, nil)
+	s.do(http.MethodPost, path+"/revisions/9/restore", alice, nil, http.StatusNotFound, nil)
+	s.do(http.MethodPost, path+"/revisions/1/restore", alice, nil, http.StatusOK, &post)
+	if post.Title != "First title" || post.Content != "one\ntwo\nthree\n" {
+		t.Fatalf("restored post = %q %q, want revision 1", post.Title, post.Content)
+	}
+	s.do(http.MethodGet, path+"/revisions", alice, nil, http.StatusOK, &revisions)
+	if len(revisions) != 4 || revisions[0].Revision != 4 || revisions[0].Title != "First title" {
+		t.Fatalf("revisions after restore = %+v, want a new revision 4", revisions)
+	}
+}
+
+func TestPostTrash(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("alice@example.com", "secret123")
+	s.createUser("bob@example.com", "secret123")
+	alice := s.login("alice@example.com", "secret123").Token
+	bob := s.login("bob@example.com", "secret123").Token
+
+	var post models.Post
+	s.do(http.MethodPost, "/api/posts", alice, models.CreatePostRequest{Title: "Trashable", Content: "A post that gets deleted.", Status: models.PostStatusPublished}, http.StatusCreated, &post)
+	path := fmt.Sprintf("/api/posts/%d", post.ID)
+
+	listed := func() int {
+		t.Helper()
+		var page models.PostPage
+		s.do(http.MethodGet, "/api/posts", bob, nil, http.StatusOK, &page)
+		var details models.PostWithUserPage
+		s.do(http.MethodGet, "/api/post-detail", bob, nil, http.StatusOK, &details)
+		var results models.PostSearchPage
+		s.do(http.MethodGet, "/api/posts/search?q=trashable", bob, nil, http.StatusOK, &results)
+		return len(page.Data) + len(details.Data) + len(results.Data)
+	}
+	trash := func(token string) []models.Post {
+		t.Helper()
+		var page models.PostPage
+		s.do(http.MethodGet, "/api/posts/trash", token, nil, http.StatusOK, &page)
+		return page.Data
+	}
+
+	s.do(http.MethodPost, path+"/restore", alice, nil, http.StatusNotFound, nil)
+	s.do(http.MethodDelete, path+"/purge", alice, nil, http.StatusNotFound, nil)
+
+	s.do(http.MethodDelete, path, alice, nil, http.StatusOK, nil)
+	if n := listed(); n != 0 {
+		t.Fatalf("deleted post listed %d times", n)
+	}
+	s.do(http.MethodGet, path, alice, nil, http.StatusNotFound, nil)
+	s.do(http.MethodPut, path, alice, models.UpdatePostRequest{Title: "Edited", Content: "Edited in the trash."}, http.StatusNotFound, nil)
+	s.do(http.MethodDelete, path, alice, nil, http.StatusNotFound, nil)
+
+	if trashed := trash(alice); len(trashed) != 1 || trashed[0].ID != post.ID || trashed[0].DeletedAt == nil {
+		t.Fatalf("trash = %+v, want the deleted post", trashed)
+	}
+	if trashed := trash(bob); len(trashed) != 0 {
+		t.Fatalf("bob's trash = %+v, want empty", trashed)
+	}
+
+	s.do(http.MethodPost, path+"/restore", bob, nil, http.StatusForbidden, nil)
+	s.do(http.MethodPost, path+"/restore", alice, nil, http.StatusOK, &post)
+	if post.DeletedAt != nil || post.Status != models.PostStatusPublished || listed() != 3 || len(trash(alice)) != 0 {
+		t.Fatalf("restored post = %+v, want it live and published again", post)
+	}
+
+	s.do(http.MethodDelete, path, alice, nil, http.StatusOK, nil)
+	s.do(http.MethodDelete, path+"/purge", bob, nil, http.StatusForbidden, nil)
+	s.do(http.MethodDelete, path+"/purge", alice, nil, http.StatusOK, nil)
+	if len(trash(alice)) != 0 {
+		t.Fatal("purged post is still in the trash")
+	}
+	s.do(http.MethodPost, path+"/restore", alice, nil, http.StatusNotFound, nil)
+
+	// The purge job only removes posts trashed before the retention cutoff.
+	var old models.Post
+	s.do(http.MethodPost, "/api/posts", alice, models.CreatePostRequest{Title: "Old news", Content: "Deleted a while ago."}, http.StatusCreated, &old)
+	s.do(http.MethodDelete, fmt.Sprintf("/api/posts/%d", old.ID), alice, nil, http.StatusOK, nil)
+	if n, err := s.posts.PurgeDeletedBefore(context.Background(), time.Now().Add(-time.Hour)); err != nil || n != 0 {
+		t.Fatalf("PurgeDeletedBefore(an hour ago) = %d, %v, want nothing purged", n, err)
+	}
+	if n, err := s.posts.PurgeDeletedBefore(context.Background(), time.Now().Add(time.Second)); err != nil || n != 1 {
+		t.Fatalf("PurgeDeletedBefore(now) = %d, %v, want 1", n, err)
+	}
+	if len(trash(alice)) != 0 {
+		t.Fatal("expired post is still in the trash")
+	}
+}
+
+func TestPostListPagination(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("alice@example.com", "secret123")
+	token := s.login("alice@example.com", "secret123").Token
+
+	for i := 1; i <= 5; i++ {
+		s.do(http.MethodPost, "/api/posts", token, models.CreatePostRequest{
+			Title:   fmt.Sprintf("Post number %d", i),
+			Content: "Some content for the post.",
+		}, http.StatusCreated, nil)
+	}
+
+	var first models.PostPage
+	s.do(http.MethodGet, "/api/posts?sort_by=id&order=asc&limit=2", token, nil, http.StatusOK, &first)
+	if first.Pagination.Total != 5 || len(first.Data) != 2 || first.Data[0].ID != 1 {
+		t.Fatalf("unexpected first page: %+v", first)
+	}
+	if first.Pagination.NextCursor == "" || first.Pagination.PrevCursor != "" {
+		t.Fatalf("unexpected cursors on first page: %+v", first.Pagination)
+	}
+
+	var second models.PostPage
+	s.do(http.MethodGet, "/api/posts?sort_by=id&order=asc&limit=2&cursor="+url.QueryEscape(first.Pagination.NextCursor), token, nil, http.StatusOK, &second)
+	if len(second.Data) != 2 || second.Data[0].ID != 3 {
+		t.Fatalf("unexpected second page: %+v", second)
+	}
+
+	var back models.PostPage
+	s.do(http.MethodGet, "/api/posts?sort_by=id&order=asc&limit=2&cursor="+url.QueryEscape(second.Pagination.PrevCursor), token, nil, http.StatusOK, &back)
+	if len(back.Data) != 2 || back.Data[0].ID != 1 || back.Data[1].ID != 2 {
+		t.Fatalf("prev cursor did not return the first page: %+v", back)
+	}
+
+	var offset models.PostPage
+	s.do(http.MethodGet, "/api/posts?limit=2&offset=4", token, nil, http.StatusOK, &offset)
+	if len(offset.Data) != 1 || offset.Data[0].ID != 1 || offset.Pagination.NextCursor != "" {
+		t.Fatalf("unexpected offset page: %+v", offset)
+	}
+
+	var filtered models.PostPage
+	s.do(http.MethodGet, "/api/posts?title=number+3", token, nil, http.StatusOK, &filtered)
+	if filtered.Pagination.Total != 1 || filtered.Data[0].Title != "Post number 3" {
+		t.Fatalf("unexpected filtered page: %+v", filtered)
+	}
+
+	// Cursors are bound to the ordering they were issued for.
+	s.do(http.MethodGet, "/api/posts?sort_by=title&cursor="+url.QueryEscape(first.Pagination.NextCursor), token, nil, http.StatusBadRequest, nil)
+	s.do(http.MethodGet, "/api/posts?limit=1000", token, nil, http.StatusBadRequest, nil)
+}
+
+func TestPostSearch(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("alice@example.com", "secret123")
+	token := s.login("alice@example.com", "secret123").Token
+
+	s.do(http.MethodPost, "/api/posts", token, models.CreatePostRequest{
+		Title:   "Gardening tips",
+		Content: "Tomatoes need plenty of sunlight.",
+	}, http.StatusCreated, nil)
+	s.do(http.MethodPost, "/api/posts", token, models.CreatePostRequest{
+		Title:   "Cooking pasta",
+		Content: "Use ripe tomatoes for the sauce.",
+	}, http.StatusCreated, nil)
+
+	var results models.PostSearchPage
+	s.do(http.MethodGet, "/api/posts/search?q=tomatoes", token, nil, http.StatusOK, &results)
+	if results.Pagination.Total != 2 {
+		t.Fatalf("total = %d, want 2", results.Pagination.Total)
+	}
+
+	s.do(http.MethodGet, "/api/posts/search?q=garden&mode=prefix", token, nil, http.StatusOK, &results)
+	if results.Pagination.Total != 1 || results.Data[0].Title != "Gardening tips" {
+		t.Fatalf("unexpected prefix results: %+v", results)
+	}
+
+	s.do(http.MethodGet, "/api/posts/search", token, nil, http.StatusBadRequest, nil)
+
+	// Highlights are HTML: the post's own markup must come back escaped.
+	s.do(http.MethodPost, "/api/posts", token, models.CreatePostRequest{
+		Title:   "Salsa <script>alert(1)</script>",
+		Content: `Blend the salsa <img src=x onerror="alert(1)"> until smooth.`,
+	}, http.StatusCreated, nil)
+	s.do(http.MethodGet, "/api/posts/search?q=salsa", token, nil, http.StatusOK, &results)
+	if results.Pagination.Total != 1 {
+		t.Fatalf("total = %d, want 1", results.Pagination.Total)
+	}
+	result := results.Data[0]
+	if result.TitleHighlight != "<mark>Salsa</mark> &lt;script&gt;alert(1)&lt;/script&gt;" {
+		t.Fatalf("title highlight = %q", result.TitleHighlight)
+	}
+	if strings.Contains(result.Snippet, "<img") || !strings.Contains(result.Snippet, "<mark>salsa</mark> &lt;img") {
+		t.Fatalf("snippet = %q, want the markup escaped", result.Snippet)
+	}
+}
+
+func TestPostSearchModes(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("alice@example.com", "secret123")
+	token := s.login("alice@example.com", "secret123").Token
+
+	var basics, weeknight, fish models.Post
+	s.do(http.MethodPost, "/api/posts", token, models.CreatePostRequest{Title: "Tomato sauce basics", Content: "Simmer ripe tomatoes slowly."}, http.StatusCreated, &basics)
+	s.do(http.MethodPost, "/api/posts", token, models.CreatePostRequest{Title: "Sauce with tomato", Content: "A quick weeknight dinner."}, http.StatusCreated, &weeknight)
+	s.do(http.MethodPost, "/api/posts", token, models.CreatePostRequest{Title: "Fish & <b>chips</b>", Content: `Crispy fish, "battered" & <i>salted</i>.`}, http.StatusCreated, &fish)
+
+	search := func(query string, want ...uint) models.PostSearchPage {
+		t.Helper()
+		var results models.PostSearchPage
+		s.do(http.MethodGet, "/api/posts/search?"+query, token, nil, http.StatusOK, &results)
+		var got []uint
+		for _, result := range results.Data {
+			got = append(got, result.ID)
+		}
+		slices.Sort(got)
+		slices.Sort(want)
+		if !slices.Equal(got, want) {
+			t.Fatalf("search %s = posts %v, want %v", query, got, want)
+		}
+		return results
+	}
+
+	// Both posts have both words; only one has them as a phrase.
+	search("q=tomato+sauce", basics.ID, weeknight.ID)
+	phrase := search("q=tomato+sauce&mode=phrase", basics.ID)
+	if phrase.Data[0].TitleHighlight != "<mark>Tomato</mark> <mark>sauce</mark> basics" {
+		t.Fatalf("phrase title highlight = %q", phrase.Data[0].TitleHighlight)
+	}
+	search("q=sauce+with+tomato&mode=phrase", weeknight.ID)
+
+	// Prefixes match the start of words only.
+	search("q=tomat&mode=prefix", basics.ID, weeknight.ID)
+	search("q=simm&mode=prefix", basics.ID)
+	search("q=immer&mode=prefix")
+	search("q=tomat")
+
+	// Highlights are HTML, so the posts' own markup and quotes come back
+	// escaped around the marks.
+	escaped := search("q=fish", fish.ID)
+	if got := escaped.Data[0].TitleHighlight; got != "<mark>Fish</mark> &amp; &lt;b&gt;chips&lt;/b&gt;" {
+		t.Fatalf("title highlight = %q", got)
+	}
+	if got := escaped.Data[0].Snippet; !strings.Contains(got, "<mark>fish") || !strings.Contains(got, "&#34;battered&#34; &amp; &lt;i&gt;salted&lt;/i&gt;") {
+		t.Fatalf("snippet = %q, want the match marked and the rest escaped", got)
+	}
+}
+
+func TestHealthProbes(t *testing.T) {
+	s := newTestServer(t)
+
+	var live models.HealthReport
+	s.do(http.MethodGet, "/healthz", "", nil, http.StatusOK, &live)
+	if live.Status != models.HealthStatusUp {
+		t.Fatalf("liveness status = %q, want up", live.Status)
+	}
+
+	var ready models.HealthReport
+	s.do(http.MethodGet, "/readyz", "", nil, http.StatusOK, &ready)
+	if ready.Checks["store"].Status != models.HealthStatusUp {
+		t.Fatalf("readiness checks = %+v, want store up", ready.Checks)
+	}
+
+	s.health.SetShuttingDown()
+	s.do(http.MethodGet, "/readyz", "", nil, http.StatusServiceUnavailable, &ready)
+	if !ready.ShuttingDown {
+		t.Fatal("readiness during shutdown did not report shutting_down")
+	}
+	s.do(http.MethodGet, "/healthz", "", nil, http.StatusOK, nil)
+}
+
+func TestReadinessReportsFailingDependency(t *testing.T) {
+	health := services.NewHealthService(10*time.Millisecond,
+		services.HealthCheck{Name: "ok", Check: func(ctx context.Context) error { return nil }},
+		services.HealthCheck{Name: "slow", Check: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}},
+	)
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.HealthHandler = handlers.NewHealthHandler(health)
+	})
+
+	var report models.HealthReport
+	s.do(http.MethodGet, "/readyz", "", nil, http.StatusServiceUnavailable, &report)
+	if report.Status != models.HealthStatusDown {
+		t.Fatalf("status = %q, want down", report.Status)
+	}
+	if report.Checks["ok"].Status != models.HealthStatusUp {
+		t.Fatalf("ok check = %+v, want up", report.Checks["ok"])
+	}
+	if slow := report.Checks["slow"]; slow.Status != models.HealthStatusDown || slow.Error == "" {
+		t.Fatalf("slow check = %+v, want down with an error", slow)
+	}
+}
+
+func TestAdminRequiresPermissions(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("admin@example.com", "secret123", models.RoleAdmin)
+	s.createUser("mod@example.com", "secret123", models.RoleModerator)
+	author := s.createUser("author@example.com", "secret123")
+
+	admin := s.login("admin@example.com", "secret123").Token
+	mod := s.login("mod@example.com", "secret123").Token
+	user := s.login("author@example.com", "secret123").Token
+
+	var post models.Post
+	s.do(http.MethodPost, "/api/posts", user, models.CreatePostRequest{Title: "Hello", Content: "Hello, moderators"}, http.StatusCreated, &post)
+
+	s.do(http.MethodGet, "/api/admin/users", user, nil, http.StatusForbidden, nil)
+	s.do(http.MethodGet, "/api/admin/users", mod, nil, http.StatusForbidden, nil)
+	s.do(http.MethodDelete, fmt.Sprintf("/api/admin/posts/%d", post.ID), user, nil, http.StatusForbidden, nil)
+
+	var page models.UserPage
+	s.do(http.MethodGet, "/api/admin/users?role=moderator", admin, nil, http.StatusOK, &page)
+	if page.Pagination.Total != 1 || page.Data[0].Email != "mod@example.com" {
+		t.Fatalf("moderators = %+v, want only mod@example.com", page)
+	}
+	if page.Data[0].Password != "" {
+		t.Fatal("user listing leaked a password hash")
+	}
+
+	s.do(http.MethodPut, fmt.Sprintf("/api/admin/posts/%d", post.ID), mod, models.UpdatePostRequest{Title: "Edited", Content: "By a moderator"}, http.StatusOK, nil)
+	s.do(http.MethodDelete, fmt.Sprintf("/api/admin/posts/%d", post.ID), mod, nil, http.StatusOK, nil)
+
+	// A moderator's removal sticks: the author sees the post in the trash
+	// but cannot restore it, even after trashing it themselves first.
+	var trash models.PostPage
+	s.do(http.MethodGet, "/api/posts/trash", user, nil, http.StatusOK, &trash)
+	if len(trash.Data) != 1 || !trash.Data[0].RemovedByModerator {
+		t.Fatalf("trash = %+v, want the removed post", trash.Data)
+	}
+	s.do(http.MethodPost, fmt.Sprintf("/api/posts/%d/restore", post.ID), user, nil, http.StatusForbidden, nil)
+
+	var trashed models.Post
+	s.do(http.MethodPost, "/api/posts", user, models.CreatePostRequest{Title: "Again", Content: "Trashed before removal"}, http.StatusCreated, &trashed)
+	s.do(http.MethodDelete, fmt.Sprintf("/api/posts/%d", trashed.ID), user, nil, http.StatusOK, nil)
+	s.do(http.MethodDelete, fmt.Sprintf("/api/admin/posts/%d", trashed.ID), mod, nil, http.StatusOK, nil)
+	s.do(http.MethodPost, fmt.Sprintf("/api/posts/%d/restore", trashed.ID), user, nil, http.StatusForbidden, nil)
+	s.do(http.MethodDelete, fmt.Sprintf("/api/posts/%d/purge", trashed.ID), user, nil, http.StatusOK, nil)
+
+	var updated models.User
+	path := fmt.Sprintf("/api/admin/users/%d/roles", author.ID)
+	s.do(http.MethodPut, path, admin, models.UpdateUserRolesRequest{Roles: []string{"user", "moderator"}}, http.StatusOK, &updated)
+	if len(updated.Roles) != 2 {
+		t.Fatalf("roles = %v, want user and moderator", updated.Roles)
+	}
+	s.do(http.MethodPut, path, admin, models.UpdateUserRolesRequest{Roles: []string{"superuser"}}, http.StatusBadRequest, nil)
+
+	// Roles travel in the token, so the promotion applies after a new login.
+	var claims models.TokenValidationResponse
+	promoted := s.login("author@example.com", "secret123").Token
+	s.do(http.MethodPost, "/api/validate-token", "", models.ValidateTokenRequest{Token: promoted}, http.StatusOK, &claims)
+	if claims.Metadata == nil || len(claims.Metadata.Roles) != 2 {
+		t.Fatalf("token metadata = %+v, want both roles", claims.Metadata)
+	}
+
+	// A demotion cannot wait for the token to expire: the user's tokens,
+	// refresh tokens included, stop working at once.
+	session := s.login("author@example.com", "secret123")
+	s.do(http.MethodPut, path, admin, models.UpdateUserRolesRequest{Roles: []string{"user"}}, http.StatusOK, nil)
+	s.do(http.MethodGet, "/api/me", session.Token, nil, http.StatusUnauthorized, nil)
+	s.do(http.MethodPost, "/api/refresh", "", models.RefreshTokenRequest{RefreshToken: session.RefreshToken}, http.StatusUnauthorized, nil)
+	demoted := s.login("author@example.com", "secret123").Token
+	s.do(http.MethodPost, "/api/validate-token", "", models.ValidateTokenRequest{Token: demoted}, http.StatusOK, &claims)
+	if claims.Metadata == nil || len(claims.Metadata.Roles) != 1 {
+		t.Fatalf("token metadata = %+v, want only the user role", claims.Metadata)
+	}
+
+	adminUser, _ := s.users.GetByEmail(context.Background(), "admin@example.com")
+	s.do(http.MethodPut, fmt.Sprintf("/api/admin/users/%d/roles", adminUser.ID), admin, models.UpdateUserRolesRequest{Roles: []string{"user"}}, http.StatusBadRequest, nil)
+}
+
+func TestProfile(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.createUser("alice@example.com", "secret123")
+	token := s.login("alice@example.com", "secret123").Token
+
+	var me models.User
+	s.do(http.MethodGet, "/api/me", token, nil, http.StatusOK, &me)
+	if me.ID != alice.ID || me.Email != "alice@example.com" || me.Password != "" {
+		t.Fatalf("GET /me = %+v, want alice without password", me)
+	}
+
+	// Browsers preflight the PATCH from the front end.
+	preflight := httptest.NewRequest(http.MethodOptions, "/api/me", nil)
+	preflight.Header.Set("Origin", "http://app.test")
+	preflight.Header.Set("Access-Control-Request-Method", http.MethodPatch)
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, preflight)
+	if methods := rec.Header().Get("Access-Control-Allow-Methods"); !strings.Contains(methods, http.MethodPatch) {
+		t.Fatalf("preflight allows %q, want PATCH", methods)
+	}
+
+	bio := "Writes about Go"
+	avatar := "https://example.com/alice.png"
+	s.do(http.MethodPatch, "/api/me", token, models.UpdateProfileRequest{Bio: &bio, AvatarURL: &avatar}, http.StatusOK, &me)
+	if me.Bio != bio || me.AvatarURL != avatar || me.Name != alice.Name {
+		t.Fatalf("PATCH /me = %+v, want bio and avatar set and name unchanged", me)
+	}
+
+	invalid := "javascript:alert(1)"
+	s.do(http.MethodPatch, "/api/me", token, models.UpdateProfileRequest{AvatarURL: &invalid}, http.StatusBadRequest, nil)
+	empty := ""
+	s.do(http.MethodPatch, "/api/me", token, models.UpdateProfileRequest{Name: &empty}, http.StatusBadRequest, nil)
+
+	var profile map[string]interface{}
+	s.do(http.MethodGet, fmt.Sprintf("/api/users/%d", alice.ID), "", nil, http.StatusOK, &profile)
+	if profile["bio"] != bio {
+		t.Fatalf("public profile = %v, want bio %q", profile, bio)
+	}
+	for _, field := range []string{"email", "password"} {
+		if _, ok := profile[field]; ok {
+			t.Fatalf("public profile leaked %q: %v", field, profile)
+		}
+	}
+
+	s.do(http.MethodGet, "/api/users/999", "", nil, http.StatusNotFound, nil)
+}
+
+func TestPasswordReset(t *testing.T) {
+	// A nanosecond cooldown lets each request send its own email.
+	s := newTestServerWithSetup(t, testSetup{passwordResetCooldown: time.Nanosecond})
+	s.createUser("alice@example.com", "secret123")
+	session := s.login("alice@example.com", "secret123")
+
+	s.do(http.MethodPost, "/api/password/forgot", "", models.ForgotPasswordRequest{Email: "nobody@example.com"}, http.StatusOK, nil)
+	if len(s.mail.messages) != 0 {
+		t.Fatal("mail sent for an unknown account")
+	}
+
+	s.do(http.MethodPost, "/api/password/forgot", "", models.ForgotPasswordRequest{Email: "alice@example.com"}, http.StatusOK, nil)
+	stale := s.mail.lastToken(t, "alice@example.com")
+	s.do(http.MethodPost, "/api/password/forgot", "", models.ForgotPasswordRequest{Email: "alice@example.com"}, http.StatusOK, nil)
+	token := s.mail.lastToken(t, "alice@example.com")
+
+	s.do(http.MethodPost, "/api/password/reset", "", models.ResetPasswordRequest{Token: stale, Password: "newsecret"}, http.StatusBadRequest, nil)
+	s.do(http.MethodPost, "/api/password/reset", "", models.ResetPasswordRequest{Token: token, Password: "newsecret"}, http.StatusOK, nil)
+	s.do(http.MethodPost, "/api/password/reset", "", models.ResetPasswordRequest{Token: token, Password: "another1"}, http.StatusBadRequest, nil)
+
+	s.do(http.MethodGet, "/api/me", session.Token, nil, http.StatusUnauthorized, nil)
+	s.do(http.MethodPost, "/api/refresh", "", models.RefreshTokenRequest{RefreshToken: session.RefreshToken}, http.StatusUnauthorized, nil)
+
+	s.do(http.MethodPost, "/api/login", "", models.LoginRequest{Email: "alice@example.com", Password: "secret123"}, http.StatusUnauthorized, nil)
+	fresh := s.login("alice@example.com", "newsecret")
+	s.do(http.MethodGet, "/api/me", fresh.Token, nil, http.StatusOK, nil)
+}
+
+func TestPasswordResetRateLimits(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("alice@example.com", "secret123")
+
+	// Repeats inside the per-account cooldown look like any other request
+	// but send nothing.
+	for i := 0; i < forgotPasswordLimit; i++ {
+		s.do(http.MethodPost, "/api/password/forgot", "", models.ForgotPasswordRequest{Email: "alice@example.com"}, http.StatusOK, nil)
+	}
+	if len(s.mail.messages) != 1 {
+		t.Fatalf("sent %d reset emails, want 1", len(s.mail.messages))
+	}
+
+	rec := s.raw(http.MethodPost, "/api/password/forgot", "", models.ForgotPasswordRequest{Email: "bob@example.com"})
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("request over the IP limit: status = %d, Retry-After = %q; want 429 with Retry-After", rec.Code, rec.Header().Get("Retry-After"))
+	}
+}
+
+// TestAccountEmailsAreSentOffTheRequestPath checks that a slow mailer does
+// not slow down the response for existing accounts, which would tell them
+// apart from unknown ones.
+func TestAccountEmailsAreSentOffTheRequestPath(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("alice@example.com", "secret123")
+	s.mail.delay = 500 * time.Millisecond
+	background := s.background
+	s.background = nil
+
+	start := time.Now()
+	s.do(http.MethodPost, "/api/password/forgot", "", models.ForgotPasswordRequest{Email: "alice@example.com"}, http.StatusOK, nil)
+	if elapsed := time.Since(start); elapsed >= s.mail.delay {
+		t.Fatalf("reset request took %s, waiting for the mail", elapsed)
+	}
+
+	s.do(http.MethodPost, "/api/verify-email/resend", "", models.ResendVerificationRequest{Email: "alice@example.com"}, http.StatusOK, nil)
+	if elapsed := time.Since(start); elapsed >= s.mail.delay {
+		t.Fatalf("reset and resend requests took %s, waiting for the mail", elapsed)
+	}
+
+	for _, service := range background {
+		service.Wait()
+	}
+	if len(s.mail.messages) != 2 {
+		t.Fatalf("sent %d emails, want a reset and a verification email", len(s.mail.messages))
+	}
+}
+
+func TestEmailVerification(t *testing.T) {
+	s := newTestServerWithPolicy(t, services.VerificationPolicy{BlockLogin: true, BlockPostCreate: true})
+
+	s.do(http.MethodPost, "/api/register", "", models.RegisterRequest{
+		Email:    "alice@example.com",
+		Password: "secret123",
+		Name:     "Alice",
+	}, http.StatusOK, nil)
+	token := s.mail.lastToken(t, "alice@example.com")
+
+	s.do(http.MethodPost, "/api/login", "", models.LoginRequest{Email: "alice@example.com", Password: "secret123"}, http.StatusForbidden, nil)
+
+	// A resend inside the cooldown answers like any other request, so it
+	// does not reveal that the account exists and is unverified, but sends
+	// nothing.
+	s.do(http.MethodPost, "/api/verify-email/resend", "", models.ResendVerificationRequest{Email: "alice@example.com"}, http.StatusOK, nil)
+	s.do(http.MethodPost, "/api/verify-email/resend", "", models.ResendVerificationRequest{Email: "alice@example.com"}, http.StatusOK, nil)
+	if len(s.mail.messages) != 2 {
+		t.Fatalf("sent %d verification emails, want the registration one and one resend", len(s.mail.messages))
+	}
+
+	s.do(http.MethodPost, "/api/verify-email", "", models.VerifyEmailRequest{Token: "bogus"}, http.StatusBadRequest, nil)
+	s.do(http.MethodPost, "/api/verify-email", "", models.VerifyEmailRequest{Token: token}, http.StatusOK, nil)
+	s.do(http.MethodPost, "/api/verify-email", "", models.VerifyEmailRequest{Token: token}, http.StatusBadRequest, nil)
+
+	session := s.login("alice@example.com", "secret123")
+	if session.User.EmailVerifiedAt == nil {
+		t.Fatal("login response does not report the verified email")
+	}
+	s.do(http.MethodPost, "/api/posts", session.Token, models.CreatePostRequest{Title: "Verified", Content: "Posting after verifying"}, http.StatusCreated, nil)
+}
+
+func TestUnverifiedAccountCannotPost(t *testing.T) {
+	s := newTestServerWithPolicy(t, services.VerificationPolicy{BlockPostCreate: true})
+	s.createUser("bob@example.com", "secret123")
+	token := s.login("bob@example.com", "secret123").Token
+
+	s.do(http.MethodPost, "/api/posts", token, models.CreatePostRequest{Title: "Unverified", Content: "Should not be allowed"}, http.StatusForbidden, nil)
+	s.do(http.MethodGet, "/api/posts", token, nil, http.StatusOK, nil)
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	list := sha1Hex("Zebra-Lantern-42") + ":7\n"
+	breached, err := passpolicy.NewBreachedList(strings.NewReader(list), int64(len(list)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServerWithSetup(t, testSetup{passwordPolicy: &passpolicy.Policy{
+		MinLength:            10,
+		DisallowPersonalInfo: true,
+		MinScore:             3,
+		Breached:             breached,
+	}})
+
+	var resp models.ErrorResponse
+	s.do(http.MethodPost, "/api/register", "", models.RegisterRequest{Email: "bob@example.com", Password: "bob-password", Name: "Bob"}, http.StatusBadRequest, &resp)
+	if len(resp.Details) != 2 || !strings.Contains(resp.Details[0], "email address or name") || !strings.Contains(resp.Details[1], "too easy to guess") {
+		t.Fatalf("register details = %q, want personal info and strength problems", resp.Details)
+	}
+	s.do(http.MethodPost, "/api/register", "", models.RegisterRequest{Email: "bob@example.com", Password: "Zebra-Lantern-42", Name: "Bob"}, http.StatusBadRequest, &resp)
+	if len(resp.Details) != 1 || !strings.Contains(resp.Details[0], "data breach") {
+		t.Fatalf("register details = %q, want the breach problem", resp.Details)
+	}
+	s.do(http.MethodPost, "/api/register", "", models.RegisterRequest{Email: "bob@example.com", Password: "vN8#qL2!zR5@", Name: "Bob"}, http.StatusOK, nil)
+
+	s.createUser("alice@example.com", "secret123")
+	session := s.login("alice@example.com", "secret123")
+	s.do(http.MethodPost, "/api/me/password", session.Token, models.ChangePasswordRequest{CurrentPassword: "secret123", NewPassword: "password1234"}, http.StatusBadRequest, nil)
+
+	// A rejected password leaves the reset link usable.
+	s.do(http.MethodPost, "/api/password/forgot", "", models.ForgotPasswordRequest{Email: "alice@example.com"}, http.StatusOK, nil)
+	token := s.mail.lastToken(t, "alice@example.com")
+	s.do(http.MethodPost, "/api/password/reset", "", models.ResetPasswordRequest{Token: token, Password: "alice-1234567"}, http.StatusBadRequest, nil)
+	s.do(http.MethodPost, "/api/password/reset", "", models.ResetPasswordRequest{Token: token, Password: "vN8#qL2!zR5@"}, http.StatusOK, nil)
+	s.login("alice@example.com", "vN8#qL2!zR5@")
+}
+
+func TestPasswordPolicyRejectsPasswordsTooLongForBcrypt(t *testing.T) {
+	hasher, err := passhash.NewBcrypt(bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServerWithSetup(t, testSetup{hasher: hasher, passwordPolicy: &passpolicy.Policy{
+		MinLength: 6,
+		MaxLength: 72,
+		MaxBytes:  hasher.MaxPasswordBytes(),
+	}})
+
+	// 72 characters pass the length limit but are 144 bytes.
+	var resp models.ErrorResponse
+	s.do(http.MethodPost, "/api/register", "", models.RegisterRequest{Email: "bob@example.com", Password: strings.Repeat("é", 72), Name: "Bob"}, http.StatusBadRequest, &resp)
+	if len(resp.Details) != 1 || !strings.Contains(resp.Details[0], "at most 72 bytes") {
+		t.Fatalf("register details = %q, want the byte limit problem", resp.Details)
+	}
+	s.do(http.MethodPost, "/api/register", "", models.RegisterRequest{Email: "bob@example.com", Password: strings.Repeat("é", 36), Name: "Bob"}, http.StatusOK, nil)
+}
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestVerificationEndpointsAreRateLimitedPerIP(t *testing.T) {
+	s := newTestServer(t)
+
+	for i := 0; i < verifyEmailLimit; i++ {
+		s.do(http.MethodPost, "/api/verify-email", "", models.VerifyEmailRequest{Token: "bogus"}, http.StatusBadRequest, nil)
+	}
+	s.do(http.MethodPost, "/api/verify-email", "", models.VerifyEmailRequest{Token: "bogus"}, http.StatusTooManyRequests, nil)
+}
+
+func TestEmailRateLimitsIgnoreSpoofedForwardedFor(t *testing.T) {
+	s := newTestServer(t)
+
+	limits := []struct {
+		path  string
+		limit int
+		body  interface{}
+	}{
+		{"/api/password/forgot", forgotPasswordLimit, models.ForgotPasswordRequest{Email: "nobody@example.com"}},
+		{"/api/verify-email", verifyEmailLimit, models.VerifyEmailRequest{Token: "bogus"}},
+	}
+	for _, l := range limits {
+		for i := 0; i <= l.limit; i++ {
+			rec := s.rawWithHeader(http.MethodPost, l.path, forwardedFor(fmt.Sprintf("203.0.113.%d", i)), l.body)
+			if limited := rec.Code == http.StatusTooManyRequests; limited != (i == l.limit) {
+				t.Fatalf("%s request %d with a fresh X-Forwarded-For: status = %d", l.path, i+1, rec.Code)
+			}
+		}
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("alice@example.com", "secret123")
+	current := s.login("alice@example.com", "secret123")
+	other := s.login("alice@example.com", "secret123")
+
+	s.do(http.MethodPost, "/api/me/password", current.Token, models.ChangePasswordRequest{
+		CurrentPassword: "wrong",
+		NewPassword:     "newsecret",
+	}, http.StatusBadRequest, nil)
+
+	var resp models.ChangePasswordResponse
+	s.do(http.MethodPost, "/api/me/password", current.Token, models.ChangePasswordRequest{
+		CurrentPassword:    "secret123",
+		NewPassword:        "newsecret",
+		KeepCurrentSession: true,
+	}, http.StatusOK, &resp)
+	if resp.Tokens == nil {
+		t.Fatal("keep_current_session did not return new tokens")
+	}
+
+	s.do(http.MethodGet, "/api/me", current.Token, nil, http.StatusUnauthorized, nil)
+	s.do(http.MethodGet, "/api/me", other.Token, nil, http.StatusUnauthorized, nil)
+	s.do(http.MethodPost, "/api/refresh", "", models.RefreshTokenRequest{RefreshToken: other.RefreshToken}, http.StatusUnauthorized, nil)
+	s.do(http.MethodGet, "/api/me", resp.Tokens.Token, nil, http.StatusOK, nil)
+	s.do(http.MethodPost, "/api/refresh", "", models.RefreshTokenRequest{RefreshToken: resp.Tokens.RefreshToken}, http.StatusOK, nil)
+
+	s.do(http.MethodPost, "/api/login", "", models.LoginRequest{Email: "alice@example.com", Password: "secret123"}, http.StatusUnauthorized, nil)
+	s.login("alice@example.com", "newsecret")
+}
+
+func TestSessions(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("alice@example.com", "secret123")
+	s.createUser("bob@example.com", "secret123")
+
+	var laptop models.LoginResponse
+	s.do(http.MethodPost, "/api/login", "", models.LoginRequest{
+		Email:    "alice@example.com",
+		Password: "secret123",
+		Device:   "Work laptop",
+	}, http.StatusOK, &laptop)
+	phone := s.login("alice@example.com", "secret123")
+	bob := s.login("bob@example.com", "secret123")
+
+	var sessions []models.Session
+	s.do(http.MethodGet, "/api/sessions", laptop.Token, nil, http.StatusOK, &sessions)
+	if len(sessions) != 2 {
+		t.Fatalf("got %d sessions, want 2: %+v", len(sessions), sessions)
+	}
+
+	var laptopID, phoneID string
+	for _, session := range sessions {
+		if session.Current {
+			laptopID = session.ID
+			if session.Device != "Work laptop" {
+				t.Fatalf("current session device = %q, want the name given at login", session.Device)
+			}
+		} else {
+			phoneID = session.ID
+		}
+	}
+	if laptopID == "" || phoneID == "" {
+		t.Fatalf("expected one current and one other session: %+v", sessions)
+	}
+
+	// Sessions can only be revoked by their owner.
+	s.do(http.MethodDelete, "/api/sessions/"+phoneID, bob.Token, nil, http.StatusNotFound, nil)
+
+	s.do(http.MethodDelete, "/api/sessions/"+phoneID, laptop.Token, nil, http.StatusOK, nil)
+	s.do(http.MethodGet, "/api/me", phone.Token, nil, http.StatusUnauthorized, nil)
+	s.do(http.MethodPost, "/api/refresh", "", models.RefreshTokenRequest{RefreshToken: phone.RefreshToken}, http.StatusUnauthorized, nil)
+	s.do(http.MethodGet, "/api/me", laptop.Token, nil, http.StatusOK, nil)
+
+	s.do(http.MethodGet, "/api/sessions", laptop.Token, nil, http.StatusOK, &sessions)
+	if len(sessions) != 1 || sessions[0].ID != laptopID {
+		t.Fatalf("sessions after revoke = %+v, want only the laptop", sessions)
+	}
+
+	// Rotating the refresh token keeps the session.
+	var rotated models.TokenPair
+	s.do(http.MethodPost, "/api/refresh", "", models.RefreshTokenRequest{RefreshToken: laptop.RefreshToken}, http.StatusOK, &rotated)
+	s.do(http.MethodGet, "/api/sessions", rotated.Token, nil, http.StatusOK, &sessions)
+	if len(sessions) != 1 || sessions[0].ID != laptopID || !sessions[0].Current {
+		t.Fatalf("sessions after refresh = %+v, want the laptop session", sessions)
+	}
+
+	tablet := s.login("alice@example.com", "secret123")
+	s.do(http.MethodPost, "/api/logout-all", rotated.Token, nil, http.StatusOK, nil)
+	s.do(http.MethodGet, "/api/me", rotated.Token, nil, http.StatusUnauthorized, nil)
+	s.do(http.MethodGet, "/api/me", tablet.Token, nil, http.StatusUnauthorized, nil)
+	s.do(http.MethodPost, "/api/refresh", "", models.RefreshTokenRequest{RefreshToken: tablet.RefreshToken}, http.StatusUnauthorized, nil)
+	s.do(http.MethodGet, "/api/me", bob.Token, nil, http.StatusOK, nil)
+
+	fresh := s.login("alice@example.com", "secret123")
+	s.do(http.MethodGet, "/api/sessions", fresh.Token, nil, http.StatusOK, &sessions)
+	if len(sessions) != 1 {
+		t.Fatalf("got %d sessions after logout-all and a new login, want 1", len(sessions))
+	}
+}
+
+// enrollTOTP enables TOTP for the user behind token and returns the secret,
+// the code used to confirm it and the recovery codes.
+func (s *testServer) enrollTOTP(token string) (string, string, []string) {
+	s.t.Helper()
+
+	var setup models.TOTPSetupResponse
+	s.do(http.MethodPost, "/api/me/mfa/totp", token, nil, http.StatusOK, &setup)
+	if !strings.HasPrefix(setup.OTPAuthURI, "otpauth://totp/") || !strings.HasPrefix(setup.QRCode, "data:image/png;base64,") {
+		s.t.Fatalf("unexpected setup response: %+v", setup)
+	}
+
+	code := totpCode(s.t, setup.Secret, 0)
+	var recovery models.RecoveryCodesResponse
+	s.do(http.MethodPost, "/api/me/mfa/totp/confirm", token, models.MFACodeRequest{Code: code}, http.StatusOK, &recovery)
+	if len(recovery.RecoveryCodes) == 0 {
+		s.t.Fatal("confirmation returned no recovery codes")
+	}
+	return setup.Secret, code, recovery.RecoveryCodes
+}
+
+// totpCode returns the code offset steps away from the current one.
+func totpCode(t *testing.T, secret string, offset int64) string {
+	t.Helper()
+	code, err := totp.Code(secret, totp.Step(time.Now())+offset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestTOTPLogin(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("alice@example.com", "secret123", models.RoleAdmin)
+	secret, confirmCode, _ := s.enrollTOTP(s.login("alice@example.com", "secret123").Token)
+
+	resp := s.login("alice@example.com", "secret123")
+	if !resp.MFARequired || resp.MFAToken == "" || resp.TokenPair != nil || resp.User != nil {
+		t.Fatalf("login with TOTP enabled = %+v, want only an mfa token", resp)
+	}
+
+	// The pending token is not an access token.
+	s.do(http.MethodGet, "/api/me", resp.MFAToken, nil, http.StatusUnauthorized, nil)
+
+	s.do(http.MethodPost, "/api/login/mfa", "", models.MFALoginRequest{MFAToken: resp.MFAToken, Code: "not-a-code"}, http.StatusUnauthorized, nil)
+	// The code used to confirm enrollment cannot be replayed.
+	s.do(http.MethodPost, "/api/login/mfa", "", models.MFALoginRequest{MFAToken: resp.MFAToken, Code: confirmCode}, http.StatusUnauthorized, nil)
+
+	var full models.LoginResponse
+	s.do(http.MethodPost, "/api/login/mfa", "", models.MFALoginRequest{MFAToken: resp.MFAToken, Code: totpCode(t, secret, 1)}, http.StatusOK, &full)
+	if full.TokenPair == nil || full.Token == "" || full.User == nil {
+		t.Fatalf("second step returned %+v, want tokens and user", full)
+	}
+	s.do(http.MethodGet, "/api/admin/users", full.Token, nil, http.StatusOK, nil)
+
+	// The pending token is single use.
+	s.do(http.MethodPost, "/api/login/mfa", "", models.MFALoginRequest{MFAToken: resp.MFAToken, Code: totpCode(t, secret, -1)}, http.StatusUnauthorized, nil)
+
+	rec := s.raw(http.MethodPost, "/api/login/mfa", "", models.MFALoginRequest{MFAToken: resp.MFAToken, Code: "000000"})
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("attempt over the limit: status = %d, Retry-After = %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+}
+
+func TestTOTPRecoveryCodesAndDisable(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("alice@example.com", "secret123")
+	token := s.login("alice@example.com", "secret123").Token
+	secret, _, codes := s.enrollTOTP(token)
+
+	s.do(http.MethodPost, "/api/me/mfa/totp", token, nil, http.StatusConflict, nil)
+
+	pending := s.login("alice@example.com", "secret123").MFAToken
+	s.do(http.MethodPost, "/api/login/mfa", "", models.MFALoginRequest{MFAToken: pending, Code: strings.ToUpper(codes[0])}, http.StatusOK, nil)
+
+	pending = s.login("alice@example.com", "secret123").MFAToken
+	s.do(http.MethodPost, "/api/login/mfa", "", models.MFALoginRequest{MFAToken: pending, Code: codes[0]}, http.StatusUnauthorized, nil)
+
+	s.do(http.MethodPost, "/api/me/mfa/totp/disable", token, models.MFACodeRequest{Code: totpCode(t, secret, 1)}, http.StatusOK, nil)
+	if resp := s.login("alice@example.com", "secret123"); resp.MFARequired || resp.Token == "" {
+		t.Fatalf("login after disabling TOTP = %+v, want tokens", resp)
+	}
+}
+
+func TestAsymmetricTokensVerifyAgainstJWKS(t *testing.T) {
+	keys, err := keyring.Open(t.TempDir(), keyring.AlgEdDSA, 0, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServerWithSetup(t, testSetup{keys: keys})
+	user := s.createUser("alice@example.com", "secret123")
+	resp := s.login("alice@example.com", "secret123")
+	s.do(http.MethodGet, "/api/me", resp.Token, nil, http.StatusOK, nil)
+
+	var set keyring.JWKS
+	s.do(http.MethodGet, "/.well-known/jwks.json", "", nil, http.StatusOK, &set)
+	if len(set.Keys) != 1 || set.Keys[0].Algorithm != keyring.AlgEdDSA {
+		t.Fatalf("unexpected JWKS %+v", set)
+	}
+	x, err := base64.RawURLEncoding.DecodeString(set.Keys[0].X)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A downstream service only needs the published key.
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(resp.Token, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Header["kid"] != set.Keys[0].KeyID {
+			t.Errorf("token kid = %v, want %s", token.Header["kid"], set.Keys[0].KeyID)
+		}
+		return ed25519.PublicKey(x), nil
+	}, jwt.WithIssuer("test-issuer"), jwt.WithAudience("test-audience"))
+	if err != nil {
+		t.Fatalf("token does not verify against the JWKS: %v", err)
+	}
+
+	// Tokens for another audience are rejected even with a valid signature.
+	other, err := utils.GenerateToken(user, utils.NewTokenSigner(keys, "test-issuer", "other-service"), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.do(http.MethodGet, "/api/me", other, nil, http.StatusUnauthorized, nil)
+}
+
+func newOIDCTestServer(t *testing.T) (*testServer, *oidctest.Provider) {
+	t.Helper()
+	provider, err := oidctest.NewProvider("test-client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(provider.Close)
+
+	client := oidc.NewProvider(oidc.Config{
+		Issuer:       provider.Issuer(),
+		ClientID:     "test-client",
+		ClientSecret: "test-client-secret",
+		RedirectURL:  "http://app.test/oauth/callback/mock",
+	}, provider.Server.Client())
+	s := newTestServerWithSetup(t, testSetup{oidcProviders: map[string]services.OIDCProvider{"mock": client}})
+	return s, provider
+}
+
+// startOIDC begins a sign-in and follows the provider's redirect, returning
+// the code and state the frontend would post to the callback, and the
+// cookie binding the sign-in to this browser.
+func (s *testServer) startOIDC(provider *oidctest.Provider) (code, state string, binding *http.Cookie) {
+	s.t.Helper()
+	rec := s.raw(http.MethodPost, "/api/auth/oidc/mock/start", "", nil)
+	if rec.Code != http.StatusOK {
+		s.t.Fatalf("start sign-in: status = %d; body: %s", rec.Code, rec.Body.String())
+	}
+	var start models.OIDCStartResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &start); err != nil {
+		s.t.Fatal(err)
+	}
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == "oidc_binding" {
+			binding = cookie
+		}
+	}
+	if binding == nil || binding.Value == "" || !binding.HttpOnly {
+		s.t.Fatalf("start sign-in set binding cookie %+v, want an HttpOnly value", binding)
+	}
+
+	redirect, err := provider.Authorize(start.AuthorizationURL)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	if got := redirect.Scheme + "://" + redirect.Host + redirect.Path; got != "http://app.test/oauth/callback/mock" {
+		s.t.Fatalf("provider redirected to %s", got)
+	}
+	return redirect.Query().Get("code"), redirect.Query().Get("state"), binding
+}
+
+// callbackOIDC posts the code and state to the callback, sending binding
+// when it is not nil.
+func (s *testServer) callbackOIDC(code, state string, binding *http.Cookie, wantStatus int, out interface{}) {
+	s.t.Helper()
+	data, err := json.Marshal(models.OIDCCallbackRequest{Code: code, State: state})
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/oidc/mock/callback", bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	if binding != nil {
+		req.AddCookie(binding)
+	}
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	if rec.Code != wantStatus {
+		s.t.Fatalf("sign-in callback: status = %d, want %d; body: %s", rec.Code, wantStatus, rec.Body.String())
+	}
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			s.t.Fatalf("sign-in callback: decode response: %v", err)
+		}
+	}
+}
+
+func (s *testServer) signInOIDC(provider *oidctest.Provider, user oidctest.User, wantStatus int) models.LoginResponse {
+	s.t.Helper()
+	provider.SetUser(user)
+	code, state, binding := s.startOIDC(provider)
+
+	var resp models.LoginResponse
+	s.callbackOIDC(code, state, binding, wantStatus, &resp)
+	return resp
+}
+
+func TestOIDCLoginCreatesAndLinksUsers(t *testing.T) {
+	s, provider := newOIDCTestServer(t)
+
+	dave := oidctest.User{Subject: "dave-sub", Email: "dave@example.com", EmailVerified: true, Name: "Dave"}
+	resp := s.signInOIDC(provider, dave, http.StatusOK)
+	if resp.TokenPair == nil || resp.User == nil || resp.User.Email != "dave@example.com" || resp.User.Name != "Dave" {
+		t.Fatalf("first sign-in = %+v, want tokens for a new user", resp)
+	}
+	if resp.User.EmailVerifiedAt == nil {
+		t.Fatal("email verified by the provider was not marked verified")
+	}
+	var me models.User
+	s.do(http.MethodGet, "/api/me", resp.Token, nil, http.StatusOK, &me)
+
+	// The identity is matched by subject, even if the email changed.
+	dave.Email = "dave@new.example.com"
+	if again := s.signInOIDC(provider, dave, http.StatusOK); again.User.ID != me.ID {
+		t.Fatalf("second sign-in user = %d, want %d", again.User.ID, me.ID)
+	}
+
+	// A verified email links to the existing password account.
+	bob := s.createUser("bob@example.com", "secret123")
+	if err := s.users.MarkEmailVerified(context.Background(), bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	linked := s.signInOIDC(provider, oidctest.User{Subject: "bob-sub", Email: "bob@example.com", EmailVerified: true}, http.StatusOK)
+	if linked.User.ID != bob.ID {
+		t.Fatalf("linked user = %d, want %d", linked.User.ID, bob.ID)
+	}
+	s.login("bob@example.com", "secret123")
+
+	// An unverified one does not.
+	s.createUser("carol@example.com", "secret123")
+	s.signInOIDC(provider, oidctest.User{Subject: "carol-sub", Email: "carol@example.com"}, http.StatusConflict)
+
+	// Nor does an account that never verified its email: someone could have
+	// registered the address before its owner signed in with the provider.
+	s.createUser("victim@example.com", "attacker-password")
+	s.signInOIDC(provider, oidctest.User{Subject: "victim-sub", Email: "victim@example.com", EmailVerified: true}, http.StatusConflict)
+	s.signInOIDC(provider, oidctest.User{Subject: "nobody-sub"}, http.StatusBadRequest)
+}
+
+func TestOIDCStateIsValidated(t *testing.T) {
+	s, provider := newOIDCTestServer(t)
+	provider.SetUser(oidctest.User{Subject: "erin-sub", Email: "erin@example.com", EmailVerified: true})
+
+	s.do(http.MethodPost, "/api/auth/oidc/unknown/start", "", nil, http.StatusNotFound, nil)
+	s.callbackOIDC("code", "forged", nil, http.StatusBadRequest, nil)
+
+	// A code redeemed with another login's state fails PKCE at the provider.
+	code, _, _ := s.startOIDC(provider)
+	_, otherState, otherBinding := s.startOIDC(provider)
+	s.callbackOIDC(code, otherState, otherBinding, http.StatusBadGateway, nil)
+
+	// A sign-in cannot be completed by a browser that did not start it, and
+	// the attempt uses up the state.
+	code, state, binding := s.startOIDC(provider)
+	_, _, strangerBinding := s.startOIDC(provider)
+	s.callbackOIDC(code, state, strangerBinding, http.StatusBadRequest, nil)
+	s.callbackOIDC(code, state, binding, http.StatusBadRequest, nil)
+	code, state, _ = s.startOIDC(provider)
+	s.callbackOIDC(code, state, nil, http.StatusBadRequest, nil)
+
+	code, state, binding = s.startOIDC(provider)
+	s.callbackOIDC(code, state, binding, http.StatusOK, nil)
+	// The state is single use.
+	s.callbackOIDC(code, state, binding, http.StatusBadRequest, nil)
+}
+
+// TestOIDCCrossOriginSignIn follows a front end on an allowed origin that
+// calls the API with credentials: the responses must name its origin, not a
+// wildcard, or the browser would drop the binding cookie.
+func TestOIDCCrossOriginSignIn(t *testing.T) {
+	s, provider := newOIDCTestServer(t)
+	provider.SetUser(oidctest.User{Subject: "frank-sub", Email: "frank@example.com", EmailVerified: true})
+
+	send := func(method, path, origin string, body interface{}, binding *http.Cookie) *httptest.ResponseRecorder {
+		t.Helper()
+		var reader io.Reader
+		if body != nil {
+			data, err := json.Marshal(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reader = bytes.NewReader(data)
+		}
+		req := httptest.NewRequest(method, path, reader)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Origin", origin)
+		if binding != nil {
+			req.AddCookie(binding)
+		}
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec
+	}
+	checkCORS := func(rec *httptest.ResponseRecorder, origin string) {
+		t.Helper()
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != origin {
+			t.Fatalf("Access-Control-Allow-Origin = %q, want %q", got, origin)
+		}
+		if origin != "" && rec.Header().Get("Access-Control-Allow-Credentials") != "true" {
+			t.Fatal("credentials not allowed for the front-end origin")
+		}
+	}
+
+	preflight := send(http.MethodOptions, "/api/auth/oidc/mock/callback", "http://app.test", nil, nil)
+	checkCORS(preflight, "http://app.test")
+	checkCORS(send(http.MethodOptions, "/api/auth/oidc/mock/callback", "http://evil.test", nil, nil), "")
+
+	code, state, _ := s.startOIDC(provider)
+	rec := send(http.MethodPost, "/api/auth/oidc/mock/callback", "http://app.test", models.OIDCCallbackRequest{Code: code, State: state}, nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("callback without the binding cookie: status = %d, want 400", rec.Code)
+	}
+
+	code, state, binding := s.startOIDC(provider)
+	rec = send(http.MethodPost, "/api/auth/oidc/mock/callback", "http://app.test", models.OIDCCallbackRequest{Code: code, State: state}, binding)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("callback with the binding cookie: status = %d, want 200; body: %s", rec.Code, rec.Body.String())
+	}
+	checkCORS(rec, "http://app.test")
+}
+
+func TestAPIKeys(t *testing.T) {
+	s := newTestServer(t)
+	s.createUser("alice@example.com", "secret123", models.RoleAdmin)
+	token := s.login("alice@example.com", "secret123").Token
+
+	var created models.CreateAPIKeyResponse
+	s.do(http.MethodPost, "/api/me/api-keys", token, models.CreateAPIKeyRequest{
+		Name:          "ci",
+		Scopes:        []string{models.ScopePostsRead, models.ScopeProfileRead},
+		ExpiresInDays: 30,
+	}, http.StatusCreated, &created)
+	if !strings.HasPrefix(created.Key, created.Prefix) || !strings.HasPrefix(created.Key, "mpk_") || len(created.Key) <= len(created.Prefix) {
+		t.Fatalf("created key %q with prefix %q", created.Key, created.Prefix)
+	}
+	s.do(http.MethodPost, "/api/me/api-keys", token, models.CreateAPIKeyRequest{Name: "bad", Scopes: []string{"everything"}, ExpiresInDays: 30}, http.StatusBadRequest, nil)
+
+	apiKey := func(method, path, key string, body interface{}, wantStatus int) {
+		t.Helper()
+		if rec := s.rawWithAuthorization(method, path, "ApiKey "+key, body); rec.Code != wantStatus {
+			t.Fatalf("%s %s with API key: status = %d, want %d; body: %s", method, path, rec.Code, wantStatus, rec.Body.String())
+		}
+	}
+
+	apiKey(http.MethodGet, "/api/me", created.Key, nil, http.StatusOK)
+	apiKey(http.MethodGet, "/api/posts", created.Key, nil, http.StatusOK)
+	// Outside the key's scopes.
+	apiKey(http.MethodPost, "/api/posts", created.Key, models.CreatePostRequest{Title: "t", Content: "c"}, http.StatusForbidden)
+	apiKey(http.MethodPatch, "/api/me", created.Key, map[string]string{"name": "x"}, http.StatusForbidden)
+	apiKey(http.MethodGet, "/api/admin/users", created.Key, nil, http.StatusForbidden)
+	// Account management never accepts API keys.
+	apiKey(http.MethodGet, "/api/sessions", created.Key, nil, http.StatusForbidden)
+	apiKey(http.MethodPost, "/api/me/api-keys", created.Key, models.CreateAPIKeyRequest{Name: "more", Scopes: []string{models.ScopeAdmin}, ExpiresInDays: 1}, http.StatusForbidden)
+	apiKey(http.MethodGet, "/api/me", "mpk_not-a-key", nil, http.StatusUnauthorized)
+
+	var keys []models.APIKey
+	s.do(http.MethodGet, "/api/me/api-keys", token, nil, http.StatusOK, &keys)
+	if len(keys) != 1 || keys[0].Name != "ci" || keys[0].LastUsedAt == nil || keys[0].LastUsedIP == "" {
+		t.Fatalf("keys = %+v, want the ci key with last use recorded", keys)
+	}
+	if rec := s.raw(http.MethodGet, "/api/me/api-keys", token, nil); strings.Contains(rec.Body.String(), created.Key) {
+		t.Fatal("listing exposes the key")
+	}
+
+	path := fmt.Sprintf("/api/me/api-keys/%d", created.ID)
+	s.do(http.MethodDelete, path, token, nil, http.StatusOK, nil)
+	s.do(http.MethodDelete, path, token, nil, http.StatusNotFound, nil)
+	apiKey(http.MethodGet, "/api/me", created.Key, nil, http.StatusUnauthorized)
+}
+
+func TestFailedLoginsBackOffAndLockOut(t *testing.T) {
+	s := newTestServerWithSetup(t, testSetup{loginGuard: &services.LoginGuardPolicy{
+		AccountFreeAttempts:     2,
+		IPFreeAttempts:          100,
+		BackoffBase:             100 * time.Millisecond,
+		BackoffMax:              200 * time.Millisecond,
+		AccountLockoutThreshold: 5,
+		IPLockoutThreshold:      100,
+		LockoutDuration:         time.Hour,
+		FailureWindow:           time.Hour,
+	}})
+	alice := s.createUser("alice@example.com", "secret123")
+	s.createUser("bob@example.com", "secret123")
+	adminToken := s.login(s.createUser("admin@example.com", "secret123", models.RoleAdmin).Email, "secret123").Token
+
+	wrong := models.LoginRequest{Email: "alice@example.com", Password: "wrong-password"}
+	s.do(http.MethodPost, "/api/login", "", wrong, http.StatusUnauthorized, nil)
+	s.do(http.MethodPost, "/api/login", "", wrong, http.StatusUnauthorized, nil)
+	s.do(http.MethodPost, "/api/login", "", wrong, http.StatusUnauthorized, nil)
+
+	// Past the free attempts even the right password waits out the backoff.
+	rec := s.raw(http.MethodPost, "/api/login", "", models.LoginRequest{Email: "ALICE@example.com", Password: "secret123"})
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "1" {
+		t.Fatalf("login during backoff: status = %d, Retry-After = %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	// Other accounts from the same IP are unaffected.
+	s.login("bob@example.com", "secret123")
+
+	time.Sleep(150 * time.Millisecond)
+	s.do(http.MethodPost, "/api/login", "", wrong, http.StatusUnauthorized, nil)
+	time.Sleep(250 * time.Millisecond)
+	s.do(http.MethodPost, "/api/login", "", wrong, http.StatusUnauthorized, nil)
+
+	rec = s.raw(http.MethodPost, "/api/login", "", models.LoginRequest{Email: "alice@example.com", Password: "secret123"})
+	if retry := rec.Header().Get("Retry-After"); rec.Code != http.StatusTooManyRequests || retry != "3600" {
+		t.Fatalf("login while locked out: status = %d, Retry-After = %q", rec.Code, retry)
+	}
+
+	events := s.audit.Events()
+	if len(events) != 1 || events[0].Type != audit.LoginLocked || events[0].Email != "alice@example.com" {
+		t.Fatalf("audit events = %+v, want one account lockout", events)
+	}
+
+	unlock := fmt.Sprintf("/api/admin/users/%d/unlock", alice.ID)
+	s.do(http.MethodPost, unlock, s.login("bob@example.com", "secret123").Token, nil, http.StatusForbidden, nil)
+	s.do(http.MethodPost, unlock, adminToken, nil, http.StatusOK, nil)
+	s.do(http.MethodPost, "/api/admin/users/999/unlock", adminToken, nil, http.StatusNotFound, nil)
+	s.login("alice@example.com", "secret123")
+
+	if events := s.audit.Events(); len(events) != 2 || events[1].Type != audit.LoginUnlocked || events[1].UserID != alice.ID || events[1].ActorID == 0 {
+		t.Fatalf("audit events = %+v, want the unlock recorded", events)
+	}
+}
+
+func TestFailedLoginsLockOutIP(t *testing.T) {
+	s := newTestServerWithSetup(t, testSetup{loginGuard: &services.LoginGuardPolicy{
+		AccountFreeAttempts:     100,
+		IPFreeAttempts:          100,
+		BackoffBase:             time.Second,
+		BackoffMax:              time.Minute,
+		AccountLockoutThreshold: 100,
+		IPLockoutThreshold:      3,
+		LockoutDuration:         time.Hour,
+		FailureWindow:           time.Hour,
+	}})
+	s.createUser("alice@example.com", "secret123")
+
+	// Spraying different accounts from one IP trips the IP counter.
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		s.do(http.MethodPost, "/api/login", "", models.LoginRequest{Email: email, Password: "guess"}, http.StatusUnauthorized, nil)
+	}
+	s.do(http.MethodPost, "/api/login", "", models.LoginRequest{Email: "alice@example.com", Password: "secret123"}, http.StatusTooManyRequests, nil)
+
+	if events := s.audit.Events(); len(events) != 1 || events[0].Type != audit.LoginLocked || events[0].IP == "" {
+		t.Fatalf("audit events = %+v, want one IP lockout", events)
+	}
+}
+
+// forwardedFor returns a header claiming the request was forwarded for ip.
+func forwardedFor(ip string) http.Header {
+	return http.Header{"X-Forwarded-For": {ip}}
+}
+
+func TestFailedLoginsIgnoreSpoofedForwardedFor(t *testing.T) {
+	policy := services.LoginGuardPolicy{
+		AccountFreeAttempts:     100,
+		IPFreeAttempts:          100,
+		BackoffBase:             time.Second,
+		BackoffMax:              time.Minute,
+		AccountLockoutThreshold: 100,
+		IPLockoutThreshold:      3,
+		LockoutDuration:         time.Hour,
+		FailureWindow:           time.Hour,
+	}
+	guess := func(s *testServer, i int) *httptest.ResponseRecorder {
+		return s.rawWithHeader(http.MethodPost, "/api/login", forwardedFor(fmt.Sprintf("203.0.113.%d", i)),
+			models.LoginRequest{Email: fmt.Sprintf("user%d@example.com", i), Password: "guess"})
+	}
+
+	// Without trusted proxies a new X-Forwarded-For on every attempt still
+	// counts against the connection's address.
+	s := newTestServerWithSetup(t, testSetup{loginGuard: &policy})
+	for i := 0; i < 3; i++ {
+		if rec := guess(s, i); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("guess %d: status = %d, want 401", i, rec.Code)
+		}
+	}
+	if rec := guess(s, 3); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("guess with a fresh X-Forwarded-For: status = %d, want 429", rec.Code)
+	}
+
+	// Behind a trusted proxy the forwarded address is the client's.
+	s = newTestServerWithSetup(t, testSetup{loginGuard: &policy}, func(cfg *Config) {
+		cfg.TrustedProxies = []string{"192.0.2.1"}
+	})
+	for i := 0; i < 4; i++ {
+		if rec := guess(s, i); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("guess %d from a distinct forwarded client: status = %d, want 401", i, rec.Code)
+		}
+	}
+}
+
+// TestLoginTimesUnknownEmailsLikeWrongPasswords checks that an unknown email
+// pays for a password hash too, so response times do not reveal accounts.
+func TestLoginTimesUnknownEmailsLikeWrongPasswords(t *testing.T) {
+	hasher, err := passhash.NewBcrypt(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServerWithSetup(t, testSetup{hasher: hasher})
+	s.createUser("alice@example.com", "secret123")
+
+	timeLogin := func(email string) time.Duration {
+		t.Helper()
+		start := time.Now()
+		s.do(http.MethodPost, "/api/login", "", models.LoginRequest{Email: email, Password: "wrong-password"}, http.StatusUnauthorized, nil)
+		return time.Since(start)
+	}
+	timeLogin("warmup@example.com")
+
+	wrongPassword := timeLogin("alice@example.com")
+	unknownEmail := timeLogin("nobody@example.com")
+	if unknownEmail < wrongPassword/3 {
+		t.Fatalf("unknown email took %s, wrong password %s; want comparable times", unknownEmail, wrongPassword)
+	}
+}
+
+func TestLoginRehashesOutdatedPasswordHashes(t *testing.T) {
+	hasher, err := passhash.NewArgon2id(passhash.Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServerWithSetup(t, testSetup{hasher: hasher})
+	// createUser stores a raw bcrypt hash, as accounts from before PHC
+	// hashes have.
+	alice := s.createUser("alice@example.com", "secret123")
+
+	s.do(http.MethodPost, "/api/login", "", models.LoginRequest{Email: "alice@example.com", Password: "wrong-password"}, http.StatusUnauthorized, nil)
+	stored, _ := s.users.GetByID(context.Background(), alice.ID)
+	if !strings.HasPrefix(stored.Password, "$2a$") {
+		t.Fatalf("failed login changed the hash to %q", stored.Password)
+	}
+
+	s.login("alice@example.com", "secret123")
+	stored, _ = s.users.GetByID(context.Background(), alice.ID)
+	if !strings.HasPrefix(stored.Password, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Fatalf("hash after login = %q, want argon2id with current parameters", stored.Password)
+	}
+	s.login("alice@example.com", "secret123")
+
+	// Registration hashes with the configured algorithm directly.
+	s.do(http.MethodPost, "/api/register", "", models.RegisterRequest{Email: "bob@example.com", Password: "secret123", Name: "Bob"}, http.StatusOK, nil)
+	bob, _ := s.users.GetByEmail(context.Background(), "bob@example.com")
+	if !strings.HasPrefix(bob.Password, "$argon2id$") {
+		t.Fatalf("registered hash = %q", bob.Password)
+	}
+}
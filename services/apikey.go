@@ -0,0 +1,136 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/tamabsndra/miniproject/miniproject-backend/models"
+	"github.com/tamabsndra/miniproject/miniproject-backend/repository"
+	"github.com/tamabsndra/miniproject/miniproject-backend/utils"
+)
+
+var (
+	ErrInvalidAPIKey  = errors.New("invalid or expired API key")
+	ErrAPIKeyNotFound = errors.New("API key not found")
+	ErrTooManyAPIKeys = errors.New("API key limit reached; revoke an unused key first")
+)
+
+const (
+	// apiKeyPrefix marks our keys so they are recognisable in leaked
+	// configuration and by secret scanners.
+	apiKeyPrefix = "mpk_"
+	// apiKeyDisplayLength is how much of the key is kept in clear text to
+	// tell keys apart in listings.
+	apiKeyDisplayLength = len(apiKeyPrefix) + 8
+	maxAPIKeysPerUser   = 20
+	// apiKeyTouchInterval limits last-used updates to one write per key per
+	// interval unless the client address changes.
+	apiKeyTouchInterval = time.Minute
+)
+
+// APIKeyService manages personal API keys, which authenticate scripts as
+// their owner within the key's scopes until they expire or are revoked.
+type APIKeyService struct {
+	apiKeyRepo repository.APIKeyRepository
+	userRepo   repository.UserRepository
+}
+
+func NewAPIKeyService(apiKeyRepo repository.APIKeyRepository, userRepo repository.UserRepository) *APIKeyService {
+	return &APIKeyService{apiKeyRepo: apiKeyRepo, userRepo: userRepo}
+}
+
+// Create issues a new key. The returned key is not stored and cannot be
+// retrieved later.
+func (s *APIKeyService) Create(ctx context.Context, userID uint, req models.CreateAPIKeyRequest) (*models.CreateAPIKeyResponse, error) {
+	existing, err := s.apiKeyRepo.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) >= maxAPIKeysPerUser {
+		return nil, ErrTooManyAPIKeys
+	}
+
+	secret, err := utils.GenerateRandomID(32)
+	if err != nil {
+		return nil, err
+	}
+	raw := apiKeyPrefix + secret
+
+	key := models.APIKey{
+		UserID:    userID,
+		Name:      req.Name,
+		Prefix:    raw[:apiKeyDisplayLength],
+		KeyHash:   utils.HashToken(raw),
+		Scopes:    dedupeScopes(req.Scopes),
+		ExpiresAt: utils.GetCurrentTime().Add(time.Duration(req.ExpiresInDays) * 24 * time.Hour),
+	}
+	if err := s.apiKeyRepo.Create(ctx, &key); err != nil {
+		return nil, err
+	}
+
+	return &models.CreateAPIKeyResponse{APIKey: key, Key: raw}, nil
+}
+
+func (s *APIKeyService) List(ctx context.Context, userID uint) ([]models.APIKey, error) {
+	return s.apiKeyRepo.ListByUser(ctx, userID)
+}
+
+func (s *APIKeyService) Revoke(ctx context.Context, userID, id uint) error {
+	err := s.apiKeyRepo.Delete(ctx, userID, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrAPIKeyNotFound
+	}
+	return err
+}
+
+// Authenticate resolves a raw key to the key and its owner, recording the
+// use from ip.
+func (s *APIKeyService) Authenticate(ctx context.Context, raw, ip string) (*models.APIKey, *models.User, error) {
+	if !strings.HasPrefix(raw, apiKeyPrefix) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	key, err := s.apiKeyRepo.GetByHash(ctx, utils.HashToken(raw))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := utils.GetCurrentTime()
+	if !now.Before(key.ExpiresAt) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	user, err := s.userRepo.GetByID(ctx, key.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyTouchInterval || key.LastUsedIP != ip {
+		if err := s.apiKeyRepo.Touch(ctx, key.ID, ip, now); err != nil {
+			return nil, nil, err
+		}
+		key.LastUsedAt, key.LastUsedIP = &now, ip
+	}
+	return key, user, nil
+}
+
+func dedupeScopes(scopes []string) []string {
+	seen := make(map[string]bool, len(scopes))
+	var unique []string
+	for _, scope := range scopes {
+		if !seen[scope] {
+			seen[scope] = true
+			unique = append(unique, scope)
+		}
+	}
+	return unique
+}
@@ -1,59 +1,297 @@
 package services
 
 import (
+	"context"
+	"database/sql"
 	"errors"
-	"time"
-
-	"golang.org/x/crypto/bcrypt"
+	"fmt"
+	"log"
+	"sync"
 
 	"github.com/tamabsndra/miniproject/miniproject-backend/models"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/passhash"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/passpolicy"
 	"github.com/tamabsndra/miniproject/miniproject-backend/repository"
 	"github.com/tamabsndra/miniproject/miniproject-backend/utils"
 )
 
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrVerificationEmailNotSent means the account was created but its
+	// verification email could not be sent; the user can ask for a resend.
+	ErrVerificationEmailNotSent = errors.New("verification email could not be sent")
+	ErrIncorrectPassword        = errors.New("current password is incorrect")
+	ErrPasswordUnchanged        = errors.New("new password must differ from the current one")
+)
+
 type AuthService struct {
-	userRepo  *repository.UserRepository
-	jwtSecret string
+	userRepo            repository.UserRepository
+	hasher              *passhash.Hasher
+	passwordPolicy      *passpolicy.Policy
+	tokenService        *TokenService
+	verificationService *EmailVerificationService
+	mfaService          *MFAService
+	loginGuard          *LoginGuard
+
+	// dummyHash is checked against when the email is unknown, so that
+	// takes as long as a wrong password on a real account.
+	dummyHashOnce sync.Once
+	dummyHash     string
 }
 
-func NewAuthService(userRepo *repository.UserRepository, jwtSecret string) *AuthService {
+func NewAuthService(userRepo repository.UserRepository, hasher *passhash.Hasher, passwordPolicy *passpolicy.Policy, tokenService *TokenService, verificationService *EmailVerificationService, mfaService *MFAService, loginGuard *LoginGuard) *AuthService {
 	return &AuthService{
-		userRepo:  userRepo,
-		jwtSecret: jwtSecret,
+		userRepo:            userRepo,
+		hasher:              hasher,
+		passwordPolicy:      passwordPolicy,
+		tokenService:        tokenService,
+		verificationService: verificationService,
+		mfaService:          mfaService,
+		loginGuard:          loginGuard,
+	}
+}
+
+// Login checks the password and starts a session. Failed attempts are
+// counted by the login guard, which rejects further attempts with a
+// *ratelimit.LimitedError while the account or client IP is backed off.
+func (s *AuthService) Login(ctx context.Context, req models.LoginRequest, client models.ClientInfo) (*models.LoginResponse, error) {
+	if err := s.loginGuard.Check(ctx, req.Email, client.IP); err != nil {
+		return nil, err
+	}
+	defer s.loginGuard.Release(ctx, req.Email, client.IP)
+
+	user, err := s.userRepo.GetByEmail(ctx, req.Email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			s.hasher.Verify(req.Password, s.unknownUserHash())
+			return nil, s.failLogin(ctx, req.Email, client.IP)
+		}
+		return nil, err
+	}
+
+	match, err := s.hasher.Verify(req.Password, user.Password)
+	if err != nil {
+		return nil, err
+	}
+	if !match {
+		return nil, s.failLogin(ctx, req.Email, client.IP)
+	}
+	if err := s.loginGuard.RecordSuccess(ctx, req.Email); err != nil {
+		return nil, err
+	}
+	s.rehashPassword(ctx, user, req.Password)
+
+	if req.Device != "" {
+		client.Device = req.Device
+	}
+	return s.beginSession(ctx, user, client)
+}
+
+// rehashPassword upgrades a hash made with outdated parameters while the
+// plain password is at hand. Failing to do so does not fail the login.
+func (s *AuthService) rehashPassword(ctx context.Context, user *models.User, password string) {
+	if !s.hasher.NeedsRehash(user.Password) {
+		return
 	}
+
+	newHash, err := s.hasher.Hash(password)
+	if err == nil {
+		err = s.userRepo.RehashPassword(ctx, user.ID, user.Password, newHash)
+	}
+	// ErrNoRows means the password changed meanwhile, and the new one is
+	// already hashed with current parameters.
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Failed to rehash password for user %d: %v", user.ID, err)
+	}
+}
+
+// unknownUserHash returns a hash of a random password made with the current
+// parameters, for Login to verify against when no account has the email.
+func (s *AuthService) unknownUserHash() string {
+	s.dummyHashOnce.Do(func() {
+		password, err := utils.GenerateRandomID(32)
+		if err == nil {
+			s.dummyHash, err = s.hasher.Hash(password)
+		}
+		if err != nil {
+			log.Printf("Failed to hash the unknown-user password: %v", err)
+		}
+	})
+	return s.dummyHash
+}
+
+// failLogin records a failed password attempt and returns the error for
+// it. Unknown emails count too, and Login hashes for them as it would for
+// a real account, so they cannot be told apart.
+func (s *AuthService) failLogin(ctx context.Context, email, ip string) error {
+	if err := s.loginGuard.RecordFailure(ctx, email, ip); err != nil {
+		return err
+	}
+	return ErrInvalidCredentials
+}
+
+// beginSession signs in a user whose first factor has been checked. It
+// applies the email verification policy and, for users with TOTP enabled,
+// returns an mfa_pending token instead of a token pair.
+func (s *AuthService) beginSession(ctx context.Context, user *models.User, client models.ClientInfo) (*models.LoginResponse, error) {
+	if s.verificationService.Policy().BlockLogin && user.EmailVerifiedAt == nil {
+		return nil, ErrEmailNotVerified
+	}
+
+	mfaEnabled, err := s.mfaService.Enabled(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if mfaEnabled {
+		mfaToken, err := s.mfaService.StartLogin(ctx, *user)
+		if err != nil {
+			return nil, err
+		}
+		return &models.LoginResponse{MFARequired: true, MFAToken: mfaToken}, nil
+	}
+
+	return s.completeLogin(ctx, user, client)
 }
 
-func (s *AuthService) Login(req models.LoginRequest) (*models.LoginResponse, error) {
-	user, err := s.userRepo.GetByEmail(req.Email)
+// CompleteMFALogin finishes a two-factor login by exchanging the
+// mfa_pending token from Login and a valid code for a token pair.
+func (s *AuthService) CompleteMFALogin(ctx context.Context, req models.MFALoginRequest, client models.ClientInfo) (*models.LoginResponse, error) {
+	claims, err := s.tokenService.ParseMFAPendingToken(req.MFAToken)
 	if err != nil {
-		return nil, errors.New("invalid credentials")
+		return nil, err
+	}
+
+	if err := s.mfaService.VerifyCode(ctx, claims.UserID, req.Code); err != nil {
+		if errors.Is(err, ErrMFANotEnabled) {
+			return nil, ErrInvalidMFAToken
+		}
+		return nil, err
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
-		return nil, errors.New("invalid credentials")
+	// Only consume the token once the code checks out, so a typo does not
+	// send the user back to the password step.
+	if err := s.tokenService.ConsumeMFAPendingToken(ctx, claims); err != nil {
+		return nil, err
 	}
 
-	token, err := utils.GenerateToken(*user, s.jwtSecret, 24*time.Hour)
+	user, err := s.userRepo.GetByID(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidMFAToken
+		}
+		return nil, err
+	}
+
+	if req.Device != "" {
+		client.Device = req.Device
+	}
+	return s.completeLogin(ctx, user, client)
+}
+
+func (s *AuthService) completeLogin(ctx context.Context, user *models.User, client models.ClientInfo) (*models.LoginResponse, error) {
+	tokens, err := s.tokenService.IssueTokenPair(ctx, *user, client)
 	if err != nil {
 		return nil, err
 	}
 
 	user.Password = ""
 	return &models.LoginResponse{
-		Token: token,
-		User:  *user,
+		TokenPair: tokens,
+		User:      user,
 	}, nil
 }
 
-func (s *AuthService) Register(req models.User) error {
-	hashedPassword, err := utils.HashPassword(req.Password)
+func (s *AuthService) Refresh(ctx context.Context, req models.RefreshTokenRequest, client models.ClientInfo) (*models.TokenPair, error) {
+	claims, err := s.tokenService.ParseRefreshToken(req.RefreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByEmail(ctx, claims.Email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if err != nil || user.ID != claims.UserID {
+		if err := s.tokenService.RevokeRefreshFamily(ctx, claims.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+
+	return s.tokenService.RotateRefreshToken(ctx, *user, claims, client)
+}
+
+// Register creates an unverified account and mails the verification link.
+// A password the policy rejects is reported as a *passpolicy.ViolationError.
+func (s *AuthService) Register(ctx context.Context, req models.User) error {
+	if err := s.passwordPolicy.Check(req.Password, req.Email, req.Name); err != nil {
+		return err
+	}
+
+	hashedPassword, err := s.hasher.Hash(req.Password)
 	if err != nil {
 		return err
 	}
 
-	req.Password = hashedPassword
-	req.CreatedAt = utils.GetCurrentTime()
-	req.UpdatedAt = utils.GetCurrentTime()
+	// Only the sign-up fields are taken from the request; roles are granted
+	// by admins and the profile is edited through PATCH /me.
+	user := models.User{
+		Email:     req.Email,
+		Password:  hashedPassword,
+		Name:      req.Name,
+		CreatedAt: utils.GetCurrentTime(),
+		UpdatedAt: utils.GetCurrentTime(),
+	}
+
+	if err := s.userRepo.Create(ctx, &user); err != nil {
+		return err
+	}
 
-	return s.userRepo.Create(&req)
+	if err := s.verificationService.SendVerification(ctx, user); err != nil {
+		return fmt.Errorf("%w: %v", ErrVerificationEmailNotSent, err)
+	}
+	return nil
+}
+
+// ChangePassword replaces the user's password after checking the current
+// one and revokes every token issued to them. With KeepCurrentSession it
+// returns a new token pair for the caller; otherwise it returns nil.
+func (s *AuthService) ChangePassword(ctx context.Context, userID uint, req models.ChangePasswordRequest, client models.ClientInfo) (*models.TokenPair, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	match, err := s.hasher.Verify(req.CurrentPassword, user.Password)
+	if err != nil {
+		return nil, err
+	}
+	if !match {
+		return nil, ErrIncorrectPassword
+	}
+	if req.NewPassword == req.CurrentPassword {
+		return nil, ErrPasswordUnchanged
+	}
+	if err := s.passwordPolicy.Check(req.NewPassword, user.Email, user.Name); err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := s.hasher.Hash(req.NewPassword)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.UpdatePassword(ctx, userID, hashedPassword); err != nil {
+		return nil, err
+	}
+
+	if err := s.tokenService.RevokeAllUserTokens(ctx, userID); err != nil {
+		return nil, err
+	}
+	if !req.KeepCurrentSession {
+		return nil, nil
+	}
+	return s.tokenService.IssueTokenPair(ctx, *user, client)
 }
@@ -0,0 +1,38 @@
+package services
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// backgroundTaskTimeout bounds a task that outlives the request which
+// started it.
+const backgroundTaskTimeout = time.Minute
+
+// backgroundTasks runs work after the response has been sent, so how long
+// the work takes, or whether there was any, does not show in the response
+// time.
+type backgroundTasks struct {
+	wg sync.WaitGroup
+}
+
+// run starts task with a context that keeps ctx's values but not its
+// cancellation. Errors are logged under name.
+func (b *backgroundTasks) run(ctx context.Context, name string, task func(ctx context.Context) error) {
+	ctx = context.WithoutCancel(ctx)
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		ctx, cancel := context.WithTimeout(ctx, backgroundTaskTimeout)
+		defer cancel()
+		if err := task(ctx); err != nil {
+			log.Printf("%s: %v", name, err)
+		}
+	}()
+}
+
+func (b *backgroundTasks) wait() {
+	b.wg.Wait()
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tamabsndra/miniproject/miniproject-backend/models"
+)
+
+// HealthCheck probes a single dependency; Check should return promptly once
+// ctx is done.
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+type HealthService struct {
+	checks       []HealthCheck
+	timeout      time.Duration
+	shuttingDown atomic.Bool
+}
+
+func NewHealthService(timeout time.Duration, checks ...HealthCheck) *HealthService {
+	return &HealthService{checks: checks, timeout: timeout}
+}
+
+// SetShuttingDown marks the instance as draining so readiness fails and the
+// load balancer stops routing new traffic to it.
+func (s *HealthService) SetShuttingDown() {
+	s.shuttingDown.Store(true)
+}
+
+func (s *HealthService) ShuttingDown() bool {
+	return s.shuttingDown.Load()
+}
+
+// Readiness runs every dependency check concurrently, each bounded by the
+// service timeout, and reports whether the instance can serve traffic.
+func (s *HealthService) Readiness(ctx context.Context) (*models.HealthReport, bool) {
+	report := &models.HealthReport{
+		Status: models.HealthStatusUp,
+		Checks: make(map[string]models.DependencyHealth, len(s.checks)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range s.checks {
+		wg.Add(1)
+		go func(check HealthCheck) {
+			defer wg.Done()
+			result := s.run(ctx, check)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[check.Name] = result
+		}(check)
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if result.Status != models.HealthStatusUp {
+			report.Status = models.HealthStatusDown
+		}
+	}
+	if s.ShuttingDown() {
+		report.Status = models.HealthStatusDown
+		report.ShuttingDown = true
+	}
+	return report, report.Status == models.HealthStatusUp
+}
+
+func (s *HealthService) run(ctx context.Context, check HealthCheck) models.DependencyHealth {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Check(ctx)
+	result := models.DependencyHealth{
+		Status:    models.HealthStatusUp,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = models.HealthStatusDown
+		result.Error = err.Error()
+	}
+	return result
+}
@@ -0,0 +1,294 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/audit"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/ratelimit"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/store"
+	"github.com/tamabsndra/miniproject/miniproject-backend/repository"
+)
+
+// LoginGuardPolicy configures how failed password logins are throttled.
+// Failures are counted per account and per client IP; each counter backs off
+// on its own and locks out at its own threshold.
+type LoginGuardPolicy struct {
+	// AccountFreeAttempts and IPFreeAttempts failures are allowed before
+	// backoff starts. An IP is given more, since many users can share one.
+	AccountFreeAttempts int
+	IPFreeAttempts      int
+	// BackoffBase is the delay after the first failure past the free
+	// attempts; it doubles with each further failure up to BackoffMax.
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+	// AccountLockoutThreshold and IPLockoutThreshold failures lock the
+	// account or IP out for LockoutDuration.
+	AccountLockoutThreshold int
+	IPLockoutThreshold      int
+	LockoutDuration         time.Duration
+	// FailureWindow is how long failures are remembered after the last one.
+	FailureWindow time.Duration
+}
+
+// loginAttemptTTL bounds how long an attempt that never released its slot,
+// say because the process died mid-login, keeps holding it.
+const loginAttemptTTL = time.Minute
+
+// loginAttemptRetry is the Retry-After given to an attempt turned away
+// because others are still in flight.
+const loginAttemptRetry = time.Second
+
+// LoginGuard tracks failed logins and blocks further attempts with
+// exponential backoff and temporary lockouts. Attempts also take a slot
+// before the password is checked, so parallel guesses cannot all slip in
+// before the failures they cause are recorded.
+type LoginGuard struct {
+	store    store.Store
+	userRepo repository.UserRepository
+	recorder audit.Recorder
+	policy   LoginGuardPolicy
+	now      func() time.Time
+}
+
+func NewLoginGuard(store store.Store, userRepo repository.UserRepository, recorder audit.Recorder, policy LoginGuardPolicy) *LoginGuard {
+	return &LoginGuard{
+		store:    store,
+		userRepo: userRepo,
+		recorder: recorder,
+		policy:   policy,
+		now:      time.Now,
+	}
+}
+
+type loginSubject struct {
+	kind         string
+	id           string
+	freeAttempts int
+	threshold    int
+}
+
+func (g *LoginGuard) subjects(email, ip string) []loginSubject {
+	return []loginSubject{
+		{kind: "account", id: normalizeLoginEmail(email), freeAttempts: g.policy.AccountFreeAttempts, threshold: g.policy.AccountLockoutThreshold},
+		{kind: "ip", id: ip, freeAttempts: g.policy.IPFreeAttempts, threshold: g.policy.IPLockoutThreshold},
+	}
+}
+
+// Check returns a *ratelimit.LimitedError if the account or the IP may not
+// try a password right now. Otherwise it reserves a slot for the attempt,
+// which the caller must give back with Release once the attempt has been
+// recorded as a success or failure.
+func (g *LoginGuard) Check(ctx context.Context, email, ip string) error {
+	now := g.now()
+	subjects := g.subjects(email, ip)
+
+	var wait time.Duration
+	for _, subject := range subjects {
+		value, err := g.store.Get(ctx, loginBlockedKey(subject))
+		if errors.Is(err, store.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		until, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		if remaining := time.Unix(0, until).Sub(now); remaining > wait {
+			wait = remaining
+		}
+	}
+
+	if wait > 0 {
+		return &ratelimit.LimitedError{RetryAfter: wait}
+	}
+
+	for i, subject := range subjects {
+		ok, err := g.reserve(ctx, subject)
+		if err == nil && ok {
+			continue
+		}
+		g.release(ctx, subjects[:i])
+		if err != nil {
+			return err
+		}
+		return &ratelimit.LimitedError{RetryAfter: loginAttemptRetry}
+	}
+	return nil
+}
+
+// Release gives back the slot Check reserved for an attempt.
+func (g *LoginGuard) Release(ctx context.Context, email, ip string) {
+	g.release(ctx, g.subjects(email, ip))
+}
+
+// reserve takes an attempt slot for subject. The free attempts left, plus
+// one, may be in flight together; once backing off, one at a time. The
+// count of attempts in flight is bumped before the failures are read, so
+// racing attempts see each other.
+func (g *LoginGuard) reserve(ctx context.Context, subject loginSubject) (bool, error) {
+	inFlight, err := g.store.Incr(ctx, loginAttemptsKey(subject), loginAttemptTTL)
+	if err != nil {
+		return false, err
+	}
+
+	failures := 0
+	value, err := g.store.Get(ctx, loginFailuresKey(subject))
+	if err == nil {
+		failures, _ = strconv.Atoi(value)
+	} else if !errors.Is(err, store.ErrNotFound) {
+		g.release(ctx, []loginSubject{subject})
+		return false, err
+	}
+
+	if int(inFlight) <= max(subject.freeAttempts-failures, 0)+1 {
+		return true, nil
+	}
+	g.release(ctx, []loginSubject{subject})
+	return false, nil
+}
+
+// release gives back a slot for each subject. It runs even if ctx is done,
+// since a slot left taken turns away later attempts.
+func (g *LoginGuard) release(ctx context.Context, subjects []loginSubject) {
+	ctx = context.WithoutCancel(ctx)
+	for _, subject := range subjects {
+		if err := g.decrement(ctx, loginAttemptsKey(subject)); err != nil {
+			log.Printf("Failed to release login attempt for %s %s: %v", subject.kind, subject.id, err)
+		}
+	}
+}
+
+// decrement lowers the counter at key by one, never below zero. A missing
+// key, expired or never made, has nothing to give back.
+func (g *LoginGuard) decrement(ctx context.Context, key string) error {
+	for {
+		value, err := g.store.Get(ctx, key)
+		if errors.Is(err, store.ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		n, _ := strconv.ParseInt(value, 10, 64)
+		swapped, err := g.store.CompareAndSwap(ctx, key, value, strconv.FormatInt(max(n-1, 0), 10), loginAttemptTTL)
+		if swapped || errors.Is(err, store.ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// RecordFailure counts a failed login and blocks the account and IP for
+// their backoff delay, or the lockout duration once past the threshold.
+func (g *LoginGuard) RecordFailure(ctx context.Context, email, ip string) error {
+	for _, subject := range g.subjects(email, ip) {
+		failures, err := g.store.Incr(ctx, loginFailuresKey(subject), g.policy.FailureWindow)
+		if err != nil {
+			return err
+		}
+
+		delay := g.delay(subject, int(failures))
+		if delay <= 0 {
+			continue
+		}
+
+		until := g.now().Add(delay)
+		if err := g.store.Set(ctx, loginBlockedKey(subject), strconv.FormatInt(until.UnixNano(), 10), delay); err != nil {
+			return err
+		}
+
+		if subject.threshold > 0 && int(failures) >= subject.threshold {
+			event := audit.Event{
+				Type:   audit.LoginLocked,
+				Detail: fmt.Sprintf("%s locked until %s after %d failed logins", subject.kind, until.UTC().Format(time.RFC3339), failures),
+			}
+			if subject.kind == "account" {
+				event.Email = subject.id
+			} else {
+				event.IP = subject.id
+			}
+			g.recorder.Record(ctx, event)
+		}
+	}
+	return nil
+}
+
+// RecordSuccess clears the account's failures. The IP's are kept, so one
+// valid account does not let an attacker reset the per-IP counter.
+func (g *LoginGuard) RecordSuccess(ctx context.Context, email string) error {
+	return g.clearAccount(ctx, email)
+}
+
+// Unlock lifts a lockout or backoff on a user's account.
+func (g *LoginGuard) Unlock(ctx context.Context, actorID, userID uint) error {
+	user, err := g.userRepo.GetByID(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := g.clearAccount(ctx, user.Email); err != nil {
+		return err
+	}
+
+	g.recorder.Record(ctx, audit.Event{
+		Type:    audit.LoginUnlocked,
+		ActorID: actorID,
+		UserID:  user.ID,
+		Email:   user.Email,
+	})
+	return nil
+}
+
+func (g *LoginGuard) clearAccount(ctx context.Context, email string) error {
+	subject := loginSubject{kind: "account", id: normalizeLoginEmail(email)}
+	return g.store.Del(ctx, loginFailuresKey(subject), loginBlockedKey(subject))
+}
+
+func (g *LoginGuard) delay(subject loginSubject, failures int) time.Duration {
+	if subject.threshold > 0 && failures >= subject.threshold {
+		return g.policy.LockoutDuration
+	}
+	if failures <= subject.freeAttempts {
+		return 0
+	}
+
+	delay := g.policy.BackoffBase
+	for i := subject.freeAttempts + 1; i < failures && delay < g.policy.BackoffMax; i++ {
+		delay *= 2
+	}
+	return min(delay, g.policy.BackoffMax)
+}
+
+// normalizeLoginEmail keeps attackers from dodging the per-account counter
+// by changing the case of the address.
+func normalizeLoginEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func loginFailuresKey(subject loginSubject) string {
+	return "login_failures:" + subject.kind + ":" + subject.id
+}
+
+func loginAttemptsKey(subject loginSubject) string {
+	return "login_attempts:" + subject.kind + ":" + subject.id
+}
+
+func loginBlockedKey(subject loginSubject) string {
+	return "login_blocked:" + subject.kind + ":" + subject.id
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/audit"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/ratelimit"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/store"
+	"github.com/tamabsndra/miniproject/miniproject-backend/repository"
+)
+
+// TestLoginGuardConcurrentAttempts fires many guesses at once, all checked
+// before any of them fails, as a parallel attacker would.
+func TestLoginGuardConcurrentAttempts(t *testing.T) {
+	ctx := context.Background()
+	guard := NewLoginGuard(store.NewMemoryStore(), repository.NewMemoryUserRepository(), &audit.MemoryRecorder{}, LoginGuardPolicy{
+		AccountFreeAttempts:     3,
+		IPFreeAttempts:          20,
+		BackoffBase:             time.Second,
+		BackoffMax:              time.Minute,
+		AccountLockoutThreshold: 10,
+		IPLockoutThreshold:      50,
+		LockoutDuration:         15 * time.Minute,
+		FailureWindow:           time.Hour,
+	})
+
+	const attempts = 50
+	var (
+		checked sync.WaitGroup
+		done    sync.WaitGroup
+		mu      sync.Mutex
+		allowed int
+	)
+	checked.Add(attempts)
+	done.Add(attempts)
+	for i := 0; i < attempts; i++ {
+		go func() {
+			defer done.Done()
+			err := guard.Check(ctx, "victim@example.com", "203.0.113.7")
+			checked.Done()
+			var limited *ratelimit.LimitedError
+			if errors.As(err, &limited) {
+				return
+			}
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			mu.Lock()
+			allowed++
+			mu.Unlock()
+			// Hold the slot until every attempt has been checked, like a
+			// slow password hash would.
+			checked.Wait()
+			if err := guard.RecordFailure(ctx, "victim@example.com", "203.0.113.7"); err != nil {
+				t.Error(err)
+			}
+			guard.Release(ctx, "victim@example.com", "203.0.113.7")
+		}()
+	}
+	done.Wait()
+
+	// Sequential guesses get the free attempts plus one before backing off.
+	if allowed != 4 {
+		t.Fatalf("%d concurrent attempts allowed, want 4", allowed)
+	}
+	var limited *ratelimit.LimitedError
+	if err := guard.Check(ctx, "victim@example.com", "203.0.113.7"); !errors.As(err, &limited) {
+		t.Fatalf("Check after the free attempts = %v, want a backoff", err)
+	}
+
+	// Slots are given back, so another account from the same IP still gets
+	// its own free attempts.
+	for i := 0; i < 4; i++ {
+		if err := guard.Check(ctx, "other@example.com", "203.0.113.7"); err != nil {
+			t.Fatalf("attempt %d for another account: %v", i+1, err)
+		}
+		if err := guard.RecordFailure(ctx, "other@example.com", "203.0.113.7"); err != nil {
+			t.Fatal(err)
+		}
+		guard.Release(ctx, "other@example.com", "203.0.113.7")
+	}
+}
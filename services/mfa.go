@@ -0,0 +1,260 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tamabsndra/miniproject/miniproject-backend/models"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/qrcode"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/ratelimit"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/store"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/totp"
+	"github.com/tamabsndra/miniproject/miniproject-backend/repository"
+	"github.com/tamabsndra/miniproject/miniproject-backend/utils"
+)
+
+var (
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrMFANotEnrolled    = errors.New("start two-factor enrollment first")
+	ErrInvalidMFACode    = errors.New("invalid authentication code")
+)
+
+const (
+	// Codes from one step either side of the current one are accepted to
+	// allow for clock drift.
+	totpSkew = 1
+	// mfaAttemptLimit caps code checks per user per mfaAttemptWindow, which
+	// keeps guessing a six digit code impractical.
+	mfaAttemptLimit  = 5
+	mfaAttemptWindow = 5 * time.Minute
+
+	recoveryCodeCount  = 10
+	recoveryCodeLength = 10
+	qrCodeScale        = 6
+)
+
+// MFAService manages TOTP enrollment and checks second factors. Recovery
+// codes are stored as SHA-256 hashes and each works once.
+type MFAService struct {
+	mfaRepo      repository.MFARepository
+	userRepo     repository.UserRepository
+	tokenService *TokenService
+	store        store.Store
+	limiter      *ratelimit.Limiter
+	issuer       string
+	pendingTTL   time.Duration
+}
+
+func NewMFAService(mfaRepo repository.MFARepository, userRepo repository.UserRepository, tokenService *TokenService, store store.Store, limiter *ratelimit.Limiter, issuer string, pendingTTL time.Duration) *MFAService {
+	return &MFAService{
+		mfaRepo:      mfaRepo,
+		userRepo:     userRepo,
+		tokenService: tokenService,
+		store:        store,
+		limiter:      limiter,
+		issuer:       issuer,
+		pendingTTL:   pendingTTL,
+	}
+}
+
+// Enabled reports whether logins for the user need a second factor.
+func (s *MFAService) Enabled(ctx context.Context, userID uint) (bool, error) {
+	enrollment, err := s.mfaRepo.GetTOTP(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return enrollment.EnabledAt != nil, nil
+}
+
+// BeginEnrollment generates a new secret for the user. It does not protect
+// logins until confirmed with ConfirmEnrollment; starting again replaces a
+// pending secret.
+func (s *MFAService) BeginEnrollment(ctx context.Context, userID uint) (*models.TOTPSetupResponse, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.mfaRepo.SavePendingTOTP(ctx, userID, secret); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrMFAAlreadyEnabled
+		}
+		return nil, err
+	}
+
+	uri := totp.URI(s.issuer, user.Email, secret)
+	png, err := qrcode.PNG([]byte(uri), qrCodeScale)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TOTPSetupResponse{
+		Secret:     secret,
+		OTPAuthURI: uri,
+		QRCode:     "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+	}, nil
+}
+
+// ConfirmEnrollment enables TOTP once the user proves their app produces
+// valid codes, and returns freshly generated recovery codes. The codes are
+// not stored in plain text, so this is the only time they are available.
+func (s *MFAService) ConfirmEnrollment(ctx context.Context, userID uint, code string) ([]string, error) {
+	enrollment, err := s.mfaRepo.GetTOTP(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrMFANotEnrolled
+	}
+	if err != nil {
+		return nil, err
+	}
+	if enrollment.EnabledAt != nil {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	if err := s.checkTOTP(ctx, userID, enrollment.Secret, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.mfaRepo.EnableTOTP(ctx, userID, hashes); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrMFAAlreadyEnabled
+		}
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Disable turns TOTP off after checking a current code or recovery code.
+func (s *MFAService) Disable(ctx context.Context, userID uint, code string) error {
+	if err := s.VerifyCode(ctx, userID, code); err != nil {
+		return err
+	}
+
+	err := s.mfaRepo.DeleteTOTP(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrMFANotEnabled
+	}
+	return err
+}
+
+// VerifyCode checks an authenticator code or an unused recovery code for a
+// user with TOTP enabled. Checks are rate limited per user.
+func (s *MFAService) VerifyCode(ctx context.Context, userID uint, code string) error {
+	enrollment, err := s.mfaRepo.GetTOTP(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrMFANotEnabled
+	}
+	if err != nil {
+		return err
+	}
+	if enrollment.EnabledAt == nil {
+		return ErrMFANotEnabled
+	}
+
+	if isTOTPCode(code) {
+		return s.checkTOTP(ctx, userID, enrollment.Secret, code)
+	}
+
+	if err := s.allowAttempt(ctx, userID); err != nil {
+		return err
+	}
+	err = s.mfaRepo.UseRecoveryCode(ctx, userID, utils.HashToken(normalizeRecoveryCode(code)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrInvalidMFACode
+	}
+	return err
+}
+
+// StartLogin returns the mfa_pending token for a user who has passed the
+// password check.
+func (s *MFAService) StartLogin(ctx context.Context, user models.User) (string, error) {
+	return s.tokenService.IssueMFAPendingToken(ctx, user, s.pendingTTL)
+}
+
+// checkTOTP validates a code against secret and rejects a code that was
+// already used in its time step.
+func (s *MFAService) checkTOTP(ctx context.Context, userID uint, secret, code string) error {
+	if err := s.allowAttempt(ctx, userID); err != nil {
+		return err
+	}
+
+	step, ok := totp.Validate(secret, code, time.Now(), totpSkew)
+	if !ok {
+		return ErrInvalidMFACode
+	}
+
+	uses, err := s.store.Incr(ctx, totpUsedKey(userID, step), (2*totpSkew+1)*totp.Period)
+	if err != nil {
+		return err
+	}
+	if uses > 1 {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+func (s *MFAService) allowAttempt(ctx context.Context, userID uint) error {
+	return s.limiter.Allow(ctx, fmt.Sprintf("mfa:%d", userID), mfaAttemptLimit, mfaAttemptWindow)
+}
+
+func isTOTPCode(code string) bool {
+	if len(code) != 6 {
+		return false
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// generateRecoveryCodes returns codes formatted for display, such as
+// "abcde-fghij", and the hashes to store.
+func generateRecoveryCodes() (codes, hashes []string, err error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, recoveryCodeLength)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+
+		code := strings.ToLower(encoding.EncodeToString(b))[:recoveryCodeLength]
+		codes = append(codes, code[:recoveryCodeLength/2]+"-"+code[recoveryCodeLength/2:])
+		hashes = append(hashes, utils.HashToken(code))
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode accepts codes typed with any case and separators.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+func totpUsedKey(userID uint, step int64) string {
+	return fmt.Sprintf("totp_used:%d:%d", userID, step)
+}
@@ -0,0 +1,259 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tamabsndra/miniproject/miniproject-backend/models"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/oidc"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/passhash"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/store"
+	"github.com/tamabsndra/miniproject/miniproject-backend/repository"
+	"github.com/tamabsndra/miniproject/miniproject-backend/utils"
+)
+
+var (
+	ErrUnknownOIDCProvider = errors.New("unknown sign-in provider")
+	ErrInvalidOIDCState    = errors.New("sign-in request is invalid or has expired")
+	// ErrOIDCProvider wraps failures talking to the provider or verifying
+	// what it returned.
+	ErrOIDCProvider      = errors.New("sign-in provider error")
+	ErrOIDCEmailRequired = errors.New("the provider did not share an email address")
+	// ErrOIDCEmailNotVerified means an account already uses the email but
+	// the provider or the account has not verified it, so the identity
+	// cannot be linked.
+	ErrOIDCEmailNotVerified = errors.New("an account with this email already exists; sign in with your password")
+)
+
+// OIDCProvider is the part of an OpenID provider client that OIDCService
+// needs.
+type OIDCProvider interface {
+	AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error)
+	Exchange(ctx context.Context, code, codeVerifier, nonce string) (*oidc.Claims, error)
+}
+
+// oidcLoginState is kept in the store between the redirect to the provider
+// and the callback. BindingHash ties it to the browser that started the
+// sign-in.
+type oidcLoginState struct {
+	Provider     string `json:"provider"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+	BindingHash  string `json:"binding_hash"`
+}
+
+// OIDCService signs users in through external OpenID providers using the
+// authorization code flow with PKCE. Identities are linked to users by the
+// provider's subject; a first sign-in links to the account with the same
+// email, when both the provider and the account verified it, or creates one.
+type OIDCService struct {
+	providers    map[string]OIDCProvider
+	identityRepo repository.IdentityRepository
+	userRepo     repository.UserRepository
+	hasher       *passhash.Hasher
+	authService  *AuthService
+	store        store.Store
+	stateTTL     time.Duration
+}
+
+func NewOIDCService(providers map[string]OIDCProvider, identityRepo repository.IdentityRepository, userRepo repository.UserRepository, hasher *passhash.Hasher, authService *AuthService, store store.Store, stateTTL time.Duration) *OIDCService {
+	return &OIDCService{
+		providers:    providers,
+		identityRepo: identityRepo,
+		userRepo:     userRepo,
+		hasher:       hasher,
+		authService:  authService,
+		store:        store,
+		stateTTL:     stateTTL,
+	}
+}
+
+// StateTTL is how long a started sign-in can be completed.
+func (s *OIDCService) StateTTL() time.Duration {
+	return s.stateTTL
+}
+
+// Start returns the provider URL to send the browser to, and a binding
+// secret the browser must present to Callback. Without the binding an
+// attacker could have a victim's browser complete the attacker's own
+// sign-in.
+func (s *OIDCService) Start(ctx context.Context, providerName string) (authURL, binding string, err error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return "", "", ErrUnknownOIDCProvider
+	}
+
+	state, err := utils.GenerateRandomID(32)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := utils.GenerateRandomID(32)
+	if err != nil {
+		return "", "", err
+	}
+	binding, err = utils.GenerateRandomID(32)
+	if err != nil {
+		return "", "", err
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		return "", "", err
+	}
+
+	authURL, err = provider.AuthCodeURL(ctx, state, nonce, challenge)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %v", ErrOIDCProvider, err)
+	}
+
+	value, err := json.Marshal(oidcLoginState{
+		Provider:     providerName,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		BindingHash:  utils.HashToken(binding),
+	})
+	if err != nil {
+		return "", "", err
+	}
+	if err := s.store.Set(ctx, oidcStateKey(state), string(value), s.stateTTL); err != nil {
+		return "", "", err
+	}
+	return authURL, binding, nil
+}
+
+// Callback completes a sign-in started with Start in the browser holding
+// binding. The state is single use.
+func (s *OIDCService) Callback(ctx context.Context, providerName string, req models.OIDCCallbackRequest, binding string, client models.ClientInfo) (*models.LoginResponse, error) {
+	provider, ok := s.providers[providerName]
+	if !ok {
+		return nil, ErrUnknownOIDCProvider
+	}
+
+	value, err := s.store.GetDel(ctx, oidcStateKey(req.State))
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, ErrInvalidOIDCState
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var state oidcLoginState
+	if err := json.Unmarshal([]byte(value), &state); err != nil || state.Provider != providerName {
+		return nil, ErrInvalidOIDCState
+	}
+	if binding == "" || subtle.ConstantTimeCompare([]byte(utils.HashToken(binding)), []byte(state.BindingHash)) != 1 {
+		return nil, ErrInvalidOIDCState
+	}
+
+	claims, err := provider.Exchange(ctx, req.Code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, fmt.Errorf("%w: %v", ErrOIDCProvider, err)
+	}
+
+	user, err := s.resolveUser(ctx, providerName, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Device != "" {
+		client.Device = req.Device
+	}
+	return s.authService.beginSession(ctx, user, client)
+}
+
+// resolveUser finds the user linked to the identity, linking or creating
+// one on first sign-in.
+func (s *OIDCService) resolveUser(ctx context.Context, providerName string, claims *oidc.Claims) (*models.User, error) {
+	identity, err := s.identityRepo.Get(ctx, providerName, claims.Subject)
+	if err == nil {
+		return s.userRepo.GetByID(ctx, identity.UserID)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	if claims.Email == "" {
+		return nil, ErrOIDCEmailRequired
+	}
+
+	user, err := s.userRepo.GetByEmail(ctx, claims.Email)
+	switch {
+	case err == nil:
+		// Linking on an unverified address would let anyone who can
+		// register it at the provider take over the account. The account
+		// must have verified it too: otherwise whoever registered it with a
+		// password, before its owner ever signed in, keeps that password.
+		if !claims.EmailVerified || user.EmailVerifiedAt == nil {
+			return nil, ErrOIDCEmailNotVerified
+		}
+	case errors.Is(err, sql.ErrNoRows):
+		if user, err = s.createUser(ctx, claims); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	err = s.identityRepo.Create(ctx, &models.UserIdentity{
+		UserID:   user.ID,
+		Provider: providerName,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	})
+	if err != nil {
+		// A concurrent callback for the same identity may have linked it
+		// first.
+		if identity, getErr := s.identityRepo.Get(ctx, providerName, claims.Subject); getErr == nil {
+			return s.userRepo.GetByID(ctx, identity.UserID)
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// createUser registers an account for a new identity. It gets a random
+// password nobody knows; the user can set one through password reset.
+func (s *OIDCService) createUser(ctx context.Context, claims *oidc.Claims) (*models.User, error) {
+	password, err := utils.GenerateRandomID(32)
+	if err != nil {
+		return nil, err
+	}
+	hashedPassword, err := s.hasher.Hash(password)
+	if err != nil {
+		return nil, err
+	}
+
+	name := claims.Name
+	if name == "" {
+		name = claims.Email
+	}
+
+	user := models.User{
+		Email:     claims.Email,
+		Password:  hashedPassword,
+		Name:      name,
+		CreatedAt: utils.GetCurrentTime(),
+		UpdatedAt: utils.GetCurrentTime(),
+	}
+	if err := s.userRepo.Create(ctx, &user); err != nil {
+		return nil, err
+	}
+
+	if claims.EmailVerified {
+		if err := s.userRepo.MarkEmailVerified(ctx, user.ID); err != nil {
+			return nil, err
+		}
+	}
+	return s.userRepo.GetByID(ctx, user.ID)
+}
+
+func oidcStateKey(state string) string {
+	return "oidc_state:" + state
+}
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/tamabsndra/miniproject/miniproject-backend/models"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/mailer"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/passhash"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/passpolicy"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/ratelimit"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/store"
+	"github.com/tamabsndra/miniproject/miniproject-backend/repository"
+	"github.com/tamabsndra/miniproject/miniproject-backend/utils"
+)
+
+var ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+
+// PasswordResetService issues single-use reset tokens by email. Only the
+// SHA-256 of a token is stored, keyed to the user it was issued for, and a
+// user has at most one live token at a time. An account is sent at most one
+// reset email per cooldown.
+type PasswordResetService struct {
+	userRepo     repository.UserRepository
+	hasher       *passhash.Hasher
+	policy       *passpolicy.Policy
+	store        store.Store
+	limiter      *ratelimit.Limiter
+	tokenService *TokenService
+	mailer       mailer.Mailer
+	tokenTTL     time.Duration
+	cooldown     time.Duration
+	appURL       string
+	tasks        backgroundTasks
+}
+
+func NewPasswordResetService(userRepo repository.UserRepository, hasher *passhash.Hasher, policy *passpolicy.Policy, store store.Store, limiter *ratelimit.Limiter, tokenService *TokenService, mailer mailer.Mailer, tokenTTL, cooldown time.Duration, appURL string) *PasswordResetService {
+	return &PasswordResetService{
+		userRepo:     userRepo,
+		hasher:       hasher,
+		policy:       policy,
+		store:        store,
+		limiter:      limiter,
+		tokenService: tokenService,
+		mailer:       mailer,
+		tokenTTL:     tokenTTL,
+		cooldown:     cooldown,
+		appURL:       appURL,
+	}
+}
+
+// RequestReset emails a reset link to the account with the given email. The
+// work happens in the background and failures are only logged: unknown
+// addresses and repeat requests inside the cooldown send nothing, and
+// neither the outcome nor the time taken tells callers whether the account
+// exists.
+func (s *PasswordResetService) RequestReset(ctx context.Context, email string) {
+	s.tasks.run(ctx, "password reset request", func(ctx context.Context) error {
+		return s.requestReset(ctx, email)
+	})
+}
+
+// Wait blocks until the reset emails already requested have been sent.
+func (s *PasswordResetService) Wait() {
+	s.tasks.wait()
+}
+
+func (s *PasswordResetService) requestReset(ctx context.Context, email string) error {
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+
+	if err := s.limiter.Allow(ctx, fmt.Sprintf("password_reset_request:%d", user.ID), 1, s.cooldown); err != nil {
+		var limited *ratelimit.LimitedError
+		if errors.As(err, &limited) {
+			return nil
+		}
+		return err
+	}
+
+	token, err := utils.GenerateRandomID(32)
+	if err != nil {
+		return err
+	}
+	hash := utils.HashToken(token)
+
+	previous, err := s.store.Get(ctx, passwordResetUserKey(user.ID))
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+	if previous != "" {
+		if err := s.store.Del(ctx, passwordResetKey(previous)); err != nil {
+			return err
+		}
+	}
+
+	if err := s.store.Set(ctx, passwordResetKey(hash), strconv.FormatUint(uint64(user.ID), 10), s.tokenTTL); err != nil {
+		return err
+	}
+	if err := s.store.Set(ctx, passwordResetUserKey(user.ID), hash, s.tokenTTL); err != nil {
+		return err
+	}
+
+	link := s.appURL + "/reset-password?token=" + url.QueryEscape(token)
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nUse the link below to choose a new password. It expires in %s and can be used once.\n\n%s\n\nIf you did not ask for this, you can ignore this email.\n",
+			user.Name, s.tokenTTL, link),
+	})
+}
+
+// ResetPassword consumes the token, sets the new password and revokes every
+// token issued to the user before the reset. The token is only consumed
+// once the password passes the policy, so a rejected password can be
+// retried with the same link.
+func (s *PasswordResetService) ResetPassword(ctx context.Context, req models.ResetPasswordRequest) error {
+	key := passwordResetKey(utils.HashToken(req.Token))
+	value, err := s.store.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+
+	userID, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return ErrInvalidResetToken
+	}
+
+	user, err := s.userRepo.GetByID(ctx, uint(userID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+	if err := s.policy.Check(req.Password, user.Email, user.Name); err != nil {
+		return err
+	}
+
+	// GetDel decides between concurrent resets with the same token.
+	if _, err := s.store.GetDel(ctx, key); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+
+	hashedPassword, err := s.hasher.Hash(req.Password)
+	if err != nil {
+		return err
+	}
+
+	if err := s.userRepo.UpdatePassword(ctx, user.ID, hashedPassword); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+
+	if err := s.store.Del(ctx, passwordResetUserKey(user.ID)); err != nil {
+		return err
+	}
+	return s.tokenService.RevokeAllUserTokens(ctx, user.ID)
+}
+
+func passwordResetKey(tokenHash string) string {
+	return fmt.Sprintf("password_reset:%s", tokenHash)
+}
+
+func passwordResetUserKey(userID uint) string {
+	return fmt.Sprintf("password_reset_user:%d", userID)
+}
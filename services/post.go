@@ -1,50 +1,403 @@
 package services
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
 	"github.com/tamabsndra/miniproject/miniproject-backend/models"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/textdiff"
 	"github.com/tamabsndra/miniproject/miniproject-backend/repository"
 )
 
+var (
+	ErrPostNotFound     = errors.New("post not found")
+	ErrPostForbidden    = errors.New("you are not allowed to modify this post")
+	ErrRevisionNotFound = errors.New("revision not found")
+	ErrPostRemoved      = errors.New("this post was removed by a moderator and cannot be restored")
+)
+
+// diffContextLines is how many unchanged lines surround each change in a
+// unified diff.
+const diffContextLines = 3
+
 type PostService struct {
-    postRepo *repository.PostRepository
+    postRepo repository.PostRepository
 }
 
-func NewPostService(postRepo *repository.PostRepository) *PostService {
+func NewPostService(postRepo repository.PostRepository) *PostService {
     return &PostService{
         postRepo: postRepo,
     }
 }
 
-func (s *PostService) Create(userID uint, req models.CreatePostRequest) (*models.Post, error) {
+// Create saves a new post as a draft, or publishes or schedules it as the
+// request asks. A scheduled time that has already passed publishes at once.
+func (s *PostService) Create(ctx context.Context, userID uint, req models.CreatePostRequest) (*models.Post, error) {
     post := &models.Post{
         UserID:  userID,
         Title:   req.Title,
         Content: req.Content,
+        Status:  models.PostStatusDraft,
+    }
+    switch req.Status {
+    case models.PostStatusPublished:
+        post.Status, post.PublishedAt = publication(nil)
+    case models.PostStatusScheduled:
+        post.Status, post.PublishedAt = publication(req.PublishAt)
     }
 
-    return s.postRepo.Create(post)
+    return s.postRepo.Create(ctx, post)
+}
+
+// GetAll lists published posts and viewerID's own posts in any status.
+func (s *PostService) GetAll(ctx context.Context, viewerID uint, q models.PostListQuery) (*models.PostPage, error) {
+    q.ViewerID = viewerID
+    return s.postRepo.GetAll(ctx, q)
+}
+
+func (s *PostService) Search(ctx context.Context, viewerID uint, q models.PostSearchQuery) (*models.PostSearchPage, error) {
+	q.ViewerID = viewerID
+	return s.postRepo.Search(ctx, q)
+}
+
+// GetByID returns a post if viewerID may see it. Unpublished posts of other
+// authors are reported as not found.
+func (s *PostService) GetByID(ctx context.Context, viewerID, id uint) (*models.Post, error) {
+    post, err := s.postRepo.GetByID(ctx, id)
+    if errors.Is(err, sql.ErrNoRows) {
+        return nil, ErrPostNotFound
+    }
+    if err != nil {
+        return nil, err
+    }
+    if post.Status != models.PostStatusPublished && post.UserID != viewerID {
+        return nil, ErrPostNotFound
+    }
+    return post, nil
+}
+
+func (s *PostService) GetByUserID(ctx context.Context, userID uint, q models.PostListQuery) (*models.PostPage, error) {
+	return s.postRepo.GetByUserID(ctx, userID, q)
+}
+
+func (s *PostService) Update(ctx context.Context, userID, id uint, req models.UpdatePostRequest) (*models.Post, error) {
+	if err := s.authorize(ctx, userID, id); err != nil {
+		return nil, err
+	}
+	return s.ModerateUpdate(ctx, userID, id, req)
+}
+
+// Delete moves the author's post to the trash.
+func (s *PostService) Delete(ctx context.Context, userID, id uint) error {
+	if err := s.authorize(ctx, userID, id); err != nil {
+		return err
+	}
+
+	err := s.postRepo.Delete(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrPostNotFound
+	}
+	return err
+}
+
+// ModerateUpdate updates any post regardless of its author, recording the
+// change as a revision by editorID. Callers must have checked the
+// posts:moderate permission.
+func (s *PostService) ModerateUpdate(ctx context.Context, editorID, id uint, req models.UpdatePostRequest) (*models.Post, error) {
+	post, err := s.postRepo.Update(ctx, id, editorID, req)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPostNotFound
+	}
+	return post, err
+}
+
+// ModerateDelete moves any post to its author's trash, including one the
+// author already trashed, and marks it so the author cannot restore it.
+// Callers must have checked the posts:moderate permission.
+func (s *PostService) ModerateDelete(ctx context.Context, id uint) error {
+	err := s.postRepo.Remove(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrPostNotFound
+	}
+	return err
+}
+
+// Trash lists the user's deleted posts that have not been purged yet.
+func (s *PostService) Trash(ctx context.Context, userID uint, q models.PostListQuery) (*models.PostPage, error) {
+	q.AuthorID = userID
+	q.Trashed = true
+	return s.postRepo.GetAll(ctx, q)
+}
+
+// Restore takes the author's post back out of the trash, as it was when it
+// was deleted. Posts a moderator removed stay in the trash.
+func (s *PostService) Restore(ctx context.Context, userID, id uint) (*models.Post, error) {
+	if _, err := s.trashedPost(ctx, userID, id); err != nil {
+		return nil, err
+	}
+
+	// The repository refuses moderator removals in the same statement that
+	// restores, so a removal racing this restore cannot be undone by it.
+	post, err := s.postRepo.Restore(ctx, id)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return post, err
+	}
+	trashed, err := s.trashedPost(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if trashed.RemovedByModerator {
+		return nil, ErrPostRemoved
+	}
+	return nil, ErrPostNotFound
+}
+
+// Purge permanently deletes the author's post from the trash.
+func (s *PostService) Purge(ctx context.Context, userID, id uint) error {
+	if _, err := s.trashedPost(ctx, userID, id); err != nil {
+		return err
+	}
+
+	err := s.postRepo.Purge(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrPostNotFound
+	}
+	return err
 }
 
-func (s *PostService) GetAll() ([]models.Post, error) {
-    return s.postRepo.GetAll()
+// PurgeExpired permanently deletes posts that have been in the trash for
+// longer than retention.
+func (s *PostService) PurgeExpired(ctx context.Context, retention time.Duration) (int64, error) {
+	return s.postRepo.PurgeDeletedBefore(ctx, time.Now().Add(-retention))
 }
 
-func (s *PostService) GetByID(id uint) (*models.Post, error) {
-    return s.postRepo.GetByID(id)
+// RunPurger calls PurgeExpired every interval until ctx is done. Failures
+// are logged and retried on the next tick.
+func (s *PostService) RunPurger(ctx context.Context, interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := s.PurgeExpired(ctx, retention)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("post purger: %v", err)
+				}
+				continue
+			}
+			if purged > 0 {
+				log.Printf("post purger: purged %d trashed post(s)", purged)
+			}
+		}
+	}
+}
+
+// Revisions returns the history of the author's post, newest first.
+func (s *PostService) Revisions(ctx context.Context, userID, id uint) ([]models.PostRevision, error) {
+	if err := s.authorize(ctx, userID, id); err != nil {
+		return nil, err
+	}
+	return s.postRepo.ListRevisions(ctx, id)
+}
+
+// DiffRevisions compares two revisions of the author's post: word by word
+// for the title and content, and line by line in unified format for the
+// content.
+func (s *PostService) DiffRevisions(ctx context.Context, userID, id uint, q models.PostRevisionDiffQuery) (*models.PostRevisionDiff, error) {
+	if err := s.authorize(ctx, userID, id); err != nil {
+		return nil, err
+	}
+
+	from, err := s.revision(ctx, id, q.From)
+	if err != nil {
+		return nil, err
+	}
+	to, err := s.revision(ctx, id, q.To)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.PostRevisionDiff{
+		PostID:  id,
+		From:    from.Revision,
+		To:      to.Revision,
+		Title:   diffSegments(textdiff.Words(from.Title, to.Title)),
+		Content: diffSegments(textdiff.Words(from.Content, to.Content)),
+		Unified: textdiff.Unified(
+			fmt.Sprintf("revision %d", from.Revision),
+			fmt.Sprintf("revision %d", to.Revision),
+			from.Content, to.Content, diffContextLines,
+		),
+	}, nil
+}
+
+// RestoreRevision sets the author's post back to an earlier revision's
+// title and content. The history is kept: the restored text is saved as a
+// new revision.
+func (s *PostService) RestoreRevision(ctx context.Context, userID, id uint, revision int) (*models.Post, error) {
+	if err := s.authorize(ctx, userID, id); err != nil {
+		return nil, err
+	}
+
+	old, err := s.revision(ctx, id, revision)
+	if err != nil {
+		return nil, err
+	}
+	return s.ModerateUpdate(ctx, userID, id, models.UpdatePostRequest{Title: old.Title, Content: old.Content})
+}
+
+func (s *PostService) revision(ctx context.Context, id uint, revision int) (*models.PostRevision, error) {
+	result, err := s.postRepo.GetRevision(ctx, id, revision)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRevisionNotFound
+	}
+	return result, err
+}
+
+// Publish makes the author's post public now, or schedules it when
+// req.PublishAt is in the future. Publishing a published post keeps its
+// original publication time.
+func (s *PostService) Publish(ctx context.Context, userID, id uint, req models.PublishPostRequest) (*models.Post, error) {
+	post, err := s.authorizedPost(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	status, publishedAt := publication(req.PublishAt)
+	if status == models.PostStatusPublished && post.Status == models.PostStatusPublished {
+		return post, nil
+	}
+	return s.setStatus(ctx, id, status, publishedAt)
+}
+
+// Unpublish turns the author's published, scheduled or archived post back
+// into a draft.
+func (s *PostService) Unpublish(ctx context.Context, userID, id uint) (*models.Post, error) {
+	if _, err := s.authorizedPost(ctx, userID, id); err != nil {
+		return nil, err
+	}
+	return s.setStatus(ctx, id, models.PostStatusDraft, nil)
 }
 
-func (s *PostService) GetByUserID(userID uint) ([]models.Post, error) {
-	return s.postRepo.GetByUserID(userID)
+// Archive hides the author's post from everyone else while keeping when it
+// was published.
+func (s *PostService) Archive(ctx context.Context, userID, id uint) (*models.Post, error) {
+	post, err := s.authorizedPost(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	publishedAt := post.PublishedAt
+	if post.Status == models.PostStatusScheduled {
+		publishedAt = nil
+	}
+	return s.setStatus(ctx, id, models.PostStatusArchived, publishedAt)
+}
+
+// PublishDue publishes the scheduled posts whose time has come.
+func (s *PostService) PublishDue(ctx context.Context) (int64, error) {
+	return s.postRepo.PublishDue(ctx, time.Now())
+}
+
+// RunScheduler calls PublishDue every interval until ctx is done. Failures
+// are logged and retried on the next tick.
+func (s *PostService) RunScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			published, err := s.PublishDue(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("post scheduler: %v", err)
+				}
+				continue
+			}
+			if published > 0 {
+				log.Printf("post scheduler: published %d scheduled post(s)", published)
+			}
+		}
+	}
+}
+
+func (s *PostService) setStatus(ctx context.Context, id uint, status string, publishedAt *time.Time) (*models.Post, error) {
+	post, err := s.postRepo.SetStatus(ctx, id, status, publishedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPostNotFound
+	}
+	return post, err
+}
+
+// authorize checks that the post exists and belongs to userID.
+func (s *PostService) authorize(ctx context.Context, userID, id uint) error {
+	_, err := s.authorizedPost(ctx, userID, id)
+	return err
+}
+
+// trashedPost returns the post if it is in the trash and belongs to userID.
+func (s *PostService) trashedPost(ctx context.Context, userID, id uint) (*models.Post, error) {
+	post, err := s.postRepo.GetTrashed(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrPostNotFound
+		}
+		return nil, err
+	}
+
+	if post.UserID != userID {
+		return nil, ErrPostForbidden
+	}
+	return post, nil
+}
+
+// authorizedPost returns the post if it exists and belongs to userID.
+func (s *PostService) authorizedPost(ctx context.Context, userID, id uint) (*models.Post, error) {
+	post, err := s.postRepo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrPostNotFound
+		}
+		return nil, err
+	}
+
+	if post.UserID != userID {
+		return nil, ErrPostForbidden
+	}
+	return post, nil
 }
 
-func (s *PostService) Update(id uint, req models.UpdatePostRequest) (*models.Post, error) {
-	return s.postRepo.Update(id, req)
+func (s *PostService) GetPostDetail(ctx context.Context, viewerID uint, q models.PostListQuery) (*models.PostWithUserPage, error) {
+	q.ViewerID = viewerID
+	return s.postRepo.GetPostDetail(ctx, q)
 }
 
-func (s *PostService) Delete(id uint) error {
-	return s.postRepo.Delete(id)
+// publication returns the status and published_at for publishing at
+// publishAt: scheduled if it is in the future, otherwise published now.
+func publication(publishAt *time.Time) (string, *time.Time) {
+	now := time.Now()
+	if publishAt != nil && publishAt.After(now) {
+		at := publishAt.UTC()
+		return models.PostStatusScheduled, &at
+	}
+	return models.PostStatusPublished, &now
 }
 
-func (s *PostService) GetPostDetail() ([]models.PostWithUser, error) {
-	return s.postRepo.GetPostDetail()
+func diffSegments(edits []textdiff.Edit) []models.DiffSegment {
+	segments := make([]models.DiffSegment, 0, len(edits))
+	for _, edit := range edits {
+		segments = append(segments, models.DiffSegment{Op: edit.Kind, Text: edit.Text})
+	}
+	return segments
 }
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"context"
+
+	"github.com/tamabsndra/miniproject/miniproject-backend/repository"
+)
+
+// RBACService resolves the permissions granted to a set of roles. Grants
+// live in the database so they can change without a deploy; roles travel
+// in the access token.
+type RBACService struct {
+	roleRepo repository.RoleRepository
+}
+
+func NewRBACService(roleRepo repository.RoleRepository) *RBACService {
+	return &RBACService{roleRepo: roleRepo}
+}
+
+// HasPermissions reports whether roles together grant every permission.
+func (s *RBACService) HasPermissions(ctx context.Context, roles []string, permissions ...string) (bool, error) {
+	if len(roles) == 0 {
+		return len(permissions) == 0, nil
+	}
+
+	granted, err := s.roleRepo.PermissionsForRoles(ctx, roles)
+	if err != nil {
+		return false, err
+	}
+
+	set := make(map[string]bool, len(granted))
+	for _, permission := range granted {
+		set[permission] = true
+	}
+	for _, permission := range permissions {
+		if !set[permission] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
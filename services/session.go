@@ -0,0 +1,142 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/tamabsndra/miniproject/miniproject-backend/models"
+	"github.com/tamabsndra/miniproject/miniproject-backend/utils"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// Sessions are kept in one Redis hash per user, keyed by refresh family ID.
+// The family key stays the source of truth for whether a session is alive;
+// registry entries whose family has expired or been revoked are pruned when
+// the sessions are listed.
+
+// recordSession stores or refreshes the registry entry for a refresh family.
+func (s *TokenService) recordSession(ctx context.Context, userID uint, familyID string, client models.ClientInfo) error {
+	now := utils.GetCurrentTime()
+	session := models.Session{
+		ID:         familyID,
+		Device:     client.Device,
+		IP:         client.IP,
+		UserAgent:  client.UserAgent,
+		IssuedAt:   now,
+		LastSeenAt: now,
+	}
+
+	if existing, ok, err := s.getSession(ctx, userID, familyID); err != nil {
+		return err
+	} else if ok {
+		session.IssuedAt = existing.IssuedAt
+		if session.Device == "" {
+			session.Device = existing.Device
+		}
+	}
+	if session.Device == "" {
+		session.Device = utils.DescribeUserAgent(client.UserAgent)
+	}
+
+	value, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	return s.store.HSet(ctx, sessionsKey(userID), familyID, string(value), s.refreshTokenExpiry)
+}
+
+func (s *TokenService) getSession(ctx context.Context, userID uint, familyID string) (models.Session, bool, error) {
+	sessions, err := s.store.HGetAll(ctx, sessionsKey(userID))
+	if err != nil {
+		return models.Session{}, false, err
+	}
+
+	value, ok := sessions[familyID]
+	if !ok {
+		return models.Session{}, false, nil
+	}
+
+	var session models.Session
+	if err := json.Unmarshal([]byte(value), &session); err != nil {
+		return models.Session{}, false, err
+	}
+	return session, true, nil
+}
+
+// ListSessions returns the user's live sessions, most recently used first,
+// flagging the one identified by currentID.
+func (s *TokenService) ListSessions(ctx context.Context, userID uint, currentID string) ([]models.Session, error) {
+	entries, err := s.store.HGetAll(ctx, sessionsKey(userID))
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]models.Session, 0, len(entries))
+	var stale []string
+	for familyID, value := range entries {
+		alive, err := s.store.Exists(ctx, refreshFamilyKey(familyID))
+		if err != nil {
+			return nil, err
+		}
+
+		var session models.Session
+		if !alive || json.Unmarshal([]byte(value), &session) != nil {
+			stale = append(stale, familyID)
+			continue
+		}
+
+		session.Current = session.ID == currentID
+		sessions = append(sessions, session)
+	}
+
+	if err := s.store.HDel(ctx, sessionsKey(userID), stale...); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+	})
+	return sessions, nil
+}
+
+// RevokeSession signs out one of the user's sessions. Its refresh token
+// stops working immediately and so do its access tokens, since
+// IsTokenRevoked rejects tokens whose family no longer exists.
+func (s *TokenService) RevokeSession(ctx context.Context, userID uint, sessionID string) error {
+	_, ok, err := s.getSession(ctx, userID, sessionID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrSessionNotFound
+	}
+
+	if err := s.RevokeRefreshFamily(ctx, sessionID); err != nil {
+		return err
+	}
+	return s.store.HDel(ctx, sessionsKey(userID), sessionID)
+}
+
+// revokeAllSessions drops every refresh family in the user's registry
+// together with the registry itself.
+func (s *TokenService) revokeAllSessions(ctx context.Context, userID uint) error {
+	entries, err := s.store.HGetAll(ctx, sessionsKey(userID))
+	if err != nil {
+		return err
+	}
+
+	for familyID := range entries {
+		if err := s.RevokeRefreshFamily(ctx, familyID); err != nil {
+			return err
+		}
+	}
+	return s.store.Del(ctx, sessionsKey(userID))
+}
+
+func sessionsKey(userID uint) string {
+	return fmt.Sprintf("sessions:%d", userID)
+}
@@ -2,38 +2,51 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
-	"github.com/redis/go-redis/v9"
-
 	"github.com/tamabsndra/miniproject/miniproject-backend/models"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/store"
 	"github.com/tamabsndra/miniproject/miniproject-backend/utils"
 )
 
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token has already been used")
+	ErrInvalidMFAToken     = errors.New("invalid or expired mfa token")
+)
+
 type TokenService struct {
-	redis       *redis.Client
-	tokenExpiry time.Duration
-	jwtSecret   string
+	store              store.Store
+	tokenExpiry        time.Duration
+	refreshTokenExpiry time.Duration
+	signer             *utils.TokenSigner
 }
 
-func NewTokenService(redis *redis.Client, tokenExpiry time.Duration, jwtSecret string) *TokenService {
+func NewTokenService(store store.Store, tokenExpiry, refreshTokenExpiry time.Duration, signer *utils.TokenSigner) *TokenService {
 	return &TokenService{
-		redis:       redis,
-		tokenExpiry: tokenExpiry,
-		jwtSecret:   jwtSecret,
+		store:              store,
+		tokenExpiry:        tokenExpiry,
+		refreshTokenExpiry: refreshTokenExpiry,
+		signer:             signer,
 	}
 }
 
-func (s *TokenService) ValidateToken(token string) (*models.TokenValidationResult, error) {
-	if s.IsTokenBlacklisted(token) {
+func (s *TokenService) ValidateToken(ctx context.Context, token string) (*models.TokenValidationResult, error) {
+	blacklisted, err := s.IsTokenBlacklisted(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if blacklisted {
 		return &models.TokenValidationResult{
 			Valid:   false,
 			Message: "Token has been revoked",
 		}, nil
 	}
 
-	claims, err := utils.ValidateToken(token, s.jwtSecret)
+	claims, err := utils.ValidateToken(token, s.signer)
 	if err != nil {
 		var message string
 		switch err {
@@ -54,6 +67,17 @@ func (s *TokenService) ValidateToken(token string) (*models.TokenValidationResul
 		}, nil
 	}
 
+	revoked, err := s.IsTokenRevoked(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return &models.TokenValidationResult{
+			Valid:   false,
+			Message: "Token has been revoked",
+		}, nil
+	}
+
 	metadata, err := utils.ExtractTokenMetadata(claims)
 	if err != nil {
 		return &models.TokenValidationResult{
@@ -72,15 +96,212 @@ func (s *TokenService) ValidateToken(token string) (*models.TokenValidationResul
 	}, nil
 }
 
-func (s *TokenService) BlacklistToken(token string) error {
-	ctx := context.Background()
+func (s *TokenService) BlacklistToken(ctx context.Context, token string) error {
 	key := fmt.Sprintf("blacklist:%s", token)
-	return s.redis.Set(ctx, key, "true", s.tokenExpiry).Err()
+	return s.store.Set(ctx, key, "true", s.tokenExpiry)
 }
 
-func (s *TokenService) IsTokenBlacklisted(token string) bool {
-	ctx := context.Background()
+func (s *TokenService) IsTokenBlacklisted(ctx context.Context, token string) (bool, error) {
 	key := fmt.Sprintf("blacklist:%s", token)
-	exists, err := s.redis.Exists(ctx, key).Result()
-	return err == nil && exists > 0
+	return s.store.Exists(ctx, key)
+}
+
+// IsTokenRevoked reports whether the token predates the last time all of
+// its user's tokens were revoked, or belongs to a session that has ended.
+func (s *TokenService) IsTokenRevoked(ctx context.Context, claims *utils.JWTClaim) (bool, error) {
+	version, err := s.tokenVersion(ctx, claims.UserID)
+	if err != nil {
+		return false, err
+	}
+	if claims.TokenVersion != version {
+		return true, nil
+	}
+
+	if claims.FamilyID == "" {
+		return false, nil
+	}
+	alive, err := s.store.Exists(ctx, refreshFamilyKey(claims.FamilyID))
+	if err != nil {
+		return false, err
+	}
+	return !alive, nil
+}
+
+// RevokeAllUserTokens invalidates every access and refresh token issued to
+// the user so far by bumping their token version, and clears their session
+// registry.
+func (s *TokenService) RevokeAllUserTokens(ctx context.Context, userID uint) error {
+	if _, err := s.store.Incr(ctx, tokenVersionKey(userID), 0); err != nil {
+		return err
+	}
+	return s.revokeAllSessions(ctx, userID)
+}
+
+func (s *TokenService) tokenVersion(ctx context.Context, userID uint) (int64, error) {
+	value, err := s.store.Get(ctx, tokenVersionKey(userID))
+	if errors.Is(err, store.ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// IssueTokenPair starts a new refresh token family for the user, registers it
+// as a session opened by client and returns the first access/refresh token
+// pair of that family.
+func (s *TokenService) IssueTokenPair(ctx context.Context, user models.User, client models.ClientInfo) (*models.TokenPair, error) {
+	familyID, err := utils.GenerateRandomID(16)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenID, err := utils.GenerateRandomID(16)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := s.tokenVersion(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.store.Set(ctx, refreshFamilyKey(familyID), tokenID, s.refreshTokenExpiry); err != nil {
+		return nil, err
+	}
+	if err := s.recordSession(ctx, user.ID, familyID, client); err != nil {
+		return nil, err
+	}
+
+	return s.generateTokenPair(user, familyID, tokenID, version)
+}
+
+// ParseAccessToken validates the signature, claims and type of an access
+// token. It does not check revocation; see IsTokenRevoked.
+func (s *TokenService) ParseAccessToken(token string) (*utils.JWTClaim, error) {
+	return utils.ValidateToken(token, s.signer)
+}
+
+// ParseRefreshToken validates the signature and type of a refresh token
+// without consuming it.
+func (s *TokenService) ParseRefreshToken(refreshToken string) (*utils.JWTClaim, error) {
+	claims, err := utils.ValidateRefreshToken(refreshToken, s.signer)
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	return claims, nil
+}
+
+// RotateRefreshToken consumes the refresh token described by claims and
+// returns a new token pair in the same family. Presenting a refresh token
+// that has already been rotated revokes the entire family. The session's
+// last-seen time and client address are updated from client.
+func (s *TokenService) RotateRefreshToken(ctx context.Context, user models.User, claims *utils.JWTClaim, client models.ClientInfo) (*models.TokenPair, error) {
+	revoked, err := s.IsTokenRevoked(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	tokenID, err := utils.GenerateRandomID(16)
+	if err != nil {
+		return nil, err
+	}
+
+	key := refreshFamilyKey(claims.FamilyID)
+	swapped, err := s.store.CompareAndSwap(ctx, key, claims.ID, tokenID, s.refreshTokenExpiry)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The family exists but has moved on: an already rotated token was
+	// replayed, so assume it leaked and revoke the whole family.
+	if !swapped {
+		if err := s.store.Del(ctx, key); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	if err := s.recordSession(ctx, user.ID, claims.FamilyID, client); err != nil {
+		return nil, err
+	}
+
+	return s.generateTokenPair(user, claims.FamilyID, tokenID, claims.TokenVersion)
+}
+
+// RevokeRefreshFamily invalidates every refresh token issued in the family.
+func (s *TokenService) RevokeRefreshFamily(ctx context.Context, familyID string) error {
+	if familyID == "" {
+		return nil
+	}
+	return s.store.Del(ctx, refreshFamilyKey(familyID))
+}
+
+// IssueMFAPendingToken returns a single-use token, valid for ttl, that
+// stands in for the password during the second step of a two-factor login.
+func (s *TokenService) IssueMFAPendingToken(ctx context.Context, user models.User, ttl time.Duration) (string, error) {
+	tokenID, err := utils.GenerateRandomID(16)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.store.Set(ctx, mfaPendingKey(tokenID), strconv.FormatUint(uint64(user.ID), 10), ttl); err != nil {
+		return "", err
+	}
+	return utils.GenerateMFAPendingToken(user, tokenID, s.signer, ttl)
+}
+
+// ParseMFAPendingToken validates an mfa_pending token without consuming it.
+func (s *TokenService) ParseMFAPendingToken(token string) (*utils.JWTClaim, error) {
+	claims, err := utils.ValidateMFAPendingToken(token, s.signer)
+	if err != nil {
+		return nil, ErrInvalidMFAToken
+	}
+	return claims, nil
+}
+
+// ConsumeMFAPendingToken marks the token as used, failing if it already was.
+func (s *TokenService) ConsumeMFAPendingToken(ctx context.Context, claims *utils.JWTClaim) error {
+	_, err := s.store.GetDel(ctx, mfaPendingKey(claims.ID))
+	if errors.Is(err, store.ErrNotFound) {
+		return ErrInvalidMFAToken
+	}
+	return err
+}
+
+func (s *TokenService) generateTokenPair(user models.User, familyID, tokenID string, tokenVersion int64) (*models.TokenPair, error) {
+	accessToken, err := utils.GenerateAccessToken(user, familyID, tokenVersion, s.signer, s.tokenExpiry)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := utils.GenerateRefreshToken(user, familyID, tokenID, tokenVersion, s.signer, s.refreshTokenExpiry)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TokenPair{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(s.tokenExpiry.Seconds()),
+	}, nil
+}
+
+func refreshFamilyKey(familyID string) string {
+	return fmt.Sprintf("refresh_family:%s", familyID)
+}
+
+func mfaPendingKey(tokenID string) string {
+	return fmt.Sprintf("mfa_pending:%s", tokenID)
+}
+
+func tokenVersionKey(userID uint) string {
+	return fmt.Sprintf("token_version:%d", userID)
 }
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+
+	"github.com/tamabsndra/miniproject/miniproject-backend/models"
+	"github.com/tamabsndra/miniproject/miniproject-backend/repository"
+)
+
+var (
+	ErrUserNotFound         = errors.New("user not found")
+	ErrCannotRemoveOwnAdmin = errors.New("you cannot remove your own admin role")
+)
+
+type UserService struct {
+	userRepo     repository.UserRepository
+	tokenService *TokenService
+}
+
+func NewUserService(userRepo repository.UserRepository, tokenService *TokenService) *UserService {
+	return &UserService{userRepo: userRepo, tokenService: tokenService}
+}
+
+// GetByID returns the user's own account, without the password hash.
+func (s *UserService) GetByID(ctx context.Context, id uint) (*models.User, error) {
+	user, err := s.userRepo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	user.Password = ""
+	return user, nil
+}
+
+func (s *UserService) UpdateProfile(ctx context.Context, id uint, req models.UpdateProfileRequest) (*models.User, error) {
+	user, err := s.userRepo.UpdateProfile(ctx, id, req)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	user.Password = ""
+	return user, nil
+}
+
+// GetPublicProfile returns the fields of a user that anyone may see.
+func (s *UserService) GetPublicProfile(ctx context.Context, id uint) (*models.PublicProfile, error) {
+	user, err := s.userRepo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	return &models.PublicProfile{
+		ID:        user.ID,
+		Name:      user.Name,
+		Bio:       user.Bio,
+		AvatarURL: user.AvatarURL,
+		Location:  user.Location,
+		Website:   user.Website,
+		CreatedAt: user.CreatedAt,
+	}, nil
+}
+
+func (s *UserService) List(ctx context.Context, q models.UserListQuery) (*models.UserPage, error) {
+	return s.userRepo.List(ctx, q)
+}
+
+// SetRoles replaces the roles of user id. actorID is the admin making the
+// change, who may not strip their own admin role and lock everyone out.
+// Tokens carry the roles they were issued with, so taking a role away
+// revokes the user's tokens; added roles apply from their next token.
+func (s *UserService) SetRoles(ctx context.Context, actorID, id uint, roles []string) (*models.User, error) {
+	roles = uniqueRoles(roles)
+	if actorID == id && !containsRole(roles, models.RoleAdmin) {
+		return nil, ErrCannotRemoveOwnAdmin
+	}
+
+	previous, err := s.userRepo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	user, err := s.userRepo.SetRoles(ctx, id, roles)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	for _, role := range previous.Roles {
+		if !containsRole(roles, role) {
+			if err := s.tokenService.RevokeAllUserTokens(ctx, id); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+
+	user.Password = ""
+	return user, nil
+}
+
+// GrantRole adds role to the user with the given email, keeping the roles
+// they already have.
+func (s *UserService) GrantRole(ctx context.Context, email, role string) error {
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+
+	if containsRole(user.Roles, role) {
+		return nil
+	}
+	_, err = s.userRepo.SetRoles(ctx, user.ID, uniqueRoles(append(user.Roles, role)))
+	return err
+}
+
+func uniqueRoles(roles []string) []string {
+	seen := make(map[string]bool, len(roles))
+	unique := make([]string, 0, len(roles))
+	for _, role := range roles {
+		if !seen[role] {
+			seen[role] = true
+			unique = append(unique, role)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
+
+func containsRole(roles []string, role string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
@@ -8,15 +8,44 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 
 	"github.com/tamabsndra/miniproject/miniproject-backend/models"
+	"github.com/tamabsndra/miniproject/miniproject-backend/pkg/keyring"
+)
+
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+	// TokenTypeMFAPending proves the password step of a two-factor login.
+	// It is only accepted by the second login step, never for API access.
+	TokenTypeMFAPending = "mfa_pending"
 )
 
 type JWTClaim struct {
-	UserID    uint   `json:"user_id"`
-	Email     string `json:"email"`
-	TokenType string `json:"token_type"`
+	UserID    uint     `json:"user_id"`
+	Email     string   `json:"email"`
+	TokenType string   `json:"token_type"`
+	FamilyID  string   `json:"family_id,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+	// TokenVersion is the user's token version at issue time; bumping the
+	// version revokes every token issued before it.
+	TokenVersion int64 `json:"token_version,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// TokenSigner signs tokens with the keyring's current key, stamping the
+// configured issuer and audience, and verifies them against any key still
+// in the ring.
+type TokenSigner struct {
+	keys     *keyring.KeyRing
+	issuer   string
+	audience string
+}
+
+// NewTokenSigner returns a signer. An empty audience leaves the claim out
+// and skips checking it.
+func NewTokenSigner(keys *keyring.KeyRing, issuer, audience string) *TokenSigner {
+	return &TokenSigner{keys: keys, issuer: issuer, audience: audience}
+}
+
 var (
 	ErrTokenExpired     = errors.New("token has expired")
 	ErrTokenNotValidYet = errors.New("token not active yet")
@@ -25,31 +54,102 @@ var (
 	ErrTokenTypeInvalid = errors.New("token type is invalid")
 )
 
-func GenerateToken(user models.User, secretKey string, expiration time.Duration) (string, error) {
+func GenerateToken(user models.User, signer *TokenSigner, expiration time.Duration) (string, error) {
+	return generateToken(user, TokenTypeAccess, "", "", 0, signer, expiration)
+}
+
+// GenerateAccessToken mints an access token bound to a refresh token family,
+// so revoking the family (logout, reuse detection) can be traced back to it.
+func GenerateAccessToken(user models.User, familyID string, tokenVersion int64, signer *TokenSigner, expiration time.Duration) (string, error) {
+	return generateToken(user, TokenTypeAccess, familyID, "", tokenVersion, signer, expiration)
+}
+
+// GenerateRefreshToken mints a refresh token identified by tokenID (jti)
+// within the given family.
+func GenerateRefreshToken(user models.User, familyID, tokenID string, tokenVersion int64, signer *TokenSigner, expiration time.Duration) (string, error) {
+	return generateToken(user, TokenTypeRefresh, familyID, tokenID, tokenVersion, signer, expiration)
+}
+
+// GenerateMFAPendingToken mints the token handed out after a correct
+// password when the account still needs a second factor. It carries no
+// roles since it grants no access by itself.
+func GenerateMFAPendingToken(user models.User, tokenID string, signer *TokenSigner, expiration time.Duration) (string, error) {
+	user.Roles = nil
+	return generateToken(user, TokenTypeMFAPending, "", tokenID, 0, signer, expiration)
+}
+
+func generateToken(user models.User, tokenType, familyID, tokenID string, tokenVersion int64, signer *TokenSigner, expiration time.Duration) (string, error) {
+	kid, method, key, err := signer.keys.SigningKey()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
 	claims := JWTClaim{
-		UserID:    user.ID,
-		Email:     user.Email,
-		TokenType: "access",
+		UserID:       user.ID,
+		Email:        user.Email,
+		TokenType:    tokenType,
+		FamilyID:     familyID,
+		Roles:        user.Roles,
+		TokenVersion: tokenVersion,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiration)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			NotBefore: jwt.NewNumericDate(time.Now()),
-			Issuer:    "your-application-name",
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiration)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    signer.issuer,
 			Subject:   fmt.Sprintf("%d", user.ID),
+			ID:        tokenID,
 		},
 	}
+	if signer.audience != "" {
+		claims.Audience = jwt.ClaimStrings{signer.audience}
+	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secretKey))
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+	return token.SignedString(key)
 }
 
-func ValidateToken(tokenString string, secretKey string) (*JWTClaim, error) {
+func ValidateToken(tokenString string, signer *TokenSigner) (*JWTClaim, error) {
+	return parseToken(tokenString, signer, TokenTypeAccess)
+}
+
+func ValidateRefreshToken(tokenString string, signer *TokenSigner) (*JWTClaim, error) {
+	claims, err := parseToken(tokenString, signer, TokenTypeRefresh)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.FamilyID == "" || claims.ID == "" {
+		return nil, ErrTokenInvalid
+	}
+
+	return claims, nil
+}
+
+func ValidateMFAPendingToken(tokenString string, signer *TokenSigner) (*JWTClaim, error) {
+	claims, err := parseToken(tokenString, signer, TokenTypeMFAPending)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.ID == "" {
+		return nil, ErrTokenInvalid
+	}
+
+	return claims, nil
+}
+
+func parseToken(tokenString string, signer *TokenSigner, tokenType string) (*JWTClaim, error) {
+	options := []jwt.ParserOption{jwt.WithIssuer(signer.issuer)}
+	if signer.audience != "" {
+		options = append(options, jwt.WithAudience(signer.audience))
+	}
+
 	token, err := jwt.ParseWithClaims(tokenString, &JWTClaim{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(secretKey), nil
-	})
+		kid, _ := token.Header["kid"].(string)
+		return signer.keys.VerificationKey(kid, token.Method.Alg())
+	}, options...)
 
 	if err != nil {
 		if errors.Is(err, jwt.ErrTokenExpired) {
@@ -67,7 +167,7 @@ func ValidateToken(tokenString string, secretKey string) (*JWTClaim, error) {
 		return nil, ErrTokenInvalid
 	}
 
-	if claims.TokenType != "access" {
+	if claims.TokenType != tokenType {
 		return nil, ErrTokenTypeInvalid
 	}
 
@@ -78,6 +178,7 @@ func ExtractTokenMetadata(claims *JWTClaim) (*models.TokenMetadata, error) {
 	return &models.TokenMetadata{
 		UserID:    claims.UserID,
 		Email:     claims.Email,
+		Roles:     claims.Roles,
 		IssuedAt:  claims.IssuedAt.Time,
 		ExpiresAt: claims.ExpiresAt.Time,
 	}, nil
@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+var ErrInvalidCursor = errors.New("invalid pagination cursor")
+
+// Cursor marks a position in a keyset-paginated listing. It records the sort
+// it was issued for so it cannot be replayed against a different ordering.
+type Cursor struct {
+	SortBy   string `json:"s"`
+	Order    string `json:"o"`
+	Value    string `json:"v,omitempty"`
+	ID       uint   `json:"id"`
+	Backward bool   `json:"b,omitempty"`
+}
+
+func EncodeCursor(cursor Cursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func DecodeCursor(encoded string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor Cursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &cursor, nil
+}
@@ -0,0 +1,47 @@
+package utils
+
+import "strings"
+
+// DescribeUserAgent turns a User-Agent header into a short device label
+// such as "Firefox on Linux". It only recognises common browsers and
+// platforms and falls back to "Unknown device".
+func DescribeUserAgent(userAgent string) string {
+	browser := firstMatch(userAgent, [][2]string{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+		{"PostmanRuntime/", "Postman"},
+	})
+	platform := firstMatch(userAgent, [][2]string{
+		{"Android", "Android"},
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	})
+
+	switch {
+	case browser != "" && platform != "":
+		return browser + " on " + platform
+	case browser != "":
+		return browser
+	case platform != "":
+		return platform
+	default:
+		return "Unknown device"
+	}
+}
+
+func firstMatch(s string, patterns [][2]string) string {
+	for _, p := range patterns {
+		if strings.Contains(s, p[0]) {
+			return p[1]
+		}
+	}
+	return ""
+}